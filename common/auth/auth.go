@@ -0,0 +1,141 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/rpc"
+	"strings"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+)
+
+// AnyHost is the identity of the shared token, it may act for every host
+const AnyHost = "*"
+
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Config of the credential check on an rpc listener
+type Config struct {
+	Enabled  bool              `json:"enabled"`
+	Token    string            `json:"token"`    // shared by every host
+	Hosts    map[string]string `json:"hosts"`    // hostname => token of the host
+	CertHost bool              `json:"certHost"` // the common name of a verified client certificate names the host
+}
+
+// Identify returns the host the credential belongs to
+func (this *Config) Identify(hostname, token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	if this.Token != "" && subtle.ConstantTimeCompare([]byte(this.Token), []byte(token)) == 1 {
+		return AnyHost, true
+	}
+	if t, ok := this.Hosts[hostname]; ok && subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+		return hostname, true
+	}
+	return "", false
+}
+
+// the headers of the credential of an http request, the host is needed by a host token only.
+// A bearer token in the Authorization header is taken too, e.g. from prometheus remote_write
+const (
+	HostHeader  = "X-Falcon-Host"
+	TokenHeader = "X-Falcon-Token"
+)
+
+// IdentifyRequest returns the host the credential of an http request belongs to
+func (this *Config) IdentifyRequest(req *http.Request) (string, bool) {
+	token := req.Header.Get(TokenHeader)
+	if token == "" {
+		if s := req.Header.Get("Authorization"); strings.HasPrefix(s, "Bearer ") {
+			token = strings.TrimSpace(s[len("Bearer "):])
+		}
+	}
+	return this.Identify(req.Header.Get(HostHeader), token)
+}
+
+// Check is called with the authenticated host and the decoded args of a method
+type Check func(host string, args interface{}) error
+
+type serverCodec struct {
+	rpc.ServerCodec
+	cfg        *Config
+	authMethod string
+	checks     map[string]Check
+	host       string // "" until authenticated
+	method     string
+}
+
+// NewServerCodec checks the credential of the connection, sent by authMethod
+// or carried by the client certificate, before the methods in checks are called.
+// The other methods are not checked, e.g. the ones called by judge.
+func NewServerCodec(codec rpc.ServerCodec, conn net.Conn, cfg *Config, authMethod string, checks map[string]Check) rpc.ServerCodec {
+	c := &serverCodec{
+		ServerCodec: codec,
+		cfg:         cfg,
+		authMethod:  authMethod,
+		checks:      checks,
+	}
+
+	if tlsConn, ok := conn.(*tls.Conn); ok && cfg.CertHost {
+		if tlsConn.Handshake() == nil {
+			state := tlsConn.ConnectionState()
+			if len(state.VerifiedChains) > 0 {
+				c.host = state.PeerCertificates[0].Subject.CommonName
+			}
+		}
+	}
+	return c
+}
+
+func (this *serverCodec) ReadRequestHeader(r *rpc.Request) error {
+	err := this.ServerCodec.ReadRequestHeader(r)
+	this.method = r.ServiceMethod
+	return err
+}
+
+// an error here is answered to the client and the connection keeps serving
+func (this *serverCodec) ReadRequestBody(body interface{}) error {
+	if err := this.ServerCodec.ReadRequestBody(body); err != nil || body == nil {
+		return err
+	}
+
+	if this.method == this.authMethod {
+		req, ok := body.(*model.AuthRequest)
+		if !ok {
+			return ErrUnauthorized
+		}
+		host, ok := this.cfg.Identify(req.Hostname, req.Token)
+		if !ok {
+			return ErrUnauthorized
+		}
+		this.host = host
+		return nil
+	}
+
+	check, ok := this.checks[this.method]
+	if !ok {
+		return nil
+	}
+	if this.host == "" {
+		return ErrUnauthorized
+	}
+	return check(this.host, body)
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"net"
+	"net/http/httptest"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"testing"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+)
+
+type Svc int
+
+func (this *Svc) Auth(req model.AuthRequest, resp *model.SimpleRpcResponse) error {
+	return nil
+}
+
+func (this *Svc) Update(args []*model.MetricValue, reply *int) error {
+	for _, v := range args {
+		if v != nil {
+			*reply++
+		}
+	}
+	return nil
+}
+
+func dial(cfg *Config) *rpc.Client {
+	server := rpc.NewServer()
+	server.Register(new(Svc))
+
+	sconn, cconn := net.Pipe()
+	go server.ServeCodec(NewServerCodec(jsonrpc.NewServerCodec(sconn), sconn, cfg, "Svc.Auth", map[string]Check{
+		"Svc.Update": func(host string, args interface{}) error {
+			if host == AnyHost {
+				return nil
+			}
+			items := *args.(*[]*model.MetricValue)
+			for i, v := range items {
+				if v.Endpoint != host {
+					items[i] = nil
+				}
+			}
+			return nil
+		},
+	}))
+	return jsonrpc.NewClient(cconn)
+}
+
+func TestServerCodec(t *testing.T) {
+	cfg := &Config{Enabled: true, Token: "shared", Hosts: map[string]string{"web1": "t1"}}
+	metrics := []*model.MetricValue{{Endpoint: "web1"}, {Endpoint: "web2"}}
+	var resp model.SimpleRpcResponse
+
+	cases := []struct {
+		auth   *model.AuthRequest
+		authOk bool
+		count  int
+	}{
+		{nil, false, -1},
+		{&model.AuthRequest{Hostname: "web1", Token: "bad"}, false, -1},
+		{&model.AuthRequest{Hostname: "web2", Token: "t1"}, false, -1},
+		{&model.AuthRequest{Hostname: "web1", Token: "t1"}, true, 1},
+		{&model.AuthRequest{Hostname: "any", Token: "shared"}, true, 2},
+	}
+
+	for i, c := range cases {
+		client := dial(cfg)
+
+		if c.auth != nil {
+			err := client.Call("Svc.Auth", c.auth, &resp)
+			if (err == nil) != c.authOk {
+				t.Errorf("case %d: unexpected auth error %v", i, err)
+			}
+		}
+
+		var count int
+		err := client.Call("Svc.Update", metrics, &count)
+		if c.count < 0 {
+			if err == nil || err.Error() != ErrUnauthorized.Error() {
+				t.Errorf("case %d: expect unauthorized, but %v", i, err)
+			}
+		} else if err != nil || count != c.count {
+			t.Errorf("case %d: expect %d, but %d %v", i, c.count, count, err)
+		}
+
+		client.Close()
+	}
+}
+
+func TestIdentifyRequest(t *testing.T) {
+	cfg := &Config{Enabled: true, Token: "shared", Hosts: map[string]string{"web1": "t1"}}
+
+	cases := []struct {
+		headers map[string]string
+		host    string
+		ok      bool
+	}{
+		{nil, "", false},
+		{map[string]string{TokenHeader: "bad"}, "", false},
+		{map[string]string{TokenHeader: "t1"}, "", false},
+		{map[string]string{HostHeader: "web1", TokenHeader: "t1"}, "web1", true},
+		{map[string]string{TokenHeader: "shared"}, AnyHost, true},
+		{map[string]string{"Authorization": "Bearer shared"}, AnyHost, true},
+		{map[string]string{"Authorization": "Basic shared"}, "", false},
+	}
+
+	for i, c := range cases {
+		req := httptest.NewRequest("POST", "/api/push", nil)
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		if host, ok := cfg.IdentifyRequest(req); host != c.host || ok != c.ok {
+			t.Errorf("case %d: expect %s %v, but %s %v", i, c.host, c.ok, host, ok)
+		}
+	}
+}
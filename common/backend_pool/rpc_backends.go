@@ -34,11 +34,13 @@ type SafeRpcConnPools struct {
 	MaxIdle     int
 	ConnTimeout int
 	CallTimeout int
+
+	create func(name string, address string, connTimeout time.Duration, maxConns int, maxIdle int) *connp.ConnPool
 }
 
 func CreateSafeRpcConnPools(maxConns, maxIdle, connTimeout, callTimeout int, cluster []string) *SafeRpcConnPools {
 	cp := &SafeRpcConnPools{M: make(map[string]*connp.ConnPool), MaxConns: maxConns, MaxIdle: maxIdle,
-		ConnTimeout: connTimeout, CallTimeout: callTimeout}
+		ConnTimeout: connTimeout, CallTimeout: callTimeout, create: createOneRpcPool}
 
 	ct := time.Duration(cp.ConnTimeout) * time.Millisecond
 	for _, address := range cluster {
@@ -53,7 +55,7 @@ func CreateSafeRpcConnPools(maxConns, maxIdle, connTimeout, callTimeout int, clu
 
 func CreateSafeJsonrpcConnPools(maxConns, maxIdle, connTimeout, callTimeout int, cluster []string) *SafeRpcConnPools {
 	cp := &SafeRpcConnPools{M: make(map[string]*connp.ConnPool), MaxConns: maxConns, MaxIdle: maxIdle,
-		ConnTimeout: connTimeout, CallTimeout: callTimeout}
+		ConnTimeout: connTimeout, CallTimeout: callTimeout, create: createOneJsonrpcPool}
 
 	ct := time.Duration(cp.ConnTimeout) * time.Millisecond
 	for _, address := range cluster {
@@ -122,7 +124,37 @@ func (this *SafeRpcConnPools) Destroy() {
 	}
 }
 
+// Update creates the pools of the new addresses in cluster, and destroys the pools not in cluster any more
+func (this *SafeRpcConnPools) Update(cluster []string) {
+	create := this.create
+	if create == nil {
+		create = createOneRpcPool
+	}
+	ct := time.Duration(this.ConnTimeout) * time.Millisecond
+
+	this.Lock()
+	defer this.Unlock()
+
+	addresses := make(map[string]bool)
+	for _, address := range cluster {
+		addresses[address] = true
+		if _, exist := this.M[address]; exist {
+			continue
+		}
+		this.M[address] = create(address, address, ct, this.MaxConns, this.MaxIdle)
+	}
+
+	for address, p := range this.M {
+		if !addresses[address] {
+			p.Destroy()
+			delete(this.M, address)
+		}
+	}
+}
+
 func (this *SafeRpcConnPools) Proc() []string {
+	this.RLock()
+	defer this.RUnlock()
 	procs := []string{}
 	for _, cp := range this.M {
 		procs = append(procs, cp.Proc())
@@ -23,18 +23,70 @@ type AgentReportRequest struct {
 	IP            string
 	AgentVersion  string
 	PluginVersion string
+	Upgrade       *AgentUpgradeStatus // nil if the agent never tried to upgrade
 }
 
 func (this *AgentReportRequest) String() string {
 	return fmt.Sprintf(
-		"<Hostname:%s, IP:%s, AgentVersion:%s, PluginVersion:%s>",
+		"<Hostname:%s, IP:%s, AgentVersion:%s, PluginVersion:%s, Upgrade:%v>",
 		this.Hostname,
 		this.IP,
 		this.AgentVersion,
 		this.PluginVersion,
+		this.Upgrade,
 	)
 }
 
+// status of the last upgrade tried by the agent
+const (
+	UpgradeDownloading = "downloading"
+	UpgradeRestarting  = "restarting"
+	UpgradeDone        = "upgraded"
+	UpgradeFailed      = "failed"
+	UpgradeRolledBack  = "rolledback"
+)
+
+type AgentUpgradeStatus struct {
+	Version string
+	Status  string
+	Message string
+}
+
+func (this *AgentUpgradeStatus) String() string {
+	return fmt.Sprintf(
+		"<Version:%s, Status:%s, Message:%s>",
+		this.Version,
+		this.Status,
+		this.Message,
+	)
+}
+
+// the agent version a host group should run
+type AgentUpgrade struct {
+	Version  string
+	Url      string
+	Checksum string // sha256 of the binary, hex
+}
+
+func (this *AgentUpgrade) String() string {
+	return fmt.Sprintf(
+		"<Version:%s, Url:%s, Checksum:%s>",
+		this.Version,
+		this.Url,
+		this.Checksum,
+	)
+}
+
+// reply of Agent.ReportStatus, compatible with SimpleRpcResponse
+type AgentReportResponse struct {
+	Code    int           `json:"code"`
+	Upgrade *AgentUpgrade `json:"upgrade"`
+}
+
+func (this *AgentReportResponse) String() string {
+	return fmt.Sprintf("<Code: %d, Upgrade: %v>", this.Code, this.Upgrade)
+}
+
 type AgentUpdateInfo struct {
 	LastUpdate    int64
 	ReportRequest *AgentReportRequest
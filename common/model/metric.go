@@ -28,6 +28,8 @@ type MetricValue struct {
 	Type      string      `json:"counterType"`
 	Tags      string      `json:"tags"`
 	Timestamp int64       `json:"timestamp"`
+	// seconds a deduplicated GAUGE may be silent, the value holds till then
+	Heartbeat int64 `json:"heartbeat,omitempty"`
 }
 
 func (this *MetricValue) String() string {
@@ -67,6 +69,7 @@ type MetaData struct {
 	Value       float64           `json:"value"`
 	CounterType string            `json:"counterType"`
 	Tags        map[string]string `json:"tags"`
+	Heartbeat   int64             `json:"heartbeat,omitempty"`
 }
 
 func (t *MetaData) String() string {
@@ -30,3 +30,13 @@ func (this *SimpleRpcResponse) String() string {
 
 type NullRpcRequest struct {
 }
+
+// the first call on an authenticated rpc connection, e.g. Transfer.Auth or Agent.Auth
+type AuthRequest struct {
+	Hostname string
+	Token    string
+}
+
+func (this *AuthRequest) String() string {
+	return fmt.Sprintf("<Hostname: %s>", this.Hostname)
+}
@@ -21,6 +21,13 @@ import (
 	"strings"
 )
 
+var tagReplacer = strings.NewReplacer(",", "_", "=", "_", " ", "_")
+
+// SanitizeTag replaces the separators of a tag string in a tag name or value
+func SanitizeTag(s string) string {
+	return tagReplacer.Replace(s)
+}
+
 func SortedTags(tags map[string]string) string {
 	if tags == nil {
 		return ""
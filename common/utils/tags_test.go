@@ -117,6 +117,12 @@ func Test_DictedTagstring(t *testing.T) {
 	}
 }
 
+func Test_SanitizeTag(t *testing.T) {
+	if r := SanitizeTag("a b,c=d"); r != "a_b_c_d" {
+		t.Errorf("expect a_b_c_d, got %v\n", r)
+	}
+}
+
 func Benchmark_SortedTags_1pair(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		SortedTags(map[string]string{"1": "1"})
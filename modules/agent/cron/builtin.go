@@ -15,9 +15,11 @@
 package cron
 
 import (
+	"fmt"
 	"github.com/open-falcon/falcon-plus/common/model"
 	"github.com/open-falcon/falcon-plus/modules/agent/g"
 	"log"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -40,9 +42,14 @@ func syncBuiltinMetrics() {
 		time.Sleep(duration)
 
 		var ports = []int64{}
+		var connPorts = make(map[int64]bool)
 		var paths = []string{}
 		var procs = make(map[string]map[int]string)
-		var urls = make(map[string]string)
+		var urls = make(map[string]*g.UrlProbe)
+		var connects = make(map[string]*g.ConnectProbe)
+		var services = make(map[string]map[string]string)
+		var promTargets = make(map[string]*g.PrometheusTarget)
+		var logKeywords = make(map[string]*g.LogKeyword)
 
 		hostname, err := g.Hostname()
 		if err != nil {
@@ -75,23 +82,74 @@ func syncBuiltinMetrics() {
 		for _, metric := range resp.Metrics {
 
 			if metric.Metric == g.URL_CHECK_HEALTH {
-				arr := strings.Split(metric.Tags, ",")
-				if len(arr) != 2 {
+				probe, err := parseUrlProbe(metric.Tags)
+				if err != nil {
+					log.Println("metric parse url.check.health tags failed:", err)
 					continue
 				}
-				url := strings.Split(arr[0], "=")
-				if len(url) != 2 {
+				urls[metric.Tags] = probe
+			}
+
+			if metric.Metric == g.NET_PORT_CONNECT {
+				probe, err := parseConnectProbe(metric.Tags)
+				if err != nil {
+					log.Println("metric parse net.port.connect tags failed:", err)
 					continue
 				}
-				stime := strings.Split(arr[1], "=")
-				if len(stime) != 2 {
+				connects[metric.Tags] = probe
+				continue
+			}
+
+			if metric.Metric == g.REDIS_UP || metric.Metric == g.MYSQL_UP || metric.Metric == g.NGINX_UP {
+				key := "addr="
+				if metric.Metric == g.NGINX_UP {
+					key = "url="
+				}
+
+				for _, tag := range strings.Split(metric.Tags, ",") {
+					if strings.HasPrefix(tag, key) {
+						if _, ok := services[metric.Metric]; !ok {
+							services[metric.Metric] = make(map[string]string)
+						}
+						services[metric.Metric][strings.TrimSpace(tag[len(key):])] = metric.Tags
+					}
+				}
+				continue
+			}
+
+			if metric.Metric == g.PROMETHEUS_UP {
+				target := &g.PrometheusTarget{Tags: metric.Tags}
+				for _, tag := range strings.Split(metric.Tags, ",") {
+					kv := strings.SplitN(tag, "=", 2)
+					if len(kv) != 2 {
+						continue
+					}
+					switch strings.TrimSpace(kv[0]) {
+					case "url":
+						target.Url = strings.TrimSpace(kv[1])
+					case "prefix":
+						target.Prefix = strings.TrimSpace(kv[1])
+					}
+				}
+				if target.Url != "" {
+					promTargets[metric.Tags] = target
+				}
+				continue
+			}
+
+			if metric.Metric == g.LOG_KEYWORD {
+				file, pattern := parseLogKeyword(metric.Tags)
+				if file == "" || pattern == "" {
 					continue
 				}
-				if _, err := strconv.ParseInt(stime[1], 10, 64); err == nil {
-					urls[url[1]] = stime[1]
-				} else {
-					log.Println("metric ParseInt timeout failed:", err)
+
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					log.Println("metric compile log.keyword pattern failed:", err)
+					continue
 				}
+				logKeywords[metric.Tags] = &g.LogKeyword{File: file, Pattern: re, Tags: metric.Tags}
+				continue
 			}
 
 			if metric.Metric == g.NET_PORT_LISTEN {
@@ -109,6 +167,21 @@ func syncBuiltinMetrics() {
 				continue
 			}
 
+			if metric.Metric == g.NET_PORT_ESTABLISHED || metric.Metric == g.NET_PORT_TIME_WAIT || metric.Metric == g.NET_PORT_ACCEPT_QUEUE {
+				arr := strings.Split(metric.Tags, "=")
+				if len(arr) != 2 {
+					continue
+				}
+
+				if port, err := strconv.ParseInt(strings.TrimSpace(arr[1]), 10, 64); err == nil {
+					connPorts[port] = true
+				} else {
+					log.Println("metrics ParseInt failed:", err)
+				}
+
+				continue
+			}
+
 			if metric.Metric == g.DU_BS {
 				arr := strings.Split(metric.Tags, "=")
 				if len(arr) != 2 {
@@ -137,9 +210,123 @@ func syncBuiltinMetrics() {
 		}
 
 		g.SetReportUrls(urls)
+		g.SetReportConnects(connects)
+		g.SetReportServices(services)
+		g.SetReportPromTargets(promTargets)
+		g.SetReportLogKeywords(logKeywords)
 		g.SetReportPorts(ports)
+		g.SetReportConnPorts(int64Keys(connPorts))
 		g.SetReportProcs(procs)
 		g.SetDuPaths(paths)
 
 	}
 }
+
+// parseLogKeyword reads the file= and pattern= tags, pattern= is the last tag
+// and takes the rest of the string so that the regexp may contain commas
+func parseLogKeyword(tags string) (file string, pattern string) {
+	rest := tags
+	for i := 0; i < len(tags); i++ {
+		if (i == 0 || tags[i-1] == ',') && strings.HasPrefix(tags[i:], "pattern=") {
+			pattern = strings.TrimSpace(tags[i+8:])
+			rest = tags[:i]
+			break
+		}
+	}
+
+	for _, tag := range strings.Split(rest, ",") {
+		if strings.HasPrefix(tag, "file=") {
+			file = strings.TrimSpace(tag[5:])
+		}
+	}
+	return
+}
+
+// tags: url=xx,timeout=xx[,method=GET][,expect=200][,match=xx][,maxBody=102400]
+func parseUrlProbe(tags string) (*g.UrlProbe, error) {
+	probe := &g.UrlProbe{Method: "GET", Expect: 200, MaxBody: g.DefaultUrlMaxBody, Tags: tags}
+
+	for _, tag := range strings.Split(tags, ",") {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("bad tag %s", tag)
+		}
+
+		key, val := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch key {
+		case "url":
+			probe.Url = val
+		case "timeout":
+			timeout, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, err
+			}
+			probe.Timeout = timeout
+		case "method":
+			probe.Method = strings.ToUpper(val)
+		case "expect":
+			expect, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, err
+			}
+			probe.Expect = expect
+		case "match":
+			probe.Match = val
+		case "maxBody":
+			maxBody, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || maxBody <= 0 {
+				return nil, fmt.Errorf("bad maxBody %s", val)
+			}
+			probe.MaxBody = maxBody
+		}
+	}
+
+	if probe.Url == "" || probe.Timeout <= 0 {
+		return nil, fmt.Errorf("url and timeout are required: %s", tags)
+	}
+
+	return probe, nil
+}
+
+func parseConnectProbe(tags string) (*g.ConnectProbe, error) {
+	probe := &g.ConnectProbe{Timeout: 3, Tags: tags}
+
+	for _, tag := range strings.Split(tags, ",") {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("bad tag %s", tag)
+		}
+
+		key, val := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch key {
+		case "host":
+			probe.Host = val
+		case "port":
+			port, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, err
+			}
+			probe.Port = port
+		case "timeout":
+			timeout, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return nil, err
+			}
+			probe.Timeout = timeout
+		}
+	}
+
+	if probe.Host == "" || probe.Port <= 0 || probe.Port > 65535 || probe.Timeout <= 0 {
+		return nil, fmt.Errorf("host and port are required: %s", tags)
+	}
+
+	return probe, nil
+}
+
+func int64Keys(m map[int64]bool) []int64 {
+	keys := make([]int64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,24 @@
+package cron
+
+import (
+	"testing"
+)
+
+func TestParseLogKeyword(t *testing.T) {
+	cases := []struct {
+		tags    string
+		file    string
+		pattern string
+	}{
+		{"file=/var/log/app.log,pattern=error", "/var/log/app.log", "error"},
+		{"file=/var/log/app.log,pattern=error{1,3},timeout", "/var/log/app.log", "error{1,3},timeout"},
+		{"pattern=a,file=b", "", "a,file=b"},
+		{"file=/var/log/app.log,xpattern=a", "/var/log/app.log", ""},
+		{"file=/var/log/app.log", "/var/log/app.log", ""},
+	}
+	for _, c := range cases {
+		if file, pattern := parseLogKeyword(c.tags); file != c.file || pattern != c.pattern {
+			t.Errorf("%s: expect %q %q, but %q %q", c.tags, c.file, c.pattern, file, pattern)
+		}
+	}
+}
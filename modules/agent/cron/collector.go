@@ -15,6 +15,7 @@
 package cron
 
 import (
+	"sync"
 	"time"
 
 	"github.com/open-falcon/falcon-plus/common/model"
@@ -30,7 +31,21 @@ func InitDataHistory() {
 	}
 }
 
+var (
+	collectQuit chan struct{}
+	collectLock = new(sync.Mutex)
+)
+
+// Collect stops the running collectors, if any, and starts them by the current config,
+// so it is called again after the config is reloaded
 func Collect() {
+	collectLock.Lock()
+	defer collectLock.Unlock()
+
+	if collectQuit != nil {
+		close(collectQuit)
+		collectQuit = nil
+	}
 
 	if !g.Config().Transfer.Enabled {
 		return
@@ -40,16 +55,23 @@ func Collect() {
 		return
 	}
 
+	funcs.BuildMappers()
+
+	collectQuit = make(chan struct{})
 	for _, v := range funcs.Mappers {
-		go collect(int64(v.Interval), v.Fs)
+		go collect(int64(v.Interval), v.Fs, collectQuit)
 	}
 }
 
-func collect(sec int64, fns []func() []*model.MetricValue) {
+func collect(sec int64, fns []func() []*model.MetricValue, quit chan struct{}) {
 	t := time.NewTicker(time.Second * time.Duration(sec))
 	defer t.Stop()
 	for {
-		<-t.C
+		select {
+		case <-t.C:
+		case <-quit:
+			return
+		}
 
 		hostname, err := g.Hostname()
 		if err != nil {
@@ -40,12 +40,16 @@ func reportAgentStatus(interval time.Duration) {
 			IP:            g.IP(),
 			AgentVersion:  g.VERSION,
 			PluginVersion: g.GetCurrPluginVersion(),
+			Upgrade:       g.UpgradeStatus(),
 		}
 
-		var resp model.SimpleRpcResponse
+		var resp model.AgentReportResponse
 		err = g.HbsClient.Call("Agent.ReportStatus", req, &resp)
 		if err != nil || resp.Code != 0 {
 			log.Println("call Agent.ReportStatus fail:", err, "Request:", req, "Response:", resp)
+		} else {
+			g.SetLastReport(time.Now().Unix())
+			g.Upgrade(resp.Upgrade)
 		}
 
 		time.Sleep(interval)
@@ -0,0 +1,85 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+)
+
+// CheckUpgrade keeps the new version if it reports to hbs and serves http
+// within upgrade.healthCheck seconds after the restart, or rolls it back
+func CheckUpgrade() {
+	if !g.UpgradeInTrial() {
+		return
+	}
+
+	seconds := g.DefaultUpgradeHealthCheck
+	if cfg := g.Config().Upgrade; cfg != nil && cfg.HealthCheck > 0 {
+		seconds = cfg.HealthCheck
+	}
+	// a failed report is retried after the heartbeat interval
+	if hb := g.Config().Heartbeat; hb.Enabled && seconds < 2*hb.Interval {
+		seconds = 2 * hb.Interval
+	}
+
+	go func() {
+		time.Sleep(time.Duration(seconds) * time.Second)
+		if err := upgradeHealthy(); err != nil {
+			log.Println("health check of the new version fail:", err)
+			g.RollbackUpgrade(err.Error())
+			return
+		}
+		g.ConfirmUpgrade()
+	}()
+}
+
+func upgradeHealthy() error {
+	// any report of this process counts, it may precede CheckUpgrade
+	if g.Config().Heartbeat.Enabled && g.LastReport() == 0 {
+		return fmt.Errorf("no heartbeat since the restart")
+	}
+
+	if !g.Config().Http.Enabled || g.Config().Http.Listen == "" {
+		return nil
+	}
+
+	host, port, err := net.SplitHostPort(g.Config().Http.Listen)
+	if err != nil {
+		return err
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + net.JoinHostPort(host, port) + "/health")
+	if err != nil {
+		return fmt.Errorf("http health check fail: %v", err)
+	}
+	defer resp.Body.Close()
+
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil || string(bs) != "ok" {
+		return fmt.Errorf("http health check fail: %s %s", resp.Status, bs)
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package funcs
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+	"github.com/toolkits/file"
+)
+
+const defaultCgroupRoot = "/sys/fs/cgroup"
+
+// 64 hex characters of docker, containerd or cri-o
+var containerIdRegexp = regexp.MustCompile(`[0-9a-f]{64}`)
+
+func CgroupMetrics() []*model.MetricValue {
+	if g.Config().Collector == nil {
+		return nil
+	}
+
+	cfg := g.Config().Collector.Cgroup
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+
+	root := cfg.Root
+	if root == "" {
+		root = defaultCgroupRoot
+	}
+
+	include, err := compileRegexps(cfg.Include)
+	if err != nil {
+		log.Println("bad cgroup include:", err)
+		return nil
+	}
+	exclude, err := compileRegexps(cfg.Exclude)
+	if err != nil {
+		log.Println("bad cgroup exclude:", err)
+		return nil
+	}
+
+	filter := func(path string) bool {
+		for _, re := range exclude {
+			if re.MatchString(path) {
+				return false
+			}
+		}
+		if len(include) == 0 {
+			return true
+		}
+		for _, re := range include {
+			if re.MatchString(path) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return collectCgroups(root, filter)
+}
+
+func collectCgroups(root string, filter func(string) bool) (L []*model.MetricValue) {
+	unified := file.IsExist(filepath.Join(root, "cgroup.controllers"))
+
+	// the hierarchy of cpuacct is walked for v1, the others share the same paths
+	walkRoot := root
+	if !unified {
+		walkRoot = filepath.Join(root, "cpuacct")
+		if !file.IsExist(walkRoot) {
+			walkRoot = filepath.Join(root, "cpu,cpuacct")
+		}
+	}
+
+	// cpuacct is usually a symlink to cpu,cpuacct
+	walkRoot, err := filepath.EvalSymlinks(walkRoot)
+	if err != nil {
+		log.Println("cgroup hierarchy not found:", err)
+		return
+	}
+
+	err = filepath.Walk(walkRoot, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() || fpath == walkRoot {
+			return nil
+		}
+
+		rel := strings.TrimPrefix(fpath, walkRoot)
+		if !filter(rel) {
+			return nil
+		}
+
+		tags := []string{"cgroup=" + utils.SanitizeTag(rel)}
+		if id := containerIdRegexp.FindString(rel); id != "" {
+			tags = append(tags, "container="+id[:12])
+		}
+
+		if unified {
+			L = append(L, cgroupV2Metrics(fpath, tags)...)
+		} else {
+			L = append(L, cgroupV1Metrics(root, rel, tags)...)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("walk", walkRoot, "fail:", err)
+	}
+
+	return
+}
+
+func cgroupV2Metrics(dir string, tags []string) (L []*model.MetricValue) {
+	if cpu, err := readCgroupKV(filepath.Join(dir, "cpu.stat")); err == nil {
+		L = append(L, CounterValue("cgroup.cpu.usage", float64(cpu["usage_usec"])/1e6, tags...))
+		L = append(L, CounterValue("cgroup.cpu.user", float64(cpu["user_usec"])/1e6, tags...))
+		L = append(L, CounterValue("cgroup.cpu.system", float64(cpu["system_usec"])/1e6, tags...))
+		if _, ok := cpu["nr_periods"]; ok {
+			L = append(L, CounterValue("cgroup.cpu.periods", cpu["nr_periods"], tags...))
+			L = append(L, CounterValue("cgroup.cpu.throttled.periods", cpu["nr_throttled"], tags...))
+			L = append(L, CounterValue("cgroup.cpu.throttled.time", float64(cpu["throttled_usec"])/1e6, tags...))
+		}
+	}
+
+	if usage, err := readCgroupUint(filepath.Join(dir, "memory.current")); err == nil {
+		L = append(L, GaugeValue("cgroup.mem.usage", usage, tags...))
+	}
+	if limit, err := readCgroupUint(filepath.Join(dir, "memory.max")); err == nil {
+		L = append(L, GaugeValue("cgroup.mem.limit", limit, tags...))
+	}
+	if mem, err := readCgroupKV(filepath.Join(dir, "memory.stat")); err == nil {
+		L = append(L, GaugeValue("cgroup.mem.rss", mem["anon"], tags...))
+		L = append(L, GaugeValue("cgroup.mem.cache", mem["file"], tags...))
+	}
+	if events, err := readCgroupKV(filepath.Join(dir, "memory.events")); err == nil {
+		L = append(L, CounterValue("cgroup.mem.oom.kill", events["oom_kill"], tags...))
+	}
+
+	// 8:0 rbytes=1024 wbytes=0 rios=1 wios=0 dbytes=0 dios=0
+	if lines, err := readCgroupLines(filepath.Join(dir, "io.stat")); err == nil {
+		io := make(map[string]uint64)
+		for _, line := range lines {
+			for _, field := range strings.Fields(line)[1:] {
+				kv := strings.SplitN(field, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				if v, err := strconv.ParseUint(kv[1], 10, 64); err == nil {
+					io[kv[0]] += v
+				}
+			}
+		}
+		L = append(L, cgroupIOMetrics(io["rbytes"], io["wbytes"], io["rios"], io["wios"], tags)...)
+	}
+
+	if pids, err := readCgroupUint(filepath.Join(dir, "pids.current")); err == nil {
+		L = append(L, GaugeValue("cgroup.pids", pids, tags...))
+	}
+
+	return
+}
+
+func cgroupV1Metrics(root string, rel string, tags []string) (L []*model.MetricValue) {
+	controller := func(names ...string) string {
+		for _, name := range names {
+			dir := filepath.Join(root, name, rel)
+			if file.IsExist(dir) {
+				return dir
+			}
+		}
+		return ""
+	}
+
+	if dir := controller("cpuacct", "cpu,cpuacct"); dir != "" {
+		if usage, err := readCgroupUint(filepath.Join(dir, "cpuacct.usage")); err == nil {
+			L = append(L, CounterValue("cgroup.cpu.usage", float64(usage)/1e9, tags...))
+		}
+		// USER_HZ
+		if cpu, err := readCgroupKV(filepath.Join(dir, "cpuacct.stat")); err == nil {
+			L = append(L, CounterValue("cgroup.cpu.user", float64(cpu["user"])/100, tags...))
+			L = append(L, CounterValue("cgroup.cpu.system", float64(cpu["system"])/100, tags...))
+		}
+	}
+
+	if dir := controller("cpu", "cpu,cpuacct"); dir != "" {
+		if cpu, err := readCgroupKV(filepath.Join(dir, "cpu.stat")); err == nil {
+			L = append(L, CounterValue("cgroup.cpu.periods", cpu["nr_periods"], tags...))
+			L = append(L, CounterValue("cgroup.cpu.throttled.periods", cpu["nr_throttled"], tags...))
+			L = append(L, CounterValue("cgroup.cpu.throttled.time", float64(cpu["throttled_time"])/1e9, tags...))
+		}
+	}
+
+	if dir := controller("memory"); dir != "" {
+		if usage, err := readCgroupUint(filepath.Join(dir, "memory.usage_in_bytes")); err == nil {
+			L = append(L, GaugeValue("cgroup.mem.usage", usage, tags...))
+		}
+		// unlimited is reported as a huge number aligned to the page size
+		if limit, err := readCgroupUint(filepath.Join(dir, "memory.limit_in_bytes")); err == nil && limit < 1<<62 {
+			L = append(L, GaugeValue("cgroup.mem.limit", limit, tags...))
+		}
+		if mem, err := readCgroupKV(filepath.Join(dir, "memory.stat")); err == nil {
+			L = append(L, GaugeValue("cgroup.mem.rss", mem["rss"], tags...))
+			L = append(L, GaugeValue("cgroup.mem.cache", mem["cache"], tags...))
+		}
+		if oom, err := readCgroupKV(filepath.Join(dir, "memory.oom_control")); err == nil {
+			if v, ok := oom["oom_kill"]; ok {
+				L = append(L, CounterValue("cgroup.mem.oom.kill", v, tags...))
+			}
+		}
+	}
+
+	if dir := controller("blkio"); dir != "" {
+		// 8:0 Read 1024
+		sum := func(name string) (read, write uint64, err error) {
+			lines, err := readCgroupLines(filepath.Join(dir, name))
+			if err != nil {
+				return
+			}
+			for _, line := range lines {
+				fields := strings.Fields(line)
+				if len(fields) != 3 {
+					continue
+				}
+				v, err := strconv.ParseUint(fields[2], 10, 64)
+				if err != nil {
+					continue
+				}
+				if fields[1] == "Read" {
+					read += v
+				} else if fields[1] == "Write" {
+					write += v
+				}
+			}
+			return
+		}
+
+		rbytes, wbytes, err1 := sum("blkio.throttle.io_service_bytes")
+		rios, wios, err2 := sum("blkio.throttle.io_serviced")
+		if err1 == nil && err2 == nil {
+			L = append(L, cgroupIOMetrics(rbytes, wbytes, rios, wios, tags)...)
+		}
+	}
+
+	if dir := controller("pids"); dir != "" {
+		if pids, err := readCgroupUint(filepath.Join(dir, "pids.current")); err == nil {
+			L = append(L, GaugeValue("cgroup.pids", pids, tags...))
+		}
+	}
+
+	return
+}
+
+func cgroupIOMetrics(rbytes, wbytes, rios, wios uint64, tags []string) []*model.MetricValue {
+	return []*model.MetricValue{
+		CounterValue("cgroup.io.read.bytes", rbytes, tags...),
+		CounterValue("cgroup.io.write.bytes", wbytes, tags...),
+		CounterValue("cgroup.io.read.ops", rios, tags...),
+		CounterValue("cgroup.io.write.ops", wios, tags...),
+	}
+}
+
+func compileRegexps(patterns []string) ([]*regexp.Regexp, error) {
+	ret := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, re)
+	}
+	return ret, nil
+}
+
+// 'max' of cgroup v2 is an error, there is no limit
+func readCgroupUint(fpath string) (uint64, error) {
+	s, err := file.ToTrimString(fpath)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+func readCgroupKV(fpath string) (map[string]uint64, error) {
+	lines, err := readCgroupLines(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]uint64)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			ret[fields[0]] = v
+		}
+	}
+	return ret, nil
+}
+
+func readCgroupLines(fpath string) ([]string, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
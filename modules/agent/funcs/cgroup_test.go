@@ -0,0 +1,126 @@
+package funcs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+const testContainerId = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func writeCgroupFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		fpath := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func cgroupMetricStrings(root string, filter func(string) bool) []string {
+	ret := []string{}
+	for _, mv := range collectCgroups(root, filter) {
+		ret = append(ret, fmt.Sprintf("%s/%s/%s=%v", mv.Type, mv.Tags, mv.Metric, mv.Value))
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func TestCgroupV2Metrics(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	app := "system.slice/docker-" + testContainerId + ".scope"
+	writeCgroupFiles(t, root, map[string]string{
+		"cgroup.controllers":        "cpu io memory pids",
+		"cpu.stat":                  "usage_usec 1",
+		app + "/cpu.stat":           "usage_usec 2000000\nuser_usec 1500000\nsystem_usec 500000\nnr_periods 10\nnr_throttled 2\nthrottled_usec 300000",
+		app + "/memory.current":     "4096",
+		app + "/memory.max":         "max",
+		app + "/memory.stat":        "anon 1024\nfile 2048\n",
+		app + "/memory.events":      "oom 0\noom_kill 1",
+		app + "/io.stat":            "8:0 rbytes=100 wbytes=200 rios=1 wios=2\n8:16 rbytes=1 wbytes=2 rios=3 wios=4",
+		app + "/pids.current":       "7",
+		"user.slice/memory.current": "1",
+	})
+
+	got := cgroupMetricStrings(root, func(path string) bool { return path != "/system.slice" && path != "/user.slice" })
+	tags := "cgroup=/" + app + ",container=" + testContainerId[:12]
+	expect := []string{
+		"COUNTER/" + tags + "/cgroup.cpu.periods=10",
+		"COUNTER/" + tags + "/cgroup.cpu.system=0.5",
+		"COUNTER/" + tags + "/cgroup.cpu.throttled.periods=2",
+		"COUNTER/" + tags + "/cgroup.cpu.throttled.time=0.3",
+		"COUNTER/" + tags + "/cgroup.cpu.usage=2",
+		"COUNTER/" + tags + "/cgroup.cpu.user=1.5",
+		"COUNTER/" + tags + "/cgroup.io.read.bytes=101",
+		"COUNTER/" + tags + "/cgroup.io.read.ops=4",
+		"COUNTER/" + tags + "/cgroup.io.write.bytes=202",
+		"COUNTER/" + tags + "/cgroup.io.write.ops=6",
+		"COUNTER/" + tags + "/cgroup.mem.oom.kill=1",
+		"GAUGE/" + tags + "/cgroup.mem.cache=2048",
+		"GAUGE/" + tags + "/cgroup.mem.rss=1024",
+		"GAUGE/" + tags + "/cgroup.mem.usage=4096",
+		"GAUGE/" + tags + "/cgroup.pids=7",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expect) {
+		t.Errorf("expect %v\nbut %v", expect, got)
+	}
+}
+
+func TestCgroupV1Metrics(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeCgroupFiles(t, root, map[string]string{
+		"cpu,cpuacct/app/cpuacct.usage":                  "3000000000",
+		"cpu,cpuacct/app/cpuacct.stat":                   "user 200\nsystem 100",
+		"cpu,cpuacct/app/cpu.stat":                       "nr_periods 5\nnr_throttled 1\nthrottled_time 2000000000",
+		"memory/app/memory.usage_in_bytes":               "4096",
+		"memory/app/memory.limit_in_bytes":               "9223372036854771712",
+		"memory/app/memory.stat":                         "cache 10\nrss 20\ntotal_rss 20",
+		"blkio/app/blkio.throttle.io_service_bytes":      "8:0 Read 100\n8:0 Write 50\n8:0 Total 150\nTotal 150",
+		"blkio/app/blkio.throttle.io_serviced":           "8:0 Read 1\n8:0 Write 2\n8:0 Total 3\nTotal 3",
+		"pids/app/pids.current":                          "3",
+		"cpu,cpuacct/excluded/cpuacct.usage":             "1",
+		"memory/excluded/memory.usage_in_bytes":          "1",
+		"blkio/excluded/blkio.throttle.io_serviced":      "",
+		"blkio/excluded/blkio.throttle.io_service_bytes": "",
+	})
+	if err := os.Symlink(filepath.Join(root, "cpu,cpuacct"), filepath.Join(root, "cpuacct")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := cgroupMetricStrings(root, func(path string) bool { return path == "/app" })
+	expect := []string{
+		"COUNTER/cgroup=/app/cgroup.cpu.periods=5",
+		"COUNTER/cgroup=/app/cgroup.cpu.system=1",
+		"COUNTER/cgroup=/app/cgroup.cpu.throttled.periods=1",
+		"COUNTER/cgroup=/app/cgroup.cpu.throttled.time=2",
+		"COUNTER/cgroup=/app/cgroup.cpu.usage=3",
+		"COUNTER/cgroup=/app/cgroup.cpu.user=2",
+		"COUNTER/cgroup=/app/cgroup.io.read.bytes=100",
+		"COUNTER/cgroup=/app/cgroup.io.read.ops=1",
+		"COUNTER/cgroup=/app/cgroup.io.write.bytes=50",
+		"COUNTER/cgroup=/app/cgroup.io.write.ops=2",
+		"GAUGE/cgroup=/app/cgroup.mem.cache=10",
+		"GAUGE/cgroup=/app/cgroup.mem.rss=20",
+		"GAUGE/cgroup=/app/cgroup.mem.usage=4096",
+		"GAUGE/cgroup=/app/cgroup.pids=3",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expect) {
+		t.Errorf("expect %v\nbut %v", expect, got)
+	}
+}
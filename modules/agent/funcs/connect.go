@@ -0,0 +1,78 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package funcs
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+)
+
+// ConnectMetrics dials the net.port.connect targets concurrently like UrlMetrics
+func ConnectMetrics() (L []*model.MetricValue) {
+	reportConnects := g.ReportConnects()
+	sz := len(reportConnects)
+	if sz == 0 {
+		return
+	}
+	hostname, err := g.Hostname()
+	if err != nil {
+		hostname = "None"
+	}
+
+	result := make(chan []*model.MetricValue, sz)
+	var wg sync.WaitGroup
+
+	for _, probe := range reportConnects {
+		wg.Add(1)
+		go func(probe *g.ConnectProbe) {
+			defer wg.Done()
+			tags := fmt.Sprintf("%s,src=%s", probe.Tags, hostname)
+			result <- connectProbeMetrics(probe, tags)
+		}(probe)
+	}
+	wg.Wait()
+
+	for i := 0; i < sz; i++ {
+		L = append(L, <-result...)
+	}
+	return
+}
+
+// net.port.connect is 1 if connected, net.port.connect.time is in milliseconds and only reported then
+func connectProbeMetrics(probe *g.ConnectProbe, tags string) []*model.MetricValue {
+	addr := net.JoinHostPort(probe.Host, strconv.Itoa(probe.Port))
+	timeout := time.Duration(probe.Timeout * float64(time.Second))
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		log.Printf("connect [%s] failed: %v\n", addr, err)
+		return []*model.MetricValue{GaugeValue(g.NET_PORT_CONNECT, 0, tags)}
+	}
+	elapsed := time.Since(start)
+	conn.Close()
+
+	return []*model.MetricValue{
+		GaugeValue(g.NET_PORT_CONNECT, 1, tags),
+		GaugeValue(g.NET_PORT_CONNECT+".time", float64(elapsed)/float64(time.Millisecond), tags),
+	}
+}
@@ -0,0 +1,30 @@
+package funcs
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+)
+
+func TestConnectProbeMetrics(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+
+	probe := &g.ConnectProbe{Host: "127.0.0.1", Port: port, Timeout: 1}
+	L := connectProbeMetrics(probe, "port="+strconv.Itoa(port))
+	if len(L) != 2 || L[0].Value != 1 || L[1].Metric != "net.port.connect.time" {
+		t.Errorf("unexpected %v", L)
+	}
+
+	l.Close()
+	L = connectProbeMetrics(probe, "port="+strconv.Itoa(port))
+	if len(L) != 1 || fmt.Sprint(L[0].Value) != "0" {
+		t.Errorf("unexpected %v", L)
+	}
+}
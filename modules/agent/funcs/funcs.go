@@ -15,6 +15,9 @@
 package funcs
 
 import (
+	"log"
+	"sort"
+
 	"github.com/open-falcon/falcon-plus/common/model"
 	"github.com/open-falcon/falcon-plus/modules/agent/g"
 )
@@ -24,57 +27,97 @@ type FuncsAndInterval struct {
 	Interval int
 }
 
+// Collector is switched on or off and scheduled by its name in the collectors config,
+// the collectors of the same group and interval run in one goroutine
+type Collector struct {
+	Name  string
+	Group string
+	Fn    func() []*model.MetricValue
+}
+
+var Collectors = []Collector{
+	{"agent", "base", AgentMetrics},
+	{"cpu", "base", CpuMetrics},
+	{"net", "base", NetMetrics},
+	{"kernel", "base", KernelMetrics},
+	{"loadavg", "base", LoadAvgMetrics},
+	{"mem", "base", MemMetrics},
+	{"diskio", "base", DiskIOMetrics},
+	{"iostat", "base", IOStatsMetrics},
+	{"netstat", "base", NetstatMetrics},
+	{"proc", "base", ProcMetrics},
+	{"udp", "base", UdpMetrics},
+	{"df", "df", DeviceMetrics},
+	{"port", "port", PortMetrics},
+	{"ss", "port", SocketStatSummaryMetrics},
+	{"tcpstate", "port", TcpStateMetrics},
+	{"du", "du", DuMetrics},
+	{"url", "url", UrlMetrics},
+	{"connect", "url", ConnectMetrics},
+	{"gpu", "gpu", GpuMetrics},
+	{"cgroup", "cgroup", CgroupMetrics},
+	{"logkeyword", "logkeyword", LogKeywordMetrics},
+	{"prometheus", "prometheus", PrometheusMetrics},
+	{"redis", "redis", RedisMetrics},
+	{"mysql", "mysql", MysqlMetrics},
+	{"nginx", "nginx", NginxMetrics},
+}
+
 var Mappers []FuncsAndInterval
 
 func BuildMappers() {
 	interval := g.Config().Transfer.Interval
-	Mappers = []FuncsAndInterval{
-		{
-			Fs: []func() []*model.MetricValue{
-				AgentMetrics,
-				CpuMetrics,
-				NetMetrics,
-				KernelMetrics,
-				LoadAvgMetrics,
-				MemMetrics,
-				DiskIOMetrics,
-				IOStatsMetrics,
-				NetstatMetrics,
-				ProcMetrics,
-				UdpMetrics,
-			},
-			Interval: interval,
-		},
-		{
-			Fs: []func() []*model.MetricValue{
-				DeviceMetrics,
-			},
-			Interval: interval,
-		},
-		{
-			Fs: []func() []*model.MetricValue{
-				PortMetrics,
-				SocketStatSummaryMetrics,
-			},
-			Interval: interval,
-		},
-		{
-			Fs: []func() []*model.MetricValue{
-				DuMetrics,
-			},
-			Interval: interval,
-		},
-		{
-			Fs: []func() []*model.MetricValue{
-				UrlMetrics,
-			},
-			Interval: interval,
-		},
-		{
-			Fs: []func() []*model.MetricValue{
-				GpuMetrics,
-			},
-			Interval: interval,
-		},
+	switches := g.Config().Collectors
+
+	type groupKey struct {
+		Group    string
+		Interval int
+	}
+
+	for _, name := range unknownCollectors(switches) {
+		log.Println("unknown collector", name, "in collectors, ignored")
+	}
+
+	index := make(map[groupKey]int)
+	mappers := []FuncsAndInterval{}
+
+	for _, c := range Collectors {
+		sec := interval
+		if s, ok := switches[c.Name]; ok && s != nil {
+			if s.Enabled != nil && !*s.Enabled {
+				continue
+			}
+			if s.Interval > 0 {
+				sec = s.Interval
+			}
+		}
+
+		key := groupKey{c.Group, sec}
+		i, ok := index[key]
+		if !ok {
+			i = len(mappers)
+			index[key] = i
+			mappers = append(mappers, FuncsAndInterval{Interval: sec})
+		}
+		mappers[i].Fs = append(mappers[i].Fs, c.Fn)
+	}
+
+	Mappers = mappers
+}
+
+// unknownCollectors returns the names configured but matching no collector, e.g. a typo
+func unknownCollectors(switches map[string]*g.CollectorSwitch) []string {
+	known := make(map[string]bool, len(Collectors))
+	for _, c := range Collectors {
+		known[c.Name] = true
+	}
+
+	names := []string{}
+	for name := range switches {
+		if !known[name] {
+			names = append(names, name)
+		}
 	}
+	sort.Strings(names)
+	return names
 }
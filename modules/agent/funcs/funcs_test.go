@@ -0,0 +1,49 @@
+package funcs
+
+import (
+	"fmt"
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestBuildMappers(t *testing.T) {
+	f, err := ioutil.TempFile("", "cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(`{
+		"transfer": {"interval": 60},
+		"collectors": {
+			"gpu": {"enabled": false},
+			"udp": {"enabled": false},
+			"du": {"interval": 600},
+			"ss": {"enabled": true, "interval": 10},
+			"diskoi": {"enabled": false}
+		}
+	}`)
+	f.Close()
+	g.ParseConfig(f.Name())
+
+	BuildMappers()
+
+	fns, intervals := 0, map[int]int{}
+	for _, m := range Mappers {
+		fns += len(m.Fs)
+		intervals[m.Interval] += len(m.Fs)
+	}
+
+	if fns != len(Collectors)-2 {
+		t.Errorf("expect %d collectors enabled, but %d", len(Collectors)-2, fns)
+	}
+	if intervals[600] != 1 || intervals[10] != 1 || intervals[60] != fns-2 {
+		t.Errorf("unexpected intervals: %v", intervals)
+	}
+
+	if names := unknownCollectors(g.Config().Collectors); fmt.Sprint(names) != "[diskoi]" {
+		t.Errorf("expect diskoi unknown, but %v", names)
+	}
+}
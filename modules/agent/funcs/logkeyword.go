@@ -0,0 +1,208 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package funcs
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+)
+
+// a longer line is cut, the rest of it is dropped
+const maxLogLineSize = 64 << 10
+
+// logTailer follows one file across rotation and truncation
+type logTailer struct {
+	path    string
+	fd      *os.File
+	reader  *bufio.Reader
+	offset  int64
+	partial string
+	// the first open starts at the end, the history is not counted
+	tried bool
+}
+
+var (
+	// file => *logTailer
+	logTailers     = make(map[string]*logTailer)
+	logTailersLock = new(sync.Mutex)
+)
+
+func LogKeywordMetrics() (L []*model.MetricValue) {
+	keywords := g.ReportLogKeywords()
+
+	logTailersLock.Lock()
+	defer logTailersLock.Unlock()
+
+	byFile := make(map[string][]*g.LogKeyword)
+	for _, k := range keywords {
+		byFile[k.File] = append(byFile[k.File], k)
+	}
+
+	for path, t := range logTailers {
+		if _, ok := byFile[path]; !ok {
+			t.close()
+			delete(logTailers, path)
+		}
+	}
+
+	if len(byFile) == 0 {
+		return
+	}
+
+	sample := g.Config().Collector != nil && g.Config().Collector.LogKeywordSample
+
+	for path, ks := range byFile {
+		t, ok := logTailers[path]
+		if !ok {
+			t = &logTailer{path: path}
+			logTailers[path] = t
+		}
+
+		counts := make([]int, len(ks))
+		err := t.lines(func(line string) {
+			for i, k := range ks {
+				if !k.Pattern.MatchString(line) {
+					continue
+				}
+				if counts[i] == 0 && sample {
+					log.Printf("log.keyword %s matched: %s", k.Tags, line)
+				}
+				counts[i]++
+			}
+		})
+		if err != nil {
+			log.Println("tail", path, "fail:", err)
+		}
+
+		for i, k := range ks {
+			L = append(L, GaugeValue(g.LOG_KEYWORD, counts[i], k.Tags))
+		}
+	}
+
+	return
+}
+
+// lines calls fn for every complete line appended since the last call
+func (this *logTailer) lines(fn func(string)) error {
+	if this.fd == nil {
+		fromEnd := !this.tried
+		this.tried = true
+		if err := this.open(fromEnd); err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	// the rest of the current file, it may have been rotated already
+	if err := this.readAll(fn); err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(this.path)
+	if err != nil {
+		// moved away and not recreated yet
+		return nil
+	}
+
+	curr, err := this.fd.Stat()
+	if err != nil || !os.SameFile(fi, curr) {
+		// rotated
+		if this.partial != "" {
+			fn(this.partial)
+		}
+		this.close()
+		if err := this.open(false); err != nil {
+			return err
+		}
+		return this.readAll(fn)
+	}
+
+	if fi.Size() < this.offset {
+		// truncated
+		if _, err := this.fd.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		this.offset = 0
+		this.partial = ""
+		this.reader.Reset(this.fd)
+		return this.readAll(fn)
+	}
+
+	return nil
+}
+
+func (this *logTailer) open(fromEnd bool) error {
+	fd, err := os.Open(this.path)
+	if err != nil {
+		return err
+	}
+
+	this.offset = 0
+	if fromEnd {
+		if this.offset, err = fd.Seek(0, io.SeekEnd); err != nil {
+			fd.Close()
+			return err
+		}
+	}
+
+	this.fd = fd
+	this.reader = bufio.NewReader(fd)
+	this.partial = ""
+	return nil
+}
+
+func (this *logTailer) readAll(fn func(string)) error {
+	for {
+		buf, err := this.reader.ReadSlice('\n')
+		this.offset += int64(len(buf))
+		this.appendPartial(buf)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			// an incomplete line is kept until the newline is written
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		fn(strings.TrimRight(this.partial, "\r\n"))
+		this.partial = ""
+	}
+}
+
+func (this *logTailer) appendPartial(buf []byte) {
+	if n := maxLogLineSize - len(this.partial); len(buf) > n {
+		buf = buf[:n]
+	}
+	this.partial += string(buf)
+}
+
+func (this *logTailer) close() {
+	if this.fd != nil {
+		this.fd.Close()
+		this.fd = nil
+	}
+}
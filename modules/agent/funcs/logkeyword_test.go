@@ -0,0 +1,83 @@
+package funcs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogTailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logkeyword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	appendLog(t, path, "old line\n")
+
+	tailer := &logTailer{path: path}
+	defer tailer.close()
+
+	collect := func() []string {
+		lines := []string{}
+		if err := tailer.lines(func(line string) { lines = append(lines, line) }); err != nil {
+			t.Fatal(err)
+		}
+		return lines
+	}
+
+	// the history is skipped
+	if lines := collect(); len(lines) != 0 {
+		t.Errorf("expect no lines, but %v", lines)
+	}
+
+	appendLog(t, path, "a\nb\npart")
+	if lines := collect(); len(lines) != 2 || lines[0] != "a" || lines[1] != "b" {
+		t.Errorf("expect [a b], but %v", lines)
+	}
+
+	// rotated: the rest of the old file and the new file are both read
+	appendLog(t, path, "ial\nc\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLog(t, path, "d\n")
+	if lines := collect(); len(lines) != 3 || lines[0] != "partial" || lines[1] != "c" || lines[2] != "d" {
+		t.Errorf("expect [partial c d], but %v", lines)
+	}
+
+	// truncated, shorter than the offset
+	appendLog(t, path, "a longer line\n")
+	collect()
+	if err := ioutil.WriteFile(path, []byte("e\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if lines := collect(); len(lines) != 1 || lines[0] != "e" {
+		t.Errorf("expect [e], but %v", lines)
+	}
+
+	// a long line without a newline yet is cut, the rest is dropped
+	long := strings.Repeat("x", maxLogLineSize)
+	appendLog(t, path, long)
+	if lines := collect(); len(lines) != 0 || len(tailer.partial) != maxLogLineSize {
+		t.Errorf("expect the partial line kept, but %v, %d", lines, len(tailer.partial))
+	}
+	appendLog(t, path, long+"\nf\n")
+	if lines := collect(); len(lines) != 2 || lines[0] != long || lines[1] != "f" {
+		t.Errorf("expect the long line cut and f, but %d lines", len(lines))
+	}
+}
+
+func appendLog(t *testing.T, path string, s string) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
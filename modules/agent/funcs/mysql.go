@@ -0,0 +1,151 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package funcs
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+)
+
+// the SHOW GLOBAL STATUS variables reported as mysql.$lowercase_name, the others are left out
+var mysqlStatusTypes = map[string]string{
+	"Uptime":                           "GAUGE",
+	"Threads_connected":                "GAUGE",
+	"Threads_running":                  "GAUGE",
+	"Threads_cached":                   "GAUGE",
+	"Max_used_connections":             "GAUGE",
+	"Open_files":                       "GAUGE",
+	"Open_tables":                      "GAUGE",
+	"Innodb_buffer_pool_pages_total":   "GAUGE",
+	"Innodb_buffer_pool_pages_free":    "GAUGE",
+	"Innodb_buffer_pool_pages_dirty":   "GAUGE",
+	"Innodb_row_lock_current_waits":    "GAUGE",
+	"Questions":                        "COUNTER",
+	"Queries":                          "COUNTER",
+	"Slow_queries":                     "COUNTER",
+	"Com_select":                       "COUNTER",
+	"Com_insert":                       "COUNTER",
+	"Com_update":                       "COUNTER",
+	"Com_delete":                       "COUNTER",
+	"Com_replace":                      "COUNTER",
+	"Com_commit":                       "COUNTER",
+	"Com_rollback":                     "COUNTER",
+	"Connections":                      "COUNTER",
+	"Aborted_clients":                  "COUNTER",
+	"Aborted_connects":                 "COUNTER",
+	"Bytes_received":                   "COUNTER",
+	"Bytes_sent":                       "COUNTER",
+	"Created_tmp_tables":               "COUNTER",
+	"Created_tmp_disk_tables":          "COUNTER",
+	"Select_full_join":                 "COUNTER",
+	"Select_scan":                      "COUNTER",
+	"Sort_merge_passes":                "COUNTER",
+	"Table_locks_waited":               "COUNTER",
+	"Innodb_buffer_pool_read_requests": "COUNTER",
+	"Innodb_buffer_pool_reads":         "COUNTER",
+	"Innodb_data_reads":                "COUNTER",
+	"Innodb_data_writes":               "COUNTER",
+	"Innodb_rows_read":                 "COUNTER",
+	"Innodb_rows_inserted":             "COUNTER",
+	"Innodb_rows_updated":              "COUNTER",
+	"Innodb_rows_deleted":              "COUNTER",
+	"Innodb_row_lock_waits":            "COUNTER",
+	"Innodb_row_lock_time":             "COUNTER",
+}
+
+func MysqlMetrics() (L []*model.MetricValue) {
+	var user, password string
+	var addrs []string
+	if cfg := g.Config().Services; cfg != nil && cfg.Mysql != nil {
+		user, password = cfg.Mysql.User, cfg.Mysql.Password
+		addrs = cfg.Mysql.Addrs
+	}
+
+	targets := serviceTargets(g.MYSQL_UP, "addr", addrs)
+	if len(targets) == 0 {
+		return
+	}
+
+	timeout := serviceTimeout()
+	return collectServices(targets, func(addr, tags string) []*model.MetricValue {
+		status, err := mysqlGlobalStatus(mysqlDSN(user, password, addr, timeout))
+		if err != nil {
+			log.Println("mysql", addr, "SHOW GLOBAL STATUS fail:", err)
+			return []*model.MetricValue{GaugeValue(g.MYSQL_UP, 0, tags)}
+		}
+
+		return append(mysqlStatusMetrics(status, tags), GaugeValue(g.MYSQL_UP, 1, tags))
+	})
+}
+
+// the password may have any of @/?
+func mysqlDSN(user, password, addr string, timeout time.Duration) string {
+	cfg := &mysql.Config{
+		User:        user,
+		Passwd:      password,
+		Net:         "tcp",
+		Addr:        addr,
+		Timeout:     timeout,
+		ReadTimeout: timeout,
+	}
+	return cfg.FormatDSN()
+}
+
+func mysqlGlobalStatus(dsn string) (map[string]string, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SHOW GLOBAL STATUS")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	status := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		status[name] = value
+	}
+	return status, rows.Err()
+}
+
+func mysqlStatusMetrics(status map[string]string, tags string) (L []*model.MetricValue) {
+	for name, value := range status {
+		dataType, ok := mysqlStatusTypes[name]
+		if !ok {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		L = append(L, NewMetricValue("mysql."+strings.ToLower(name), v, dataType, tags))
+	}
+	return
+}
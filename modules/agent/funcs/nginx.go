@@ -0,0 +1,95 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package funcs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+)
+
+func NginxMetrics() (L []*model.MetricValue) {
+	var urls []string
+	if cfg := g.Config().Services; cfg != nil && cfg.Nginx != nil {
+		urls = cfg.Nginx.Urls
+	}
+
+	targets := serviceTargets(g.NGINX_UP, "url", urls)
+	if len(targets) == 0 {
+		return
+	}
+
+	client := &http.Client{Timeout: serviceTimeout()}
+	return collectServices(targets, func(url, tags string) []*model.MetricValue {
+		L, err := nginxStatus(client, url, tags)
+		if err != nil {
+			log.Println("nginx", url, "stub_status fail:", err)
+			return []*model.MetricValue{GaugeValue(g.NGINX_UP, 0, tags)}
+		}
+		return append(L, GaugeValue(g.NGINX_UP, 1, tags))
+	})
+}
+
+func nginxStatus(client *http.Client, url, tags string) ([]*model.MetricValue, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseNginxStatus(string(body), tags)
+}
+
+// 'Active connections: 291 server accepts handled requests 16630948 16630948 31070465
+// Reading: 6 Writing: 179 Waiting: 106' in 4 lines
+func parseNginxStatus(body string, tags string) ([]*model.MetricValue, error) {
+	fields := strings.Fields(body)
+	if len(fields) != 16 || fields[0] != "Active" {
+		return nil, fmt.Errorf("bad stub_status: %q", body)
+	}
+
+	values := make([]uint64, 0, 7)
+	for _, i := range []int{2, 7, 8, 9, 11, 13, 15} {
+		v, err := strconv.ParseUint(fields[i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad stub_status: %q", body)
+		}
+		values = append(values, v)
+	}
+
+	return []*model.MetricValue{
+		GaugeValue("nginx.active", values[0], tags),
+		CounterValue("nginx.accepts", values[1], tags),
+		CounterValue("nginx.handled", values[2], tags),
+		CounterValue("nginx.requests", values[3], tags),
+		GaugeValue("nginx.reading", values[4], tags),
+		GaugeValue("nginx.writing", values[5], tags),
+		GaugeValue("nginx.waiting", values[6], tags),
+	}, nil
+}
@@ -38,15 +38,18 @@ func ProcMetrics() (L []*model.MetricValue) {
 
 	pslen := len(ps)
 
+	forgetProcSamples(reportProcs)
+
 	for tags, m := range reportProcs {
-		cnt := 0
+		pids := []int{}
 		for i := 0; i < pslen; i++ {
 			if is_a(ps[i], m) {
-				cnt++
+				pids = append(pids, ps[i].Pid)
 			}
 		}
 
-		L = append(L, GaugeValue(g.PROC_NUM, cnt, tags))
+		L = append(L, GaugeValue(g.PROC_NUM, len(pids), tags))
+		L = append(L, procResourceMetrics(tags, pids)...)
 	}
 
 	return
@@ -0,0 +1,242 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package funcs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/toolkits/file"
+)
+
+// USER_HZ of /proc/[pid]/stat
+const clockTicks = 100
+
+var procRoot = "/proc"
+
+type procStat struct {
+	CpuTicks   uint64 // utime + stime
+	Threads    uint64
+	StartTime  uint64 // clock ticks after boot
+	Vms        uint64
+	Rss        uint64
+	Fds        uint64
+	ReadBytes  uint64
+	WriteBytes uint64
+}
+
+type procSample struct {
+	Stats map[int]*procStat
+	At    time.Time
+}
+
+// per second of the pids alive in both samples, a pid exited or started is left out
+type procRate struct {
+	CpuPercent float64
+	ReadBytes  float64
+	WriteBytes float64
+}
+
+var (
+	// proc.num tags => the stats of the matched pids last time
+	procSamples     = make(map[string]*procSample)
+	procSamplesLock = new(sync.Mutex)
+)
+
+// procResourceMetrics aggregates the resource usage of the pids matched by one proc.num rule
+func procResourceMetrics(tags string, pids []int) (L []*model.MetricValue) {
+	uptime, err := systemUptime()
+	if err != nil {
+		return
+	}
+
+	var sum procStat
+	var maxUptime float64
+	stats := make(map[int]*procStat, len(pids))
+	for _, pid := range pids {
+		st, err := readProcStat(pid)
+		if err != nil {
+			// exited
+			continue
+		}
+
+		stats[pid] = st
+		sum.Threads += st.Threads
+		sum.Vms += st.Vms
+		sum.Rss += st.Rss
+		sum.Fds += st.Fds
+
+		if u := uptime - float64(st.StartTime)/clockTicks; u > maxUptime {
+			maxUptime = u
+		}
+	}
+
+	if len(stats) == 0 {
+		return
+	}
+
+	// the sums of counters would drop when a pid exits, so the rates are computed per pid
+	if rate, ok := procRates(tags, stats, time.Now()); ok {
+		L = append(L, GaugeValue("proc.cpu.percent", rate.CpuPercent, tags))
+		L = append(L, GaugeValue("proc.io.read.bytes", rate.ReadBytes, tags))
+		L = append(L, GaugeValue("proc.io.write.bytes", rate.WriteBytes, tags))
+	}
+
+	L = append(L, GaugeValue("proc.mem.rss", sum.Rss, tags))
+	L = append(L, GaugeValue("proc.mem.vms", sum.Vms, tags))
+	L = append(L, GaugeValue("proc.fd.num", sum.Fds, tags))
+	L = append(L, GaugeValue("proc.thread.num", sum.Threads, tags))
+	// of the oldest one, e.g. the master of nginx
+	L = append(L, GaugeValue("proc.uptime", int64(maxUptime), tags))
+	return
+}
+
+// the first sample has no rate
+func procRates(tags string, stats map[int]*procStat, now time.Time) (*procRate, bool) {
+	procSamplesLock.Lock()
+	defer procSamplesLock.Unlock()
+
+	prev, ok := procSamples[tags]
+	procSamples[tags] = &procSample{Stats: stats, At: now}
+	if !ok {
+		return nil, false
+	}
+
+	elapsed := now.Sub(prev.At).Seconds()
+	if elapsed <= 0 {
+		return nil, false
+	}
+
+	delta := func(curr, last uint64) float64 {
+		if curr < last {
+			return 0
+		}
+		return float64(curr - last)
+	}
+
+	var ticks, read, write float64
+	for pid, st := range stats {
+		p, ok := prev.Stats[pid]
+		if !ok || st.StartTime != p.StartTime {
+			continue
+		}
+		ticks += delta(st.CpuTicks, p.CpuTicks)
+		read += delta(st.ReadBytes, p.ReadBytes)
+		write += delta(st.WriteBytes, p.WriteBytes)
+	}
+
+	return &procRate{
+		CpuPercent: ticks / clockTicks / elapsed * 100,
+		ReadBytes:  read / elapsed,
+		WriteBytes: write / elapsed,
+	}, true
+}
+
+func forgetProcSamples(tags map[string]map[int]string) {
+	procSamplesLock.Lock()
+	defer procSamplesLock.Unlock()
+	for k := range procSamples {
+		if _, ok := tags[k]; !ok {
+			delete(procSamples, k)
+		}
+	}
+}
+
+func readProcStat(pid int) (*procStat, error) {
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	// the comm in the parentheses may contain spaces
+	content := string(bs)
+	idx := strings.LastIndex(content, ")")
+	if idx < 0 {
+		return nil, fmt.Errorf("bad %s/stat", dir)
+	}
+
+	// fields[0] is the 3rd field, state
+	fields := strings.Fields(content[idx+1:])
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("bad %s/stat", dir)
+	}
+
+	field := func(n int) uint64 {
+		v, _ := strconv.ParseUint(fields[n-3], 10, 64)
+		return v
+	}
+
+	st := &procStat{
+		CpuTicks:  field(14) + field(15),
+		Threads:   field(20),
+		StartTime: field(22),
+		Vms:       field(23),
+		Rss:       field(24) * uint64(os.Getpagesize()),
+	}
+
+	if fds, err := ioutil.ReadDir(filepath.Join(dir, "fd")); err == nil {
+		st.Fds = uint64(len(fds))
+	}
+
+	// root only for the processes of other users
+	if io, err := readProcIO(filepath.Join(dir, "io")); err == nil {
+		st.ReadBytes = io["read_bytes"]
+		st.WriteBytes = io["write_bytes"]
+	}
+
+	return st, nil
+}
+
+// 'key: value' per line
+func readProcIO(fpath string) (map[string]uint64, error) {
+	bs, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]uint64)
+	for _, line := range strings.Split(string(bs), "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(strings.TrimSpace(kv[1]), 10, 64); err == nil {
+			ret[strings.TrimSpace(kv[0])] = v
+		}
+	}
+	return ret, nil
+}
+
+func systemUptime() (float64, error) {
+	s, err := file.ToTrimString(filepath.Join(procRoot, "uptime"))
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("bad %s/uptime", procRoot)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
@@ -0,0 +1,96 @@
+package funcs
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestProcResourceMetrics(t *testing.T) {
+	tags := "name=funcs.test"
+	pids := []int{os.Getpid(), -1}
+
+	L := procResourceMetrics(tags, pids)
+	values := make(map[string]float64)
+	for _, mv := range L {
+		if mv.Tags != tags {
+			t.Errorf("expect tags %s, but %s", tags, mv.Tags)
+		}
+		values[mv.Metric] = toFloat(mv.Value)
+	}
+
+	if _, ok := values["proc.cpu.percent"]; ok {
+		t.Error("expect no cpu percent for the first sample")
+	}
+	for _, metric := range []string{"proc.mem.rss", "proc.mem.vms", "proc.fd.num", "proc.thread.num"} {
+		if values[metric] <= 0 {
+			t.Errorf("expect %s > 0, but %v", metric, values[metric])
+		}
+	}
+
+	// burn some cpu
+	for start := time.Now(); time.Since(start) < 100*time.Millisecond; {
+	}
+
+	found := false
+	for _, mv := range procResourceMetrics(tags, pids) {
+		if mv.Metric == "proc.cpu.percent" {
+			found = true
+			if toFloat(mv.Value) <= 0 {
+				t.Errorf("expect cpu percent > 0, but %v", mv.Value)
+			}
+		}
+	}
+	if !found {
+		t.Error("expect cpu percent for the second sample")
+	}
+
+	if L := procResourceMetrics(tags, []int{-1}); len(L) != 0 {
+		t.Errorf("expect nothing for the exited pids, but %v", L)
+	}
+}
+
+func TestProcRates(t *testing.T) {
+	tags := "name=rates.test"
+	defer forgetProcSamples(nil)
+
+	start := time.Now()
+	if _, ok := procRates(tags, map[int]*procStat{
+		1: {CpuTicks: 100, StartTime: 10, ReadBytes: 1000, WriteBytes: 100},
+		2: {CpuTicks: 900, StartTime: 20, ReadBytes: 9000, WriteBytes: 900},
+	}, start); ok {
+		t.Error("expect no rate for the first sample")
+	}
+
+	// pid 2 exited, pid 3 started
+	rate, ok := procRates(tags, map[int]*procStat{
+		1: {CpuTicks: 150, StartTime: 10, ReadBytes: 3000, WriteBytes: 300},
+		3: {CpuTicks: 50, StartTime: 30, ReadBytes: 500, WriteBytes: 50},
+	}, start.Add(10*time.Second))
+	if !ok {
+		t.Fatal("expect the rate of the second sample")
+	}
+	if rate.CpuPercent != 5 || rate.ReadBytes != 200 || rate.WriteBytes != 20 {
+		t.Errorf("unexpected rate %+v", rate)
+	}
+
+	// pid 1 was reused
+	rate, _ = procRates(tags, map[int]*procStat{
+		1: {CpuTicks: 10, StartTime: 40, ReadBytes: 10, WriteBytes: 10},
+	}, start.Add(20*time.Second))
+	if rate.CpuPercent != 0 || rate.ReadBytes != 0 || rate.WriteBytes != 0 {
+		t.Errorf("expect a reused pid left out, but %+v", rate)
+	}
+}
+
+func toFloat(v interface{}) float64 {
+	switch x := v.(type) {
+	case float64:
+		return x
+	case uint64:
+		return float64(x)
+	case int64:
+		return float64(x)
+	}
+	return 0
+}
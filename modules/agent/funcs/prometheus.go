@@ -0,0 +1,269 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package funcs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+)
+
+const defaultPromScrapeTimeout = 3000
+
+type promSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+func PrometheusMetrics() (L []*model.MetricValue) {
+	targets := []*g.PrometheusTarget{}
+	timeout := defaultPromScrapeTimeout
+
+	if cfg := g.Config().Prometheus; cfg != nil {
+		targets = append(targets, cfg.Targets...)
+		if cfg.Timeout > 0 {
+			timeout = cfg.Timeout
+		}
+	}
+	for _, target := range g.ReportPromTargets() {
+		targets = append(targets, target)
+	}
+
+	sz := len(targets)
+	if sz == 0 {
+		return
+	}
+
+	result := make(chan []*model.MetricValue, sz)
+	var wg sync.WaitGroup
+
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target *g.PrometheusTarget) {
+			defer wg.Done()
+
+			tags := target.Tags
+			if tags == "" {
+				tags = "url=" + target.Url
+			}
+
+			items, bad, err := scrapePrometheus(target, time.Duration(timeout)*time.Millisecond)
+			if err != nil {
+				log.Printf("scrape prometheus target [%v] failed: %v", target.Url, err)
+				result <- []*model.MetricValue{GaugeValue(g.PROMETHEUS_UP, 0, tags)}
+				return
+			}
+			if len(bad) > 0 {
+				log.Printf("scrape prometheus target [%v]: skip %d bad lines, the first: %v", target.Url, len(bad), bad[0])
+			}
+			result <- append(items, GaugeValue(g.PROMETHEUS_UP, 1, tags), GaugeValue(g.PROMETHEUS_PARSE_ERRORS, len(bad), tags))
+		}(target)
+	}
+	wg.Wait()
+
+	for i := 0; i < sz; i++ {
+		L = append(L, <-result...)
+	}
+	return
+}
+
+func scrapePrometheus(target *g.PrometheusTarget, timeout time.Duration) ([]*model.MetricValue, []error, error) {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(target.Url)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return ParsePrometheusText(resp.Body, target.Prefix)
+}
+
+// ParsePrometheusText converts the prometheus text exposition format to falcon metrics,
+// counters and histograms are COUNTER, gauges, summary quantiles and untyped are GAUGE.
+// A malformed sample line is skipped with its error in bad, err is only for reading r.
+func ParsePrometheusText(r io.Reader, prefix string) (L []*model.MetricValue, bad []error, err error) {
+	types := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		sample, err := parsePromSample(line)
+		if err != nil {
+			bad = append(bad, err)
+			continue
+		}
+
+		// falcon can not store them
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+
+		dataType := "GAUGE"
+		switch promFamilyType(sample.Name, types) {
+		case "counter", "histogram":
+			dataType = "COUNTER"
+		case "summary":
+			if strings.HasSuffix(sample.Name, "_sum") || strings.HasSuffix(sample.Name, "_count") {
+				dataType = "COUNTER"
+			}
+		}
+
+		L = append(L, NewMetricValue(prefix+sample.Name, sample.Value, dataType, promTags(sample.Labels)...))
+	}
+
+	return L, bad, scanner.Err()
+}
+
+func promFamilyType(name string, types map[string]string) string {
+	if t, ok := types[name]; ok {
+		return t
+	}
+
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		t := types[strings.TrimSuffix(name, suffix)]
+		if t == "histogram" || t == "summary" {
+			return t
+		}
+	}
+
+	return "untyped"
+}
+
+func promTags(labels map[string]string) []string {
+	tags := make([]string, 0, len(labels))
+	for k, v := range labels {
+		if v == "" {
+			continue
+		}
+		tags = append(tags, utils.SanitizeTag(k)+"="+utils.SanitizeTag(v))
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// e.g. http_requests_total{method="post",code="200"} 1027 1395066363000
+func parsePromSample(line string) (*promSample, error) {
+	sample := &promSample{Labels: make(map[string]string)}
+
+	i := strings.IndexAny(line, "{ \t")
+	if i <= 0 {
+		return nil, fmt.Errorf("bad sample: %s", line)
+	}
+	sample.Name = line[:i]
+	rest := line[i:]
+
+	if rest[0] == '{' {
+		end, err := parsePromLabels(rest, sample.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("bad sample: %s, %v", line, err)
+		}
+		rest = rest[end:]
+	}
+
+	// the timestamp is ignored, the agent stamps every metric
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("bad sample: %s", line)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad sample: %s, %v", line, err)
+	}
+	sample.Value = value
+
+	return sample, nil
+}
+
+// parsePromLabels parses {k="v",...} at the head of s and returns the index after '}'
+func parsePromLabels(s string, labels map[string]string) (int, error) {
+	i := 1
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			return 0, fmt.Errorf("unclosed labels")
+		}
+		if s[i] == '}' {
+			return i + 1, nil
+		}
+
+		eq := strings.IndexByte(s[i:], '=')
+		if eq < 0 {
+			return 0, fmt.Errorf("label without value")
+		}
+		key := strings.TrimSpace(s[i : i+eq])
+		i += eq + 1
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i >= len(s) || s[i] != '"' {
+			return 0, fmt.Errorf("label value of %s is not quoted", key)
+		}
+		i++
+
+		var val []byte
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				if s[i] == 'n' {
+					val = append(val, '\n')
+					continue
+				}
+			}
+			val = append(val, s[i])
+		}
+		if i >= len(s) {
+			return 0, fmt.Errorf("label value of %s is not closed", key)
+		}
+		i++
+
+		labels[key] = string(val)
+	}
+}
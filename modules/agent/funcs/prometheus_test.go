@@ -0,0 +1,70 @@
+package funcs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const promText = `# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="400"}    3 1395066363000
+
+# TYPE temperature gauge
+temperature{room="a,b",note="say \"hi\""} 21.5
+temperature{room="c"} NaN
+# TYPE rpc_duration_seconds histogram
+rpc_duration_seconds_bucket{le="0.1"} 10
+rpc_duration_seconds_bucket{le="+Inf"} 12
+rpc_duration_seconds_sum 3.5
+rpc_duration_seconds_count 12
+# TYPE gc_seconds summary
+gc_seconds{quantile="0.5"} 0.01
+gc_seconds_count 7
+process_open_fds 12
+`
+
+func TestParsePrometheusText(t *testing.T) {
+	L, bad, err := ParsePrometheusText(strings.NewReader(promText), "app.")
+	if err != nil || len(bad) != 0 {
+		t.Fatal(bad, err)
+	}
+
+	expect := []string{
+		"app.http_requests_total/COUNTER/code=200,method=post/1027",
+		"app.http_requests_total/COUNTER/code=400,method=post/3",
+		`app.temperature/GAUGE/note=say_"hi",room=a_b/21.5`,
+		"app.rpc_duration_seconds_bucket/COUNTER/le=0.1/10",
+		"app.rpc_duration_seconds_bucket/COUNTER/le=+Inf/12",
+		"app.rpc_duration_seconds_sum/COUNTER//3.5",
+		"app.rpc_duration_seconds_count/COUNTER//12",
+		"app.gc_seconds/GAUGE/quantile=0.5/0.01",
+		"app.gc_seconds_count/COUNTER//7",
+		"app.process_open_fds/GAUGE//12",
+	}
+
+	if len(L) != len(expect) {
+		t.Fatalf("expect %d metrics, but %v", len(expect), L)
+	}
+	for i, mv := range L {
+		got := strings.Join([]string{mv.Metric, mv.Type, mv.Tags, fmt.Sprint(mv.Value)}, "/")
+		if got != expect[i] {
+			t.Errorf("expect %s, but %s", expect[i], got)
+		}
+	}
+}
+
+func TestParsePrometheusTextBadLine(t *testing.T) {
+	text := "up{job=\"a} 1\nfree_bytes abc\nused_bytes 3\n{} 1\n"
+	L, bad, err := ParsePrometheusText(strings.NewReader(text), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bad) != 3 {
+		t.Errorf("expect 3 bad lines, but %v", bad)
+	}
+	if len(L) != 1 || L[0].Metric != "used_bytes" {
+		t.Errorf("expect used_bytes kept, but %v", L)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package funcs
+
+import (
+	"bufio"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+)
+
+// the INFO fields reported as redis.$field, the others are left out
+var redisInfoTypes = map[string]string{
+	"uptime_in_seconds":           "GAUGE",
+	"connected_clients":           "GAUGE",
+	"blocked_clients":             "GAUGE",
+	"used_memory":                 "GAUGE",
+	"used_memory_rss":             "GAUGE",
+	"used_memory_peak":            "GAUGE",
+	"maxmemory":                   "GAUGE",
+	"mem_fragmentation_ratio":     "GAUGE",
+	"rdb_changes_since_last_save": "GAUGE",
+	"rdb_last_bgsave_status":      "GAUGE",
+	"aof_last_bgrewrite_status":   "GAUGE",
+	"instantaneous_ops_per_sec":   "GAUGE",
+	"connected_slaves":            "GAUGE",
+	"master_link_status":          "GAUGE",
+	"master_last_io_seconds_ago":  "GAUGE",
+	"master_repl_offset":          "GAUGE",
+	"pubsub_channels":             "GAUGE",
+	"pubsub_patterns":             "GAUGE",
+	"total_connections_received":  "COUNTER",
+	"total_commands_processed":    "COUNTER",
+	"total_net_input_bytes":       "COUNTER",
+	"total_net_output_bytes":      "COUNTER",
+	"rejected_connections":        "COUNTER",
+	"expired_keys":                "COUNTER",
+	"evicted_keys":                "COUNTER",
+	"keyspace_hits":               "COUNTER",
+	"keyspace_misses":             "COUNTER",
+	"sync_full":                   "COUNTER",
+	"sync_partial_ok":             "COUNTER",
+	"sync_partial_err":            "COUNTER",
+	"used_cpu_sys":                "COUNTER",
+	"used_cpu_user":               "COUNTER",
+}
+
+func RedisMetrics() (L []*model.MetricValue) {
+	var password string
+	var addrs []string
+	if cfg := g.Config().Services; cfg != nil && cfg.Redis != nil {
+		password = cfg.Redis.Password
+		addrs = cfg.Redis.Addrs
+	}
+
+	targets := serviceTargets(g.REDIS_UP, "addr", addrs)
+	if len(targets) == 0 {
+		return
+	}
+
+	timeout := serviceTimeout()
+	return collectServices(targets, func(addr, tags string) []*model.MetricValue {
+		conn, err := redis.Dial("tcp", addr,
+			redis.DialConnectTimeout(timeout),
+			redis.DialReadTimeout(timeout),
+			redis.DialWriteTimeout(timeout),
+			redis.DialPassword(password),
+		)
+		if err != nil {
+			log.Println("connect redis", addr, "fail:", err)
+			return []*model.MetricValue{GaugeValue(g.REDIS_UP, 0, tags)}
+		}
+		defer conn.Close()
+
+		info, err := redis.String(conn.Do("INFO"))
+		if err != nil {
+			log.Println("redis", addr, "INFO fail:", err)
+			return []*model.MetricValue{GaugeValue(g.REDIS_UP, 0, tags)}
+		}
+
+		return append(parseRedisInfo(info, tags), GaugeValue(g.REDIS_UP, 1, tags))
+	})
+}
+
+// field:value lines, the keyspace lines like db0:keys=1,expires=0 become redis.keyspace.keys with db=db0
+func parseRedisInfo(info string, tags string) (L []*model.MetricValue) {
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		field, value := kv[0], kv[1]
+
+		if strings.HasPrefix(field, "db") && strings.Contains(value, "=") {
+			for _, pair := range strings.Split(value, ",") {
+				p := strings.SplitN(pair, "=", 2)
+				if len(p) != 2 || (p[0] != "keys" && p[0] != "expires") {
+					continue
+				}
+				if v, err := strconv.ParseFloat(p[1], 64); err == nil {
+					L = append(L, GaugeValue("redis.keyspace."+p[0], v, tags, "db="+field))
+				}
+			}
+			continue
+		}
+
+		dataType, ok := redisInfoTypes[field]
+		if !ok {
+			continue
+		}
+
+		switch value {
+		case "ok", "up":
+			value = "1"
+		case "err", "down":
+			value = "0"
+		}
+
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		L = append(L, NewMetricValue("redis."+field, v, dataType, tags))
+	}
+	return
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package funcs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+)
+
+const defaultServiceTimeout = 3000 // ms
+
+func serviceTimeout() time.Duration {
+	ms := defaultServiceTimeout
+	if cfg := g.Config().Services; cfg != nil && cfg.Timeout > 0 {
+		ms = cfg.Timeout
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// serviceTargets returns address => tags, the configured addresses are tagged by key=address,
+// the ones of the strategies pushed from hbs keep the strategy tags
+func serviceTargets(metric string, key string, addrs []string) map[string]string {
+	targets := make(map[string]string)
+	for _, addr := range addrs {
+		targets[addr] = key + "=" + addr
+	}
+	for addr, tags := range g.ReportServices(metric) {
+		targets[addr] = tags
+	}
+	return targets
+}
+
+// collectServices runs fn for every target concurrently
+func collectServices(targets map[string]string, fn func(addr, tags string) []*model.MetricValue) (L []*model.MetricValue) {
+	result := make(chan []*model.MetricValue, len(targets))
+	var wg sync.WaitGroup
+
+	for addr, tags := range targets {
+		wg.Add(1)
+		go func(addr, tags string) {
+			defer wg.Done()
+			result <- fn(addr, tags)
+		}(addr, tags)
+	}
+	wg.Wait()
+	close(result)
+
+	for metrics := range result {
+		L = append(L, metrics...)
+	}
+	return
+}
@@ -0,0 +1,67 @@
+package funcs
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/open-falcon/falcon-plus/common/model"
+)
+
+func dumpServiceMetrics(L []*model.MetricValue) string {
+	got := []string{}
+	for _, mv := range L {
+		got = append(got, fmt.Sprintf("%s/%s/%s/%v", mv.Metric, mv.Type, mv.Tags, mv.Value))
+	}
+	sort.Strings(got)
+	return fmt.Sprint(got)
+}
+
+func TestParseRedisInfo(t *testing.T) {
+	info := "# Server\r\nredis_version:3.2.1\r\nuptime_in_seconds:100\r\n\r\n# Stats\r\ntotal_commands_processed:42\r\nmaster_link_status:up\r\n# Keyspace\r\ndb0:keys=5,expires=1,avg_ttl=0\r\n"
+
+	expect := "[redis.keyspace.expires/GAUGE/addr=a,db=db0/1 redis.keyspace.keys/GAUGE/addr=a,db=db0/5 redis.master_link_status/GAUGE/addr=a/1 redis.total_commands_processed/COUNTER/addr=a/42 redis.uptime_in_seconds/GAUGE/addr=a/100]"
+	if got := dumpServiceMetrics(parseRedisInfo(info, "addr=a")); got != expect {
+		t.Errorf("expect %s, but %s", expect, got)
+	}
+}
+
+func TestMysqlDSN(t *testing.T) {
+	dsn := mysqlDSN("monitor", "p@ss/w?rd:", "10.0.0.1:3306", 2*time.Second)
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.User != "monitor" || cfg.Passwd != "p@ss/w?rd:" || cfg.Addr != "10.0.0.1:3306" || cfg.Timeout != 2*time.Second || cfg.ReadTimeout != 2*time.Second {
+		t.Errorf("unexpected %s => %+v", dsn, cfg)
+	}
+}
+
+func TestMysqlStatusMetrics(t *testing.T) {
+	status := map[string]string{"Threads_running": "3", "Questions": "100", "Ssl_version": "", "Uptime": "x"}
+
+	expect := "[mysql.questions/COUNTER/addr=a/100 mysql.threads_running/GAUGE/addr=a/3]"
+	if got := dumpServiceMetrics(mysqlStatusMetrics(status, "addr=a")); got != expect {
+		t.Errorf("expect %s, but %s", expect, got)
+	}
+}
+
+func TestParseNginxStatus(t *testing.T) {
+	body := "Active connections: 291 \nserver accepts handled requests\n 16630948 16630948 31070465 \nReading: 6 Writing: 179 Waiting: 106 \n"
+
+	L, err := parseNginxStatus(body, "url=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "[nginx.accepts/COUNTER/url=b/16630948 nginx.active/GAUGE/url=b/291 nginx.handled/COUNTER/url=b/16630948 nginx.reading/GAUGE/url=b/6 nginx.requests/COUNTER/url=b/31070465 nginx.waiting/GAUGE/url=b/106 nginx.writing/GAUGE/url=b/179]"
+	if got := dumpServiceMetrics(L); got != expect {
+		t.Errorf("expect %s, but %s", expect, got)
+	}
+
+	if _, err := parseNginxStatus("<html>404</html>", "url=b"); err == nil {
+		t.Error("expect bad stub_status")
+	}
+}
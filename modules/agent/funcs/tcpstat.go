@@ -0,0 +1,150 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package funcs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+)
+
+// the st column of /proc/net/tcp, include/net/tcp_states.h
+var tcpStates = map[string]string{
+	"01": "established",
+	"02": "syn_sent",
+	"03": "syn_recv",
+	"04": "fin_wait1",
+	"05": "fin_wait2",
+	"06": "time_wait",
+	"07": "close",
+	"08": "close_wait",
+	"09": "last_ack",
+	"0A": "listen",
+	"0B": "closing",
+}
+
+type tcpPortStat struct {
+	Established uint64
+	TimeWait    uint64
+	AcceptQueue uint64 // rx_queue of the listening socket
+}
+
+// TcpStateMetrics counts the tcp connections of /proc/net/tcp and tcp6 by state,
+// and by local port for the ports of the net.port.* strategies
+func TcpStateMetrics() (L []*model.MetricValue) {
+	states := make(map[string]uint64, len(tcpStates))
+	for _, state := range tcpStates {
+		states[state] = 0
+	}
+
+	ports := make(map[int64]*tcpPortStat)
+	for _, port := range g.ReportConnPorts() {
+		ports[port] = &tcpPortStat{}
+	}
+
+	for _, file := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(file)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Println(err)
+			}
+			continue
+		}
+
+		err = parseProcNetTcp(f, states, ports)
+		f.Close()
+		if err != nil {
+			log.Println("parse", file, "fail:", err)
+		}
+	}
+
+	for state, count := range states {
+		L = append(L, GaugeValue("net.tcp.conn", count, "state="+state))
+	}
+
+	for port, stat := range ports {
+		tags := fmt.Sprintf("port=%d", port)
+		L = append(L, GaugeValue(g.NET_PORT_ESTABLISHED, stat.Established, tags))
+		L = append(L, GaugeValue(g.NET_PORT_TIME_WAIT, stat.TimeWait, tags))
+		L = append(L, GaugeValue(g.NET_PORT_ACCEPT_QUEUE, stat.AcceptQueue, tags))
+	}
+
+	return
+}
+
+// sl local_address rem_address st tx_queue:rx_queue ..., addresses are hex ip:port
+func parseProcNetTcp(r io.Reader, states map[string]uint64, ports map[int64]*tcpPortStat) error {
+	scanner := bufio.NewScanner(r)
+	first := true
+	for scanner.Scan() {
+		if first {
+			first = false
+			continue
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		state, ok := tcpStates[fields[3]]
+		if !ok {
+			continue
+		}
+		states[state]++
+
+		if len(ports) == 0 {
+			continue
+		}
+
+		idx := strings.LastIndex(fields[1], ":")
+		if idx < 0 {
+			continue
+		}
+		port, err := strconv.ParseInt(fields[1][idx+1:], 16, 64)
+		if err != nil {
+			continue
+		}
+
+		stat, ok := ports[port]
+		if !ok {
+			continue
+		}
+
+		switch state {
+		case "established":
+			stat.Established++
+		case "time_wait":
+			stat.TimeWait++
+		case "listen":
+			// the backlog is not in /proc/net/tcp, tx_queue of a listening socket is 0
+			queues := strings.SplitN(fields[4], ":", 2)
+			if len(queues) != 2 {
+				continue
+			}
+			rx, _ := strconv.ParseUint(queues[1], 16, 64)
+			stat.AcceptQueue += rx
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,32 @@
+package funcs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseProcNetTcp(t *testing.T) {
+	data := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0050 00000000:0000 0A 00000000:00000003 00:00000000 00000000     0        0 1000 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0050 0100007F:D2F0 01 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 20 4 30 10 -1
+   2: 0100007F:0050 0100007F:D2F2 06 00000000:00000000 03:00000A00 00000000     0        0 0 3 0000000000000000
+   3: 0100007F:D2F0 0100007F:0050 01 00000000:00000000 00:00000000 00000000     0        0 1002 1 0000000000000000 20 4 30 10 -1
+`
+	states := map[string]uint64{}
+	ports := map[int64]*tcpPortStat{80: {}, 22: {}}
+
+	if err := parseProcNetTcp(strings.NewReader(data), states, ports); err != nil {
+		t.Fatal(err)
+	}
+
+	if states["established"] != 2 || states["time_wait"] != 1 || states["listen"] != 1 {
+		t.Errorf("unexpected states %v", states)
+	}
+
+	if s := *ports[80]; s != (tcpPortStat{Established: 1, TimeWait: 1, AcceptQueue: 3}) {
+		t.Errorf("unexpected port 80 %+v", s)
+	}
+	if s := *ports[22]; s != (tcpPortStat{}) {
+		t.Errorf("unexpected port 22 %+v", s)
+	}
+}
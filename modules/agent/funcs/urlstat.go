@@ -15,18 +15,38 @@
 package funcs
 
 import (
-	"bufio"
 	"bytes"
+	"crypto/tls"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
-	"strings"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
 
 	"github.com/open-falcon/falcon-plus/common/model"
 	"github.com/open-falcon/falcon-plus/modules/agent/g"
-	"github.com/toolkits/file"
-	"github.com/toolkits/sys"
 )
 
+type urlProbeResult struct {
+	Ok         bool
+	StatusCode int
+	BodySize   int64
+	Matched    bool
+	// milliseconds
+	Latency float64
+	DNS     float64
+	Connect float64
+	TLS     float64
+	TTFB    float64
+	// -1 when the url is not https
+	CertExpireDays float64
+}
+
 func UrlMetrics() (L []*model.MetricValue) {
 	reportUrls := g.ReportUrls()
 	sz := len(reportUrls)
@@ -37,32 +57,169 @@ func UrlMetrics() (L []*model.MetricValue) {
 	if err != nil {
 		hostname = "None"
 	}
-	for furl, timeout := range reportUrls {
-		tags := fmt.Sprintf("url=%v,timeout=%v,src=%v", furl, timeout, hostname)
-		if ok, _ := probeUrl(furl, timeout); !ok {
-			L = append(L, GaugeValue(g.URL_CHECK_HEALTH, 0, tags))
-			continue
+
+	result := make(chan []*model.MetricValue, sz)
+	var wg sync.WaitGroup
+
+	for _, probe := range reportUrls {
+		wg.Add(1)
+		go func(probe *g.UrlProbe) {
+			defer wg.Done()
+			tags := fmt.Sprintf("%s,src=%s", probe.Tags, hostname)
+			result <- urlProbeMetrics(probe, tags)
+		}(probe)
+	}
+	wg.Wait()
+
+	for i := 0; i < sz; i++ {
+		L = append(L, <-result...)
+	}
+	return
+}
+
+func urlProbeMetrics(probe *g.UrlProbe, tags string) (L []*model.MetricValue) {
+	r, err := probeUrl(probe)
+	if err != nil {
+		log.Printf("probe url [%v] failed.the err is: [%v]\n", probe.Url, err)
+		L = append(L, GaugeValue(g.URL_CHECK_HEALTH, 0, tags))
+		L = append(L, GaugeValue(g.URL_CHECK_STATUS, 0, tags))
+		// an expired or untrusted certificate fails the probe, its expiry is still reported
+		if days, err := certExpireDays(probe); err == nil {
+			L = append(L, GaugeValue(g.URL_CHECK_CERT_EXPIRE_DAYS, days, tags))
 		}
+		return
+	}
+
+	if r.Ok {
 		L = append(L, GaugeValue(g.URL_CHECK_HEALTH, 1, tags))
+	} else {
+		L = append(L, GaugeValue(g.URL_CHECK_HEALTH, 0, tags))
+	}
+
+	L = append(L, GaugeValue(g.URL_CHECK_STATUS, r.StatusCode, tags))
+	L = append(L, GaugeValue(g.URL_CHECK_LATENCY, r.Latency, tags))
+	L = append(L, GaugeValue(g.URL_CHECK_DNS_TIME, r.DNS, tags))
+	L = append(L, GaugeValue(g.URL_CHECK_CONNECT_TIME, r.Connect, tags))
+	L = append(L, GaugeValue(g.URL_CHECK_TTFB, r.TTFB, tags))
+	L = append(L, GaugeValue(g.URL_CHECK_BODY_SIZE, r.BodySize, tags))
+
+	if probe.Match != "" {
+		matched := 0
+		if r.Matched {
+			matched = 1
+		}
+		L = append(L, GaugeValue(g.URL_CHECK_BODY_MATCH, matched, tags))
+	}
+
+	if r.CertExpireDays >= 0 {
+		L = append(L, GaugeValue(g.URL_CHECK_TLS_TIME, r.TLS, tags))
+		L = append(L, GaugeValue(g.URL_CHECK_CERT_EXPIRE_DAYS, r.CertExpireDays, tags))
 	}
+
 	return
 }
 
-func probeUrl(furl string, timeout string) (bool, error) {
-	bs, err := sys.CmdOutBytes("curl", "--max-filesize", "102400", "-I", "-m", timeout, "-o", "/dev/null", "-s", "-w", "%{http_code}", furl)
+func probeUrl(probe *g.UrlProbe) (*urlProbeResult, error) {
+	req, err := http.NewRequest(probe.Method, probe.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var dnsStart, dnsDone, connStart, connDone, tlsStart, tlsDone, firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { dnsDone = time.Now() },
+		ConnectStart:         func(string, string) { connStart = time.Now() },
+		ConnectDone:          func(string, string, error) { connDone = time.Now() },
+		TLSHandshakeStart:    func() { tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { tlsDone = time.Now() },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	// a fresh connection every time, so that dns/connect/tls are measured
+	client := &http.Client{
+		Timeout:   time.Duration(probe.Timeout) * time.Second,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, DisableKeepAlives: true},
+		// same as curl without -L, a redirect is not healthy
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// the body beyond maxBody is neither read nor counted
+	maxBody := probe.MaxBody
+	if maxBody <= 0 {
+		maxBody = g.DefaultUrlMaxBody
+	}
+	head, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return nil, err
+	}
+	end := time.Now()
+
+	r := &urlProbeResult{
+		StatusCode:     resp.StatusCode,
+		BodySize:       int64(len(head)),
+		Latency:        milliseconds(start, end),
+		DNS:            milliseconds(dnsStart, dnsDone),
+		Connect:        milliseconds(connStart, connDone),
+		TLS:            milliseconds(tlsStart, tlsDone),
+		TTFB:           milliseconds(start, firstByte),
+		CertExpireDays: -1,
+	}
+
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		r.CertExpireDays = resp.TLS.PeerCertificates[0].NotAfter.Sub(end).Hours() / 24
+	}
+
+	r.Matched = probe.Match != "" && bytes.Contains(head, []byte(probe.Match))
+	r.Ok = r.StatusCode == probe.Expect && (probe.Match == "" || r.Matched)
+	if !r.Ok {
+		log.Printf("return code [%v] is not %v or body does not match.query url is [%v]", r.StatusCode, probe.Expect, probe.Url)
+	}
+
+	return r, nil
+}
+
+// certExpireDays reads the certificate of an https url without verifying it
+func certExpireDays(probe *g.UrlProbe) (float64, error) {
+	u, err := url.Parse(probe.Url)
 	if err != nil {
-		log.Printf("probe url [%v] failed.the err is: [%v]\n", furl, err)
-		return false, err
+		return 0, err
+	}
+	if u.Scheme != "https" {
+		return 0, fmt.Errorf("%s is not https", probe.Url)
 	}
-	reader := bufio.NewReader(bytes.NewBuffer(bs))
-	retcode, err := file.ReadLine(reader)
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "443")
+	}
+	dialer := &net.Dialer{Timeout: time.Duration(probe.Timeout) * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: true})
 	if err != nil {
-		log.Println("read retcode failed.err is:", err)
-		return false, err
+		return 0, err
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return 0, fmt.Errorf("no certificate from %s", addr)
 	}
-	if strings.TrimSpace(string(retcode)) != "200" {
-		log.Printf("return code [%v] is not 200.query url is [%v]", string(retcode), furl)
-		return false, err
+	return certs[0].NotAfter.Sub(time.Now()).Hours() / 24, nil
+}
+
+func milliseconds(start, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() {
+		return 0
 	}
-	return true, err
+	return float64(end.Sub(start).Nanoseconds()) / 1e6
 }
@@ -0,0 +1,69 @@
+package funcs
+
+import (
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProbeUrl(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/", http.StatusMovedPermanently)
+			return
+		}
+		w.Write([]byte("status: ok"))
+	}))
+	defer ts.Close()
+
+	probe := &g.UrlProbe{Url: ts.URL, Timeout: 3, Method: "GET", Expect: 200, Match: "ok"}
+	r, err := probeUrl(probe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Ok || r.StatusCode != 200 || r.BodySize != 10 || !r.Matched || r.CertExpireDays != -1 {
+		t.Errorf("unexpected probe result: %+v", r)
+	}
+
+	probe.Match = "fail"
+	if r, _ = probeUrl(probe); r.Ok || r.Matched {
+		t.Errorf("expect body mismatch, but %+v", r)
+	}
+
+	probe = &g.UrlProbe{Url: ts.URL + "/moved", Timeout: 3, Method: "GET", Expect: 200}
+	if r, _ = probeUrl(probe); r.Ok || r.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("expect redirect not to be followed, but %+v", r)
+	}
+}
+
+func TestProbeUrlTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	// the test certificate is not trusted
+	probe := &g.UrlProbe{Url: ts.URL, Timeout: 3, Method: "GET", Expect: 200, Tags: "url=" + ts.URL + ",timeout=3"}
+	L := urlProbeMetrics(probe, probe.Tags)
+	if len(L) != 3 || L[0].Metric != g.URL_CHECK_HEALTH || L[0].Value != 0 {
+		t.Fatalf("expect url.check.health 0, but %v", L)
+	}
+	if L[2].Metric != g.URL_CHECK_CERT_EXPIRE_DAYS || L[2].Value.(float64) <= 0 {
+		t.Errorf("expect the expiry of the untrusted certificate, but %v", L[2])
+	}
+}
+
+func TestProbeUrlMaxBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 1024))
+	}))
+	defer ts.Close()
+
+	probe := &g.UrlProbe{Url: ts.URL, Timeout: 3, Method: "GET", Expect: 200, MaxBody: 100}
+	r, err := probeUrl(probe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Ok || r.BodySize != 100 {
+		t.Errorf("expect 100 bytes read, but %+v", r)
+	}
+}
@@ -16,32 +16,46 @@ package g
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"sync"
 
+	"github.com/open-falcon/falcon-plus/common/utils"
 	"github.com/toolkits/file"
 )
 
 type PluginConfig struct {
-	Enabled bool   `json:"enabled"`
-	Dir     string `json:"dir"`
-	Git     string `json:"git"`
-	LogDir  string `json:"logs"`
+	Enabled        bool   `json:"enabled"`
+	Dir            string `json:"dir"`
+	Git            string `json:"git"`
+	LogDir         string `json:"logs"`
+	MaxConcurrency int    `json:"maxConcurrency"` // 0 means no limit
 }
 
 type HeartbeatConfig struct {
-	Enabled  bool   `json:"enabled"`
-	Addr     string `json:"addr"`
-	Interval int    `json:"interval"`
-	Timeout  int    `json:"timeout"`
+	Enabled  bool             `json:"enabled"`
+	Addr     string           `json:"addr"`
+	Interval int              `json:"interval"`
+	Timeout  int              `json:"timeout"`
+	Tls      *utils.TLSConfig `json:"tls"`
+	Token    string           `json:"token"` // shared or per host token checked by Agent.Auth
+}
+
+// self upgrade to the version set on the host group in hbs
+type UpgradeConfig struct {
+	Enabled     bool `json:"enabled"`
+	Timeout     int  `json:"timeout"`     // seconds to download the binary
+	HealthCheck int  `json:"healthCheck"` // seconds the new version runs before it is kept
 }
 
 type TransferConfig struct {
-	Enabled  bool     `json:"enabled"`
-	Addrs    []string `json:"addrs"`
-	Interval int      `json:"interval"`
-	Timeout  int      `json:"timeout"`
+	Enabled  bool             `json:"enabled"`
+	Addrs    []string         `json:"addrs"`
+	Interval int              `json:"interval"`
+	Timeout  int              `json:"timeout"`
+	Tls      *utils.TLSConfig `json:"tls"`
+	Token    string           `json:"token"` // shared or per host token checked by Transfer.Auth
 }
 
 type HttpConfig struct {
@@ -50,22 +64,130 @@ type HttpConfig struct {
 	Backdoor bool   `json:"backdoor"`
 }
 
+// AllowedCommand is a named command /run may execute with parameters,
+// "${name}" in args is replaced by the value of the param name
+type AllowedCommand struct {
+	Args      []string          `json:"args"`
+	Params    map[string]string `json:"params"`    // param name => regexp the value has to match
+	Timeout   int               `json:"timeout"`   // seconds
+	MaxOutput int               `json:"maxOutput"` // bytes
+}
+
+type RunConfig struct {
+	Key       string                     `json:"key"`     // hmac-sha256 key of the signed requests
+	MaxSkew   int                        `json:"maxSkew"` // seconds
+	Timeout   int                        `json:"timeout"`
+	MaxOutput int                        `json:"maxOutput"`
+	AuditLog  string                     `json:"auditLog"`
+	Commands  map[string]*AllowedCommand `json:"commands"`
+}
+
+// local services to collect, more addresses are pushed from hbs
+// by redis.up, mysql.up and nginx.up strategies
+type ServicesConfig struct {
+	Timeout int          `json:"timeout"` // ms
+	Redis   *RedisConfig `json:"redis"`
+	Mysql   *MysqlConfig `json:"mysql"`
+	Nginx   *NginxConfig `json:"nginx"`
+}
+
+type RedisConfig struct {
+	Password string   `json:"password"`
+	Addrs    []string `json:"addrs"`
+}
+
+type MysqlConfig struct {
+	User     string   `json:"user"`
+	Password string   `json:"password"`
+	Addrs    []string `json:"addrs"`
+}
+
+type NginxConfig struct {
+	Urls []string `json:"urls"` // of stub_status
+}
+
+type SpoolConfig struct {
+	Enabled bool   `json:"enabled"`
+	Dir     string `json:"dir"`
+	MaxSize int64  `json:"maxSize"` // MB
+	MaxAge  int64  `json:"maxAge"`  // seconds
+}
+
+type CgroupConfig struct {
+	Enabled bool     `json:"enabled"`
+	Root    string   `json:"root"`
+	Include []string `json:"include"` // regexps of the cgroup path, all if empty
+	Exclude []string `json:"exclude"`
+}
+
 type CollectorConfig struct {
-	IfacePrefix []string `json:"ifacePrefix"`
-	MountPoint  []string `json:"mountPoint"`
+	IfacePrefix      []string      `json:"ifacePrefix"`
+	MountPoint       []string      `json:"mountPoint"`
+	LogKeywordSample bool          `json:"logKeywordSample"` // log a sample line matched by log.keyword
+	Cgroup           *CgroupConfig `json:"cgroup"`
+}
+
+type PrometheusTarget struct {
+	Url    string `json:"url"`
+	Prefix string `json:"prefix"`
+	Tags   string `json:"-"` // strategy tags when pushed by hbs
+}
+
+type PrometheusConfig struct {
+	Timeout int                 `json:"timeout"` // milliseconds
+	Targets []*PrometheusTarget `json:"targets"`
+}
+
+type StatsdConfig struct {
+	Enabled bool   `json:"enabled"`
+	Listen  string `json:"listen"`
+}
+
+// nil Enabled means enabled, 0 Interval means transfer.interval
+type CollectorSwitch struct {
+	Enabled  *bool `json:"enabled"`
+	Interval int   `json:"interval"`
+}
+
+// repeated values of the matched GAUGE metrics are not sent
+// until maxSilence seconds passed, see dedup.go
+type DedupConfig struct {
+	Enabled    bool     `json:"enabled"`
+	MaxSilence int64    `json:"maxSilence"` // seconds
+	Metrics    []string `json:"metrics"`    // regexps of the metric, all GAUGE metrics if empty
+}
+
+// conditions are regexps, an empty one matches everything,
+// see relabel.go for the actions
+type RelabelRule struct {
+	Action      string            `json:"action"`
+	Metric      string            `json:"metric"`
+	Endpoint    string            `json:"endpoint"`
+	Tags        map[string]string `json:"tags"`
+	Tag         string            `json:"tag"`
+	Replacement string            `json:"replacement"`
 }
 
 type GlobalConfig struct {
-	Debug         bool              `json:"debug"`
-	Hostname      string            `json:"hostname"`
-	IP            string            `json:"ip"`
-	Plugin        *PluginConfig     `json:"plugin"`
-	Heartbeat     *HeartbeatConfig  `json:"heartbeat"`
-	Transfer      *TransferConfig   `json:"transfer"`
-	Http          *HttpConfig       `json:"http"`
-	Collector     *CollectorConfig  `json:"collector"`
-	DefaultTags   map[string]string `json:"default_tags"`
-	IgnoreMetrics map[string]bool   `json:"ignore"`
+	Debug         bool                        `json:"debug"`
+	Hostname      string                      `json:"hostname"`
+	IP            string                      `json:"ip"`
+	Plugin        *PluginConfig               `json:"plugin"`
+	Heartbeat     *HeartbeatConfig            `json:"heartbeat"`
+	Upgrade       *UpgradeConfig              `json:"upgrade"`
+	Transfer      *TransferConfig             `json:"transfer"`
+	Spool         *SpoolConfig                `json:"spool"`
+	Http          *HttpConfig                 `json:"http"`
+	Run           *RunConfig                  `json:"run"`
+	Collector     *CollectorConfig            `json:"collector"`
+	Collectors    map[string]*CollectorSwitch `json:"collectors"`
+	Prometheus    *PrometheusConfig           `json:"prometheus"`
+	Statsd        *StatsdConfig               `json:"statsd"`
+	Services      *ServicesConfig             `json:"services"`
+	DefaultTags   map[string]string           `json:"default_tags"`
+	IgnoreMetrics map[string]bool             `json:"ignore"`
+	Relabel       []*RelabelRule              `json:"relabel"`
+	Dedup         *DedupConfig                `json:"dedup"`
 }
 
 var (
@@ -80,6 +202,41 @@ func Config() *GlobalConfig {
 	return config
 }
 
+// RedactedConfig is the config with the keys, tokens and passwords blanked, to be shown
+func RedactedConfig() *GlobalConfig {
+	c := *Config()
+	if c.Heartbeat != nil {
+		hb := *c.Heartbeat
+		hb.Token = ""
+		c.Heartbeat = &hb
+	}
+	if c.Transfer != nil {
+		t := *c.Transfer
+		t.Token = ""
+		c.Transfer = &t
+	}
+	if c.Run != nil {
+		run := *c.Run
+		run.Key = ""
+		c.Run = &run
+	}
+	if c.Services != nil {
+		services := *c.Services
+		if services.Redis != nil {
+			redis := *services.Redis
+			redis.Password = ""
+			services.Redis = &redis
+		}
+		if services.Mysql != nil {
+			mysql := *services.Mysql
+			mysql.Password = ""
+			services.Mysql = &mysql
+		}
+		c.Services = &services
+	}
+	return &c
+}
+
 func Hostname() (string, error) {
 	hostname := Config().Hostname
 	if hostname != "" {
@@ -123,21 +280,49 @@ func ParseConfig(cfg string) {
 
 	ConfigFile = cfg
 
+	if err := loadConfig(cfg); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// ReloadConfig reads ConfigFile again, the running config and rules are kept if it is bad
+func ReloadConfig() error {
+	if err := loadConfig(ConfigFile); err != nil {
+		log.Println("reload", err)
+		return err
+	}
+	return nil
+}
+
+func loadConfig(cfg string) error {
 	configContent, err := file.ToTrimString(cfg)
 	if err != nil {
-		log.Fatalln("read config file:", cfg, "fail:", err)
+		return fmt.Errorf("read config file: %s fail: %v", cfg, err)
 	}
 
 	var c GlobalConfig
 	err = json.Unmarshal([]byte(configContent), &c)
 	if err != nil {
-		log.Fatalln("parse config file:", cfg, "fail:", err)
+		return fmt.Errorf("parse config file: %s fail: %v", cfg, err)
+	}
+
+	rules, err := compileRelabelRules(c.Relabel)
+	if err != nil {
+		return fmt.Errorf("parse relabel rules in config file: %s fail: %v", cfg, err)
+	}
+
+	patterns, err := compileDedupMetrics(c.Dedup)
+	if err != nil {
+		return fmt.Errorf("parse dedup metrics in config file: %s fail: %v", cfg, err)
 	}
 
 	lock.Lock()
 	defer lock.Unlock()
 
 	config = &c
+	relabelRules = rules
+	dedupMetrics = patterns
 
 	log.Println("read config file:", cfg, "successfully")
+	return nil
 }
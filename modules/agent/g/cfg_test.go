@@ -0,0 +1,42 @@
+package g
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRedactedConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	ioutil.WriteFile(f.Name(), []byte(`{"hostname": "web1",
+		"heartbeat": {"addr": "hbs:6030", "token": "secret-hb"},
+		"transfer": {"addrs": ["transfer:8433"], "token": "secret-transfer"},
+		"run": {"key": "secret-run"},
+		"services": {"redis": {"password": "secret-redis"}, "mysql": {"user": "falcon", "password": "secret-mysql"}}}`), 0644)
+	ParseConfig(f.Name())
+
+	bs, err := json.Marshal(RedactedConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(bs), "secret") {
+		t.Errorf("expect the secrets blanked, but %s", bs)
+	}
+	if !strings.Contains(string(bs), "hbs:6030") || !strings.Contains(string(bs), "falcon") {
+		t.Errorf("expect the rest of the config kept, but %s", bs)
+	}
+
+	c := Config()
+	if c.Heartbeat.Token != "secret-hb" || c.Transfer.Token != "secret-transfer" || c.Run.Key != "secret-run" ||
+		c.Services.Redis.Password != "secret-redis" || c.Services.Mysql.Password != "secret-mysql" {
+		t.Errorf("expect the running config untouched, but %+v", c)
+	}
+}
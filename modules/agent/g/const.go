@@ -32,4 +32,29 @@ const (
 	NET_PORT_LISTEN  = "net.port.listen"
 	DU_BS            = "du.bs"
 	PROC_NUM         = "proc.num"
+	PROMETHEUS_UP    = "prometheus.up"
+	LOG_KEYWORD      = "log.keyword"
+	NET_PORT_CONNECT = "net.port.connect"
+	REDIS_UP         = "redis.up"
+	MYSQL_UP         = "mysql.up"
+	NGINX_UP         = "nginx.up"
+
+	// any strategy of these on port=N makes the agent report all of them for the port
+	NET_PORT_ESTABLISHED  = "net.port.established"
+	NET_PORT_TIME_WAIT    = "net.port.timewait"
+	NET_PORT_ACCEPT_QUEUE = "net.port.accept.queue"
+
+	// reported by every url.check.health strategy
+	URL_CHECK_STATUS           = "url.check.status"
+	URL_CHECK_LATENCY          = "url.check.latency"
+	URL_CHECK_DNS_TIME         = "url.check.dns.time"
+	URL_CHECK_CONNECT_TIME     = "url.check.connect.time"
+	URL_CHECK_TLS_TIME         = "url.check.tls.time"
+	URL_CHECK_TTFB             = "url.check.ttfb"
+	URL_CHECK_BODY_SIZE        = "url.check.body.size"
+	URL_CHECK_BODY_MATCH       = "url.check.body.match"
+	URL_CHECK_CERT_EXPIRE_DAYS = "url.check.cert.expire.days"
+
+	// the sample lines of a prometheus target skipped in a scrape
+	PROMETHEUS_PARSE_ERRORS = "prometheus.parse.errors"
 )
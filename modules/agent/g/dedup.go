@@ -0,0 +1,173 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package g
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/utils"
+)
+
+const DefaultDedupMaxSilence = 600 // seconds
+
+type dedupEntry struct {
+	value string
+	sent  int64 // timestamp of the last value sent
+	// the last value suppressed, sent before a changed value
+	// so that graph does not fill the silence with the new one
+	last *model.MetricValue
+}
+
+var (
+	// set with config in ParseConfig, nil matches none
+	dedupMetrics []*regexp.Regexp
+
+	// endpoint/metric/tags/step => *dedupEntry
+	dedupEntries   = make(map[string]*dedupEntry)
+	dedupLock      = new(sync.Mutex)
+	dedupLastClean int64
+)
+
+func compileDedupMetrics(c *DedupConfig) ([]*regexp.Regexp, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	ret := make([]*regexp.Regexp, 0, len(c.Metrics))
+	for _, s := range c.Metrics {
+		re, err := compileCondition(s)
+		if err != nil {
+			return nil, err
+		}
+		if re != nil {
+			ret = append(ret, re)
+		}
+	}
+	return ret, nil
+}
+
+func currDedup() (*DedupConfig, []*regexp.Regexp) {
+	lock.RLock()
+	defer lock.RUnlock()
+	return config.Dedup, dedupMetrics
+}
+
+func matchDedup(patterns []*regexp.Regexp, mv *model.MetricValue) bool {
+	if mv.Type != "GAUGE" || mv.Step <= 0 {
+		return false
+	}
+	for _, re := range patterns {
+		if re.MatchString(mv.Metric) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dedup drops the matched GAUGE values equal to the last one sent,
+// a value is sent anyway when it changed or maxSilence seconds passed.
+// The values sent carry the heartbeat so that graph and nodata wait for it,
+// they count as sent only after RecordDedup, once transfer accepts them.
+func Dedup(metrics []*model.MetricValue) []*model.MetricValue {
+	c, patterns := currDedup()
+	if c == nil || !c.Enabled {
+		return metrics
+	}
+
+	return dedup(metrics, patterns, dedupSilence(c), time.Now().Unix())
+}
+
+func dedupSilence(c *DedupConfig) int64 {
+	if c.MaxSilence <= 0 {
+		return DefaultDedupMaxSilence
+	}
+	return c.MaxSilence
+}
+
+// RecordDedup keeps the values accepted by transfer as the last ones sent,
+// a batch failed is deduplicated against the values sent before it
+func RecordDedup(metrics []*model.MetricValue) {
+	c, patterns := currDedup()
+	if c == nil || !c.Enabled {
+		return
+	}
+	recordDedup(metrics, patterns, time.Now().Unix())
+}
+
+func dedupKey(mv *model.MetricValue) string {
+	return fmt.Sprintf("%s/%s/%s/%d", mv.Endpoint, mv.Metric, utils.SortedTags(utils.DictedTagstring(mv.Tags)), mv.Step)
+}
+
+func dedupTimestamp(mv *model.MetricValue, now int64) int64 {
+	if mv.Timestamp <= 0 {
+		return now
+	}
+	return mv.Timestamp
+}
+
+func dedup(metrics []*model.MetricValue, patterns []*regexp.Regexp, silence int64, now int64) []*model.MetricValue {
+	dedupLock.Lock()
+	defer dedupLock.Unlock()
+
+	// forget the series not collected any more
+	if now-dedupLastClean > silence {
+		for key, e := range dedupEntries {
+			if now-e.sent > 2*silence {
+				delete(dedupEntries, key)
+			}
+		}
+		dedupLastClean = now
+	}
+
+	ret := make([]*model.MetricValue, 0, len(metrics))
+	for _, mv := range metrics {
+		if !matchDedup(patterns, mv) {
+			ret = append(ret, mv)
+			continue
+		}
+
+		mv.Heartbeat = silence
+		value := fmt.Sprint(mv.Value)
+
+		e, ok := dedupEntries[dedupKey(mv)]
+		if ok && e.value == value && dedupTimestamp(mv, now)-e.sent < silence {
+			e.last = mv
+			continue
+		}
+
+		if ok && e.last != nil && e.value != value {
+			ret = append(ret, e.last)
+		}
+		ret = append(ret, mv)
+	}
+	return ret
+}
+
+func recordDedup(metrics []*model.MetricValue, patterns []*regexp.Regexp, now int64) {
+	dedupLock.Lock()
+	defer dedupLock.Unlock()
+
+	// in order, the last value suppressed goes before the changed one
+	for _, mv := range metrics {
+		if !matchDedup(patterns, mv) {
+			continue
+		}
+		dedupEntries[dedupKey(mv)] = &dedupEntry{value: fmt.Sprint(mv.Value), sent: dedupTimestamp(mv, now)}
+	}
+}
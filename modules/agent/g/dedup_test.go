@@ -0,0 +1,63 @@
+package g
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+)
+
+func TestDedup(t *testing.T) {
+	defer func() { dedupEntries = make(map[string]*dedupEntry) }()
+
+	patterns := []*regexp.Regexp{regexp.MustCompile(`^(?:df\..*)$`)}
+	gauge := func(metric string, value interface{}, ts int64) *model.MetricValue {
+		return &model.MetricValue{Endpoint: "web1", Metric: metric, Value: value, Step: 60, Type: "GAUGE", Timestamp: ts}
+	}
+
+	rounds := []struct {
+		metrics []*model.MetricValue
+		expect  string
+	}{
+		{[]*model.MetricValue{gauge("df.used", 1, 60), gauge("cpu.idle", 1, 60)}, "[df.used/1/60 cpu.idle/1/60]"},
+		// unchanged
+		{[]*model.MetricValue{gauge("df.used", 1, 120), gauge("cpu.idle", 1, 120)}, "[cpu.idle/1/120]"},
+		{[]*model.MetricValue{gauge("df.used", 1, 180)}, "[]"},
+		// changed, the last suppressed value goes first
+		{[]*model.MetricValue{gauge("df.used", 2, 240)}, "[df.used/1/180 df.used/2/240]"},
+		{[]*model.MetricValue{gauge("df.used", 2, 300)}, "[]"},
+		// silent for too long
+		{[]*model.MetricValue{gauge("df.used", 2, 540)}, "[df.used/2/540]"},
+	}
+
+	for i, r := range rounds {
+		got := []string{}
+		sent := dedup(r.metrics, patterns, 300, 0)
+		recordDedup(sent, patterns, 0)
+		for _, mv := range sent {
+			got = append(got, fmt.Sprintf("%s/%v/%d", mv.Metric, mv.Value, mv.Timestamp))
+			if mv.Metric == "df.used" && mv.Heartbeat != 300 {
+				t.Errorf("round %d: expect heartbeat 300, but %d", i, mv.Heartbeat)
+			}
+		}
+		if fmt.Sprint(got) != r.expect {
+			t.Errorf("round %d: expect %s, but %v", i, r.expect, got)
+		}
+	}
+
+	// a batch failed is not recorded, the changed value is sent again
+	if got := dedup([]*model.MetricValue{gauge("df.used", 3, 600)}, patterns, 300, 0); len(got) != 1 {
+		t.Errorf("expect df.used/3 sent, but %d", len(got))
+	}
+	if got := dedup([]*model.MetricValue{gauge("df.used", 3, 660)}, patterns, 300, 0); len(got) != 1 || got[0].Timestamp != 660 {
+		t.Errorf("expect df.used/3 sent again after a failure, but %v", got)
+	}
+
+	// no pattern matches nothing
+	for i := 0; i < 2; i++ {
+		if got := dedup([]*model.MetricValue{gauge("cpu.idle", 1, 600)}, nil, 300, 0); len(got) != 1 {
+			t.Errorf("expect cpu.idle sent every time, but %d", len(got))
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package g
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/utils"
+)
+
+const (
+	// a series not sent for this many steps is forgotten,
+	// a deduplicated one is kept at least till its next value is due
+	lastValueSteps = 10
+	// the cache is cleaned at most once in
+	lastValueCleanInterval = 60 // seconds
+)
+
+// LastValue is the last value of a series sent to transfer
+type LastValue struct {
+	Endpoint  string      `json:"endpoint"`
+	Metric    string      `json:"metric"`
+	Tags      string      `json:"tags"`
+	Type      string      `json:"counterType"`
+	Step      int64       `json:"step"`
+	Value     interface{} `json:"value"`
+	Timestamp int64       `json:"timestamp"`
+	Updated   int64       `json:"updated"` // unix time it was sent
+
+	silence int64 // dedup maxSilence of the series, 0 if not deduplicated
+}
+
+var (
+	// endpoint/metric/sorted tags => *LastValue
+	lastValues          = make(map[string]*LastValue)
+	lastValuesLock      = new(sync.RWMutex)
+	lastValuesLastClean int64
+)
+
+// RecordLastValues keeps the last value of every series sent to transfer, including plugin and pushed ones,
+// a value suppressed by dedup or waiting in the spool is not sent yet
+func RecordLastValues(metrics []*model.MetricValue) {
+	var patterns []*regexp.Regexp
+	var silence int64
+	if c, p := currDedup(); c != nil && c.Enabled {
+		patterns, silence = p, dedupSilence(c)
+	}
+	recordLastValues(metrics, patterns, silence, time.Now().Unix())
+}
+
+func recordLastValues(metrics []*model.MetricValue, patterns []*regexp.Regexp, silence int64, now int64) {
+	lastValuesLock.Lock()
+	defer lastValuesLock.Unlock()
+
+	for _, mv := range metrics {
+		tags := utils.SortedTags(utils.DictedTagstring(mv.Tags))
+		var s int64
+		if matchDedup(patterns, mv) {
+			s = silence
+		}
+		lastValues[mv.Endpoint+"/"+mv.Metric+"/"+tags] = &LastValue{
+			Endpoint:  mv.Endpoint,
+			Metric:    mv.Metric,
+			Tags:      tags,
+			Type:      mv.Type,
+			Step:      mv.Step,
+			Value:     mv.Value,
+			Timestamp: mv.Timestamp,
+			Updated:   now,
+			silence:   s,
+		}
+	}
+
+	if now-lastValuesLastClean < lastValueCleanInterval {
+		return
+	}
+	for key, v := range lastValues {
+		step := v.Step
+		if step <= 0 {
+			step = lastValueCleanInterval
+		}
+		keep := lastValueSteps * step
+		if v.silence+step > keep {
+			keep = v.silence + step
+		}
+		if now-v.Updated > keep {
+			delete(lastValues, key)
+		}
+	}
+	lastValuesLastClean = now
+}
+
+// LastValues returns the series whose metric starts with prefix and which have all the tags,
+// an empty endpoint matches every endpoint
+func LastValues(prefix string, endpoint string, tags map[string]string) []*LastValue {
+	lastValuesLock.RLock()
+	defer lastValuesLock.RUnlock()
+
+	ret := []*LastValue{}
+	for _, v := range lastValues {
+		if !strings.HasPrefix(v.Metric, prefix) {
+			continue
+		}
+		if endpoint != "" && v.Endpoint != endpoint {
+			continue
+		}
+		if len(tags) > 0 && !hasTags(utils.DictedTagstring(v.Tags), tags) {
+			continue
+		}
+		lv := *v
+		ret = append(ret, &lv)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Metric != ret[j].Metric {
+			return ret[i].Metric < ret[j].Metric
+		}
+		if ret[i].Endpoint != ret[j].Endpoint {
+			return ret[i].Endpoint < ret[j].Endpoint
+		}
+		return ret[i].Tags < ret[j].Tags
+	})
+	return ret
+}
+
+func hasTags(tags map[string]string, expected map[string]string) bool {
+	for k, v := range expected {
+		if tv, ok := tags[k]; !ok || tv != v {
+			return false
+		}
+	}
+	return true
+}
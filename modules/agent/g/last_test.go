@@ -0,0 +1,88 @@
+package g
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+)
+
+func TestLastValues(t *testing.T) {
+	defer func() { lastValues = make(map[string]*LastValue) }()
+
+	RecordLastValues([]*model.MetricValue{
+		{Endpoint: "web1", Metric: "df.bytes.free", Tags: "mount=/,fstype=ext4", Value: 1, Step: 60, Type: "GAUGE"},
+		{Endpoint: "web1", Metric: "df.bytes.free", Tags: "fstype=xfs,mount=/data", Value: 2, Step: 60, Type: "GAUGE"},
+		{Endpoint: "web1", Metric: "cpu.idle", Value: 3, Step: 60, Type: "GAUGE"},
+		{Endpoint: "app1", Metric: "df.bytes.free", Tags: "mount=/", Value: 4, Step: 60, Type: "GAUGE"},
+	})
+	RecordLastValues([]*model.MetricValue{
+		{Endpoint: "web1", Metric: "df.bytes.free", Tags: "fstype=ext4,mount=/", Value: 5, Step: 60, Type: "GAUGE"},
+	})
+
+	cases := []struct {
+		prefix   string
+		endpoint string
+		tags     map[string]string
+		expect   string
+	}{
+		{"", "", nil, "[web1/cpu.idle//3 app1/df.bytes.free/mount=//4 web1/df.bytes.free/fstype=ext4,mount=//5 web1/df.bytes.free/fstype=xfs,mount=/data/2]"},
+		{"df.", "web1", nil, "[web1/df.bytes.free/fstype=ext4,mount=//5 web1/df.bytes.free/fstype=xfs,mount=/data/2]"},
+		{"df.", "", map[string]string{"mount": "/"}, "[app1/df.bytes.free/mount=//4 web1/df.bytes.free/fstype=ext4,mount=//5]"},
+		{"mem.", "", nil, "[]"},
+	}
+	for _, c := range cases {
+		got := []string{}
+		for _, v := range LastValues(c.prefix, c.endpoint, c.tags) {
+			got = append(got, fmt.Sprintf("%s/%s/%s/%v", v.Endpoint, v.Metric, v.Tags, v.Value))
+		}
+		if fmt.Sprint(got) != c.expect {
+			t.Errorf("%s %s %v: expect %s, but %v", c.prefix, c.endpoint, c.tags, c.expect, got)
+		}
+	}
+}
+
+func TestLastValuesNotSent(t *testing.T) {
+	defer func() { lastValues = make(map[string]*LastValue) }()
+
+	f, err := ioutil.TempFile("", "cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	// no transfer accepts it
+	ioutil.WriteFile(f.Name(), []byte(`{"hostname": "web1", "transfer": {"enabled": true, "addrs": []}}`), 0644)
+	ParseConfig(f.Name())
+
+	SendToTransfer([]*model.MetricValue{{Endpoint: "web1", Metric: "cpu.idle", Value: 3, Step: 60, Type: "GAUGE"}})
+	if L := LastValues("", "", nil); len(L) != 0 {
+		t.Errorf("expect nothing recorded, but %v", L)
+	}
+}
+
+func TestLastValuesDedupKept(t *testing.T) {
+	defer func() { lastValues = make(map[string]*LastValue) }()
+	lastValuesLastClean = 0
+
+	patterns := []*regexp.Regexp{regexp.MustCompile(`^(?:df\..*)$`)}
+	recordLastValues([]*model.MetricValue{
+		{Endpoint: "web1", Metric: "df.bytes.free", Value: 1, Step: 60, Type: "GAUGE"},
+		{Endpoint: "web1", Metric: "cpu.idle", Value: 2, Step: 60, Type: "GAUGE"},
+	}, patterns, 1200, 1000)
+
+	// 11 steps later, the deduplicated series waits for its next value
+	recordLastValues(nil, patterns, 1200, 1000+660)
+	if L := LastValues("", "", nil); len(L) != 1 || L[0].Metric != "df.bytes.free" {
+		t.Errorf("expect df.bytes.free kept, but %v", L)
+	}
+
+	recordLastValues(nil, patterns, 1200, 1000+1261)
+	if L := LastValues("", "", nil); len(L) != 0 {
+		t.Errorf("expect df.bytes.free forgotten, but %v", L)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package g
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/utils"
+)
+
+// relabel actions, applied in order to every metric sent to transfer
+const (
+	RelabelDrop       = "drop"        // drop the matched metric
+	RelabelRename     = "rename"      // metric = replacement, $1 refers to the metric condition
+	RelabelAddTag     = "add_tag"     // tag = replacement unless the tag exists
+	RelabelReplaceTag = "replace_tag" // tag = replacement, $1 refers to the condition of the tag
+	RelabelRemoveTag  = "remove_tag"  // remove the tag
+	RelabelEndpoint   = "endpoint"    // endpoint = replacement, $1 refers to the endpoint condition
+	RelabelType       = "type"        // counterType = replacement
+)
+
+type relabelRule struct {
+	*RelabelRule
+	metric   *regexp.Regexp
+	endpoint *regexp.Regexp
+	tags     map[string]*regexp.Regexp
+}
+
+// set with config in ParseConfig
+var relabelRules []*relabelRule
+
+func currRelabelRules() []*relabelRule {
+	lock.RLock()
+	defer lock.RUnlock()
+	return relabelRules
+}
+
+func compileRelabelRules(rules []*RelabelRule) ([]*relabelRule, error) {
+	ret := make([]*relabelRule, 0, len(rules))
+	for i, r := range rules {
+		switch r.Action {
+		case RelabelDrop, RelabelRename, RelabelEndpoint:
+		case RelabelAddTag, RelabelReplaceTag, RelabelRemoveTag:
+			if r.Tag == "" {
+				return nil, fmt.Errorf("rule %d: tag is required by %s", i, r.Action)
+			}
+		case RelabelType:
+			if r.Replacement != "GAUGE" && r.Replacement != "COUNTER" && r.Replacement != "DERIVE" {
+				return nil, fmt.Errorf("rule %d: bad counterType %s", i, r.Replacement)
+			}
+		default:
+			return nil, fmt.Errorf("rule %d: unknown action %s", i, r.Action)
+		}
+
+		rule := &relabelRule{RelabelRule: r, tags: make(map[string]*regexp.Regexp)}
+		var err error
+		if rule.metric, err = compileCondition(r.Metric); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		if rule.endpoint, err = compileCondition(r.Endpoint); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		for k, v := range r.Tags {
+			if rule.tags[k], err = compileCondition(v); err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i, err)
+			}
+		}
+		ret = append(ret, rule)
+	}
+	return ret, nil
+}
+
+// the whole value has to match
+func compileCondition(s string) (*regexp.Regexp, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + s + ")$")
+}
+
+// Relabel applies the rules and returns the metrics left
+func Relabel(metrics []*model.MetricValue) []*model.MetricValue {
+	rules := currRelabelRules()
+	if len(rules) == 0 {
+		return metrics
+	}
+
+	ret := metrics[:0]
+	for _, mv := range metrics {
+		if relabel(rules, mv) {
+			ret = append(ret, mv)
+		}
+	}
+	return ret
+}
+
+func relabel(rules []*relabelRule, mv *model.MetricValue) bool {
+	var tags map[string]string
+	changed := false
+
+	for _, r := range rules {
+		if r.metric != nil && !r.metric.MatchString(mv.Metric) {
+			continue
+		}
+		if r.endpoint != nil && !r.endpoint.MatchString(mv.Endpoint) {
+			continue
+		}
+
+		if len(r.tags) > 0 || r.Tag != "" {
+			if tags == nil {
+				tags = utils.DictedTagstring(mv.Tags)
+			}
+			if !matchTags(r.tags, tags) {
+				continue
+			}
+		}
+
+		switch r.Action {
+		case RelabelDrop:
+			return false
+		case RelabelRename:
+			mv.Metric = replace(r.metric, mv.Metric, r.Replacement)
+		case RelabelEndpoint:
+			mv.Endpoint = replace(r.endpoint, mv.Endpoint, r.Replacement)
+		case RelabelType:
+			mv.Type = r.Replacement
+		case RelabelAddTag:
+			if _, ok := tags[r.Tag]; !ok {
+				tags[r.Tag] = r.Replacement
+				changed = true
+			}
+		case RelabelReplaceTag:
+			if v, ok := tags[r.Tag]; ok {
+				tags[r.Tag] = replace(r.tags[r.Tag], v, r.Replacement)
+				changed = true
+			}
+		case RelabelRemoveTag:
+			if _, ok := tags[r.Tag]; ok {
+				delete(tags, r.Tag)
+				changed = true
+			}
+		}
+	}
+
+	if changed {
+		mv.Tags = utils.SortedTags(tags)
+	}
+	return true
+}
+
+func matchTags(conds map[string]*regexp.Regexp, tags map[string]string) bool {
+	for k, re := range conds {
+		v, ok := tags[k]
+		if !ok {
+			return false
+		}
+		if re != nil && !re.MatchString(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func replace(re *regexp.Regexp, src string, replacement string) string {
+	if re == nil || !strings.Contains(replacement, "$") {
+		return replacement
+	}
+	return re.ReplaceAllString(src, replacement)
+}
@@ -0,0 +1,80 @@
+package g
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+)
+
+func TestRelabel(t *testing.T) {
+	rules, err := compileRelabelRules([]*RelabelRule{
+		{Action: RelabelDrop, Metric: `debug\..*`},
+		{Action: RelabelDrop, Tags: map[string]string{"env": "test"}},
+		{Action: RelabelRename, Metric: `app_(.*)_total`, Replacement: "app.$1"},
+		{Action: RelabelRemoveTag, Metric: `app\..*`, Tag: "request_id"},
+		{Action: RelabelReplaceTag, Tag: "host", Tags: map[string]string{"host": `(\w+)\.example\.com`}, Replacement: "$1"},
+		{Action: RelabelAddTag, Tag: "dc", Replacement: "bj"},
+		{Action: RelabelType, Metric: `app\.requests`, Replacement: "COUNTER"},
+		{Action: RelabelEndpoint, Endpoint: `(.*)-docker`, Replacement: "$1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	relabelRules = rules
+	defer func() { relabelRules = nil }()
+
+	metrics := []*model.MetricValue{
+		{Endpoint: "web1", Metric: "debug.gc", Type: "GAUGE"},
+		{Endpoint: "web1", Metric: "cpu.idle", Tags: "env=test", Type: "GAUGE"},
+		{Endpoint: "web1-docker", Metric: "app_requests_total", Tags: "request_id=1,host=web1.example.com", Type: "GAUGE"},
+		{Endpoint: "web1", Metric: "cpu.idle", Tags: "dc=sh", Type: "GAUGE"},
+	}
+
+	got := []string{}
+	for _, mv := range Relabel(metrics) {
+		got = append(got, fmt.Sprintf("%s/%s/%s/%s", mv.Endpoint, mv.Metric, mv.Tags, mv.Type))
+	}
+
+	expect := "[web1/app.requests/dc=bj,host=web1/COUNTER web1/cpu.idle/dc=sh/GAUGE]"
+	if fmt.Sprint(got) != expect {
+		t.Errorf("expect %s, but %v", expect, got)
+	}
+}
+
+func TestCompileRelabelRules(t *testing.T) {
+	bad := [][]*RelabelRule{
+		{{Action: "unknown"}},
+		{{Action: RelabelAddTag}},
+		{{Action: RelabelType, Replacement: "gauge"}},
+		{{Action: RelabelDrop, Metric: "("}},
+	}
+	for _, rules := range bad {
+		if _, err := compileRelabelRules(rules); err == nil {
+			t.Errorf("expect error for %+v", rules[0])
+		}
+	}
+}
+
+func TestReloadBadRelabelRule(t *testing.T) {
+	f, err := ioutil.TempFile("", "cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	ioutil.WriteFile(f.Name(), []byte(`{"hostname": "good", "relabel": [{"action": "drop", "metric": "debug\\..*"}]}`), 0644)
+	ParseConfig(f.Name())
+	defer func() { relabelRules = nil }()
+
+	ioutil.WriteFile(f.Name(), []byte(`{"hostname": "bad", "relabel": [{"action": "drop", "metric": "debug\\..*("}]}`), 0644)
+	if err := ReloadConfig(); err == nil {
+		t.Error("expect the bad rule rejected")
+	}
+	if Config().Hostname != "good" || len(currRelabelRules()) != 1 {
+		t.Errorf("expect the running config kept, but %s", Config().Hostname)
+	}
+}
@@ -15,20 +15,27 @@
 package g
 
 import (
+	"crypto/tls"
 	"errors"
+	"github.com/open-falcon/falcon-plus/common/model"
 	"github.com/toolkits/net"
 	"log"
 	"math"
+	gonet "net"
 	"net/rpc"
+	"net/rpc/jsonrpc"
 	"sync"
 	"time"
 )
 
 type SingleConnRpcClient struct {
 	sync.Mutex
-	rpcClient *rpc.Client
-	RpcServer string
-	Timeout   time.Duration
+	rpcClient  *rpc.Client
+	RpcServer  string
+	Timeout    time.Duration
+	TLS        *tls.Config        // plain tcp if nil
+	AuthMethod string             // e.g. Transfer.Auth, called first on every connection
+	Auth       *model.AuthRequest // nil if the server needs no credential
 }
 
 func (this *SingleConnRpcClient) close() {
@@ -51,7 +58,7 @@ func (this *SingleConnRpcClient) serverConn() error {
 			return nil
 		}
 
-		this.rpcClient, err = net.JsonRpcClient("tcp", this.RpcServer, this.Timeout)
+		this.rpcClient, err = this.dial()
 		if err != nil {
 			log.Printf("dial %s fail: %v", this.RpcServer, err)
 			if retry > 3 {
@@ -65,6 +72,36 @@ func (this *SingleConnRpcClient) serverConn() error {
 	}
 }
 
+func (this *SingleConnRpcClient) dial() (*rpc.Client, error) {
+	if this.TLS == nil && this.Auth == nil {
+		return net.JsonRpcClient("tcp", this.RpcServer, this.Timeout)
+	}
+
+	var conn gonet.Conn
+	var err error
+	if this.TLS != nil {
+		conn, err = tls.DialWithDialer(&gonet.Dialer{Timeout: this.Timeout}, "tcp", this.RpcServer, this.TLS)
+	} else {
+		conn, err = gonet.DialTimeout("tcp", this.RpcServer, this.Timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client := jsonrpc.NewClient(conn)
+	if this.Auth != nil {
+		var resp model.SimpleRpcResponse
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		err = client.Call(this.AuthMethod, this.Auth, &resp)
+		conn.SetDeadline(time.Time{})
+		if err != nil {
+			client.Close()
+			return nil, errors.New(this.AuthMethod + " fail: " + err.Error())
+		}
+	}
+	return client, nil
+}
+
 func (this *SingleConnRpcClient) Call(method string, args interface{}, reply interface{}) error {
 
 	this.Lock()
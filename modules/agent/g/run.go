@@ -0,0 +1,319 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package g
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/toolkits/sys"
+)
+
+const (
+	DefaultRunTimeout   = 10 // seconds
+	DefaultRunMaxOutput = 64 * 1024
+	DefaultRunMaxSkew   = 300 // seconds
+)
+
+// RunRequest is the json body of /run, either a named command or a signed shell line
+type RunRequest struct {
+	Command   string            `json:"command"`
+	Params    map[string]string `json:"params"`
+	Shell     string            `json:"shell"`
+	Timestamp int64             `json:"timestamp"`
+}
+
+type RunResult struct {
+	ExitCode  int    `json:"exitCode"`
+	Output    string `json:"output"`
+	Truncated bool   `json:"truncated"`
+	Timeout   bool   `json:"timeout"`
+	Duration  int64  `json:"duration"` // ms
+}
+
+// RunAudit is one line of the audit log
+type RunAudit struct {
+	Time      string   `json:"time"`
+	Caller    string   `json:"caller"`
+	Signed    bool     `json:"signed"`
+	Command   string   `json:"command"`
+	Args      []string `json:"args"`
+	ExitCode  int      `json:"exitCode"`
+	Duration  int64    `json:"duration"` // ms
+	Timeout   bool     `json:"timeout"`
+	Truncated bool     `json:"truncated"`
+	Error     string   `json:"error,omitempty"`
+}
+
+var (
+	// signature => timestamp, rejects replayed requests within the skew
+	runSignatures     = make(map[string]int64)
+	runSignaturesLock = new(sync.Mutex)
+
+	auditLock = new(sync.Mutex)
+)
+
+// Run checks the request, executes the command and writes the audit log.
+// With a key configured every request has to be signed and may come from anywhere,
+// without one only the allowed commands run for the trustable ips.
+func Run(cfg *RunConfig, caller string, body []byte, signature string) (*RunResult, error) {
+	audit := &RunAudit{Caller: caller, ExitCode: -1}
+	result, err := run(cfg, caller, body, signature, audit)
+	if err != nil {
+		audit.Error = err.Error()
+	}
+	AuditRun(cfg, audit)
+	return result, err
+}
+
+func run(cfg *RunConfig, caller string, body []byte, signature string, audit *RunAudit) (*RunResult, error) {
+	var req RunRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("bad request: %v", err)
+	}
+	audit.Command = req.Command
+	if req.Shell != "" {
+		audit.Command = "shell"
+		audit.Args = []string{req.Shell}
+	}
+
+	if cfg.Key != "" {
+		if err := verifyRunRequest(cfg, &req, body, signature, time.Now()); err != nil {
+			return nil, err
+		}
+		audit.Signed = true
+	} else if !IsTrustable(caller) {
+		return nil, errors.New("no privilege")
+	}
+
+	args, timeout, maxOutput, err := ResolveRunCommand(cfg, &req, audit.Signed)
+	if err != nil {
+		return nil, err
+	}
+	audit.Args = args
+
+	result, err := ExecCommand(args, timeout, maxOutput)
+	if result != nil {
+		audit.ExitCode = result.ExitCode
+		audit.Duration = result.Duration
+		audit.Timeout = result.Timeout
+		audit.Truncated = result.Truncated
+	}
+	return result, err
+}
+
+func verifyRunRequest(cfg *RunConfig, req *RunRequest, body []byte, signature string, now time.Time) error {
+	// hex is case insensitive, the replay check is not
+	signature = strings.ToLower(signature)
+	if !VerifyRunSignature(cfg.Key, body, signature) {
+		return errors.New("bad signature")
+	}
+
+	skew := int64(cfg.MaxSkew)
+	if skew <= 0 {
+		skew = DefaultRunMaxSkew
+	}
+	ts := now.Unix()
+	if req.Timestamp < ts-skew || req.Timestamp > ts+skew {
+		return errors.New("timestamp out of range")
+	}
+
+	runSignaturesLock.Lock()
+	defer runSignaturesLock.Unlock()
+	for s, t := range runSignatures {
+		if t < ts-skew {
+			delete(runSignatures, s)
+		}
+	}
+	if _, ok := runSignatures[signature]; ok {
+		return errors.New("replayed request")
+	}
+	runSignatures[signature] = req.Timestamp
+	return nil
+}
+
+// SignRunRequest returns the hex hmac-sha256 of the body, sent in the X-Signature header
+func SignRunRequest(key string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func VerifyRunSignature(key string, body []byte, signature string) bool {
+	expected := SignRunRequest(key, body)
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(signature)))
+}
+
+// ResolveRunCommand returns the argv, the timeout and the output limit of the request
+func ResolveRunCommand(cfg *RunConfig, req *RunRequest, signed bool) ([]string, time.Duration, int, error) {
+	timeout, maxOutput := cfg.Timeout, cfg.MaxOutput
+	if timeout <= 0 {
+		timeout = DefaultRunTimeout
+	}
+	if maxOutput <= 0 {
+		maxOutput = DefaultRunMaxOutput
+	}
+
+	if req.Shell != "" {
+		if !signed {
+			return nil, 0, 0, errors.New("shell commands have to be signed")
+		}
+		return []string{"sh", "-c", req.Shell}, time.Duration(timeout) * time.Second, maxOutput, nil
+	}
+
+	c, ok := cfg.Commands[req.Command]
+	if !ok || len(c.Args) == 0 {
+		return nil, 0, 0, fmt.Errorf("command %s not allowed", req.Command)
+	}
+
+	for name := range req.Params {
+		if _, ok := c.Params[name]; !ok {
+			return nil, 0, 0, fmt.Errorf("unknown param %s", name)
+		}
+	}
+
+	oldnew := []string{}
+	for name, pattern := range c.Params {
+		value, ok := req.Params[name]
+		if !ok {
+			return nil, 0, 0, fmt.Errorf("param %s is required", name)
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("bad pattern of param %s: %v", name, err)
+		}
+		if !re.MatchString(value) {
+			return nil, 0, 0, fmt.Errorf("bad value of param %s", name)
+		}
+		oldnew = append(oldnew, "${"+name+"}", value)
+	}
+
+	replacer := strings.NewReplacer(oldnew...)
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = replacer.Replace(arg)
+	}
+
+	if c.Timeout > 0 {
+		timeout = c.Timeout
+	}
+	if c.MaxOutput > 0 {
+		maxOutput = c.MaxOutput
+	}
+	return args, time.Duration(timeout) * time.Second, maxOutput, nil
+}
+
+// limitedBuffer keeps the first max bytes and discards the rest
+type limitedBuffer struct {
+	sync.Mutex
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	left := b.max - len(b.buf)
+	if len(p) > left {
+		b.buf = append(b.buf, p[:left]...)
+		b.truncated = true
+	} else {
+		b.buf = append(b.buf, p...)
+	}
+	return len(p), nil
+}
+
+// the killed process may still be writing after a timeout
+func (b *limitedBuffer) Result() (string, bool) {
+	b.Lock()
+	defer b.Unlock()
+	return string(b.buf), b.truncated
+}
+
+// ExecCommand runs argv without a shell, the process group is killed on timeout
+func ExecCommand(args []string, timeout time.Duration, maxOutput int) (*RunResult, error) {
+	out := &limitedBuffer{max: maxOutput}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("exec fail: %v", err)
+	}
+
+	err, isTimeout := sys.CmdRunWithTimeout(cmd, timeout)
+	result := &RunResult{
+		Timeout:  isTimeout,
+		Duration: int64(time.Since(start) / time.Millisecond),
+	}
+
+	if isTimeout {
+		result.ExitCode = -1
+	} else if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, fmt.Errorf("exec fail: %v", err)
+		}
+		result.ExitCode = exitErr.Sys().(syscall.WaitStatus).ExitStatus()
+	}
+
+	result.Output, result.Truncated = out.Result()
+	return result, nil
+}
+
+// AuditRun appends the json line to run.auditLog, or to the log without one
+func AuditRun(cfg *RunConfig, a *RunAudit) {
+	a.Time = time.Now().Format(time.RFC3339)
+	bs, err := json.Marshal(a)
+	if err != nil {
+		log.Println("marshal audit fail:", err)
+		return
+	}
+
+	if cfg == nil || cfg.AuditLog == "" {
+		log.Println("[AUDIT]", string(bs))
+		return
+	}
+
+	auditLock.Lock()
+	defer auditLock.Unlock()
+
+	// opened every time so that the log can be rotated
+	f, err := os.OpenFile(cfg.AuditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		log.Println("open audit log fail:", err, string(bs))
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(bs, '\n')); err != nil {
+		log.Println("write audit log fail:", err, string(bs))
+	}
+}
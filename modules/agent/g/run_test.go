@@ -0,0 +1,111 @@
+package g
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveRunCommand(t *testing.T) {
+	cfg := &RunConfig{
+		Commands: map[string]*AllowedCommand{
+			"restart": {
+				Args:    []string{"systemctl", "restart", "${service}"},
+				Params:  map[string]string{"service": "[a-z]+"},
+				Timeout: 30,
+			},
+		},
+	}
+
+	args, timeout, maxOutput, err := ResolveRunCommand(cfg, &RunRequest{Command: "restart", Params: map[string]string{"service": "nginx"}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(args) != "[systemctl restart nginx]" || timeout != 30*time.Second || maxOutput != DefaultRunMaxOutput {
+		t.Errorf("unexpected %v %v %d", args, timeout, maxOutput)
+	}
+
+	bad := []*RunRequest{
+		{Command: "rm"},
+		{Command: "restart"},
+		{Command: "restart", Params: map[string]string{"service": "nginx; rm -rf /"}},
+		{Command: "restart", Params: map[string]string{"service": "nginx", "extra": "x"}},
+		{Shell: "uptime"},
+	}
+	for _, req := range bad {
+		if _, _, _, err := ResolveRunCommand(cfg, req, false); err == nil {
+			t.Errorf("expect error for %+v", req)
+		}
+	}
+
+	if _, _, _, err := ResolveRunCommand(cfg, &RunRequest{Shell: "uptime"}, true); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExecCommand(t *testing.T) {
+	result, err := ExecCommand([]string{"sh", "-c", "echo 0123456789; exit 3"}, time.Second, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 3 || result.Output != "0123" || !result.Truncated || result.Timeout {
+		t.Errorf("unexpected %+v", result)
+	}
+
+	result, err = ExecCommand([]string{"sleep", "5"}, 100*time.Millisecond, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Timeout || result.ExitCode != -1 {
+		t.Errorf("unexpected %+v", result)
+	}
+}
+
+func TestRunSigned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &RunConfig{Key: "secret", AuditLog: filepath.Join(dir, "audit.log")}
+	body := []byte(fmt.Sprintf(`{"shell":"echo hi","timestamp":%d}`, time.Now().Unix()))
+	signature := SignRunRequest(cfg.Key, body)
+
+	if _, err := Run(cfg, "10.0.0.1:1234", body, "bad"); err == nil {
+		t.Error("expect bad signature")
+	}
+
+	result, err := Run(cfg, "10.0.0.1:1234", body, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Output != "hi\n" {
+		t.Errorf("unexpected %+v", result)
+	}
+
+	if _, err := Run(cfg, "10.0.0.1:1234", body, signature); err == nil {
+		t.Error("expect replayed request")
+	}
+	if _, err := Run(cfg, "10.0.0.1:1234", body, strings.ToUpper(signature)); err == nil || err.Error() != "replayed request" {
+		t.Errorf("expect replayed request for the signature in upper case, but %v", err)
+	}
+
+	old := []byte(fmt.Sprintf(`{"shell":"echo hi","timestamp":%d}`, time.Now().Unix()-3600))
+	if _, err := Run(cfg, "10.0.0.1:1234", old, SignRunRequest(cfg.Key, old)); err == nil {
+		t.Error("expect timestamp out of range")
+	}
+
+	bs, err := ioutil.ReadFile(cfg.AuditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(bs)), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[1], `"caller":"10.0.0.1:1234","signed":true,"command":"shell","args":["sh","-c","echo hi"],"exitCode":0`) {
+		t.Errorf("unexpected audit log %s", bs)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package g
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/toolkits/file"
+)
+
+const spoolFileExt = ".spool"
+
+// Spool keeps the batches which can not be sent to transfer on disk,
+// one file per batch, named by the spooled time in nanoseconds.
+type Spool struct {
+	sync.RWMutex
+	dir     string
+	maxSize int64 // bytes
+	maxAge  int64 // seconds
+	files   []string
+	sizes   map[string]int64
+	size    int64
+	last    int64
+
+	spooled       int64
+	replayed      int64
+	droppedBySize int64
+	droppedByAge  int64
+}
+
+var TransferSpool *Spool
+
+func InitSpool() {
+	cfg := Config().Spool
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+
+	s, err := NewSpool(cfg.Dir, cfg.MaxSize*1024*1024, cfg.MaxAge)
+	if err != nil {
+		log.Fatalln("init spool in", cfg.Dir, "fail:", err)
+	}
+
+	TransferSpool = s
+	log.Printf("spool %s initialized, %d batches left", cfg.Dir, s.Depth())
+}
+
+func NewSpool(dir string, maxSize int64, maxAge int64) (*Spool, error) {
+	if err := file.InsureDir(dir); err != nil {
+		return nil, err
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Spool{dir: dir, maxSize: maxSize, maxAge: maxAge, sizes: make(map[string]int64)}
+	// batches left by the last run are replayed as well
+	for _, fi := range fis {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), spoolFileExt) {
+			continue
+		}
+		s.files = append(s.files, fi.Name())
+		s.sizes[fi.Name()] = fi.Size()
+		s.size += fi.Size()
+	}
+	sort.Strings(s.files)
+
+	return s, nil
+}
+
+func (this *Spool) Depth() int {
+	this.RLock()
+	defer this.RUnlock()
+	return len(this.files)
+}
+
+func (this *Spool) Stats() map[string]interface{} {
+	this.RLock()
+	defer this.RUnlock()
+	return map[string]interface{}{
+		"depth":         len(this.files),
+		"bytes":         this.size,
+		"spooled":       this.spooled,
+		"replayed":      this.replayed,
+		"droppedBySize": this.droppedBySize,
+		"droppedByAge":  this.droppedByAge,
+	}
+}
+
+func (this *Spool) Put(metrics []*model.MetricValue) error {
+	bs, err := json.Marshal(metrics)
+	if err != nil {
+		return err
+	}
+
+	this.Lock()
+	defer this.Unlock()
+
+	now := time.Now().UnixNano()
+	if now <= this.last {
+		now = this.last + 1
+	}
+	this.last = now
+
+	name := fmt.Sprintf("%019d%s", now, spoolFileExt)
+	if _, err = file.WriteBytes(filepath.Join(this.dir, name), bs); err != nil {
+		return err
+	}
+
+	this.files = append(this.files, name)
+	this.sizes[name] = int64(len(bs))
+	this.size += int64(len(bs))
+	this.spooled++
+
+	// keep the newest batch even if it is larger than maxSize
+	for this.maxSize > 0 && this.size > this.maxSize && len(this.files) > 1 {
+		this.removeOldest()
+		this.droppedBySize++
+	}
+
+	return nil
+}
+
+// Replay sends the oldest batch to transfer,
+// return false when the spool is empty or transfer is still unreachable
+func (this *Spool) Replay() bool {
+	name, ok := this.oldest()
+	if !ok {
+		return false
+	}
+
+	fpath := filepath.Join(this.dir, name)
+	bs, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		log.Println("read spool file", fpath, "fail:", err)
+		this.remove(name)
+		return true
+	}
+
+	var metrics []*model.MetricValue
+	if err = json.Unmarshal(bs, &metrics); err != nil {
+		log.Println("parse spool file", fpath, "fail:", err)
+		this.remove(name)
+		return true
+	}
+
+	var resp model.TransferResponse
+	if !SendMetrics(metrics, &resp) {
+		return false
+	}
+	RecordDedup(metrics)
+	RecordLastValues(metrics)
+
+	if Config().Debug {
+		log.Printf("replay spool file %s <Total=%d> <= %v", name, len(metrics), &resp)
+	}
+
+	this.Lock()
+	this.replayed++
+	this.Unlock()
+	this.remove(name)
+	return true
+}
+
+// oldest drops the expired batches and returns the oldest one left
+func (this *Spool) oldest() (string, bool) {
+	this.Lock()
+	defer this.Unlock()
+
+	for len(this.files) > 0 {
+		name := this.files[0]
+		if this.maxAge <= 0 || !this.expired(name) {
+			return name, true
+		}
+		this.removeOldest()
+		this.droppedByAge++
+	}
+
+	return "", false
+}
+
+func (this *Spool) expired(name string) bool {
+	nano, err := strconv.ParseInt(strings.TrimSuffix(name, spoolFileExt), 10, 64)
+	if err != nil {
+		return true
+	}
+	return time.Now().UnixNano()-nano > this.maxAge*int64(time.Second)
+}
+
+func (this *Spool) remove(name string) {
+	this.Lock()
+	defer this.Unlock()
+	if len(this.files) > 0 && this.files[0] == name {
+		this.removeOldest()
+	}
+}
+
+func (this *Spool) removeOldest() {
+	name := this.files[0]
+	this.files = this.files[1:]
+	this.size -= this.sizes[name]
+	delete(this.sizes, name)
+
+	if err := os.Remove(filepath.Join(this.dir, name)); err != nil && !os.IsNotExist(err) {
+		log.Println("remove spool file", name, "fail:", err)
+	}
+}
@@ -0,0 +1,69 @@
+package g
+
+import (
+	"github.com/open-falcon/falcon-plus/common/model"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSpoolPut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewSpool(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := []*model.MetricValue{{Endpoint: "host", Metric: "cpu.idle", Value: 99, Step: 60, Type: "GAUGE"}}
+	for i := 0; i < 3; i++ {
+		if err := s.Put(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Depth() != 3 {
+		t.Errorf("expect depth 3, but %d", s.Depth())
+	}
+
+	// reopen, the batches survive restarts in order
+	s, err = NewSpool(dir, s.size/3*2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := s.files[0]
+	if s.Depth() != 3 {
+		t.Errorf("expect depth 3 after reopen, but %d", s.Depth())
+	}
+
+	s.Put(batch)
+	if s.Depth() != 2 || s.droppedBySize != 2 || s.files[0] == first {
+		t.Errorf("expect oldest batches dropped by size, but %v", s.Stats())
+	}
+}
+
+func TestSpoolMaxAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewSpool(dir, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put([]*model.MetricValue{{Endpoint: "host", Metric: "cpu.idle", Value: 99}})
+	if _, ok := s.oldest(); !ok {
+		t.Error("expect the batch not expired")
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if _, ok := s.oldest(); ok || s.droppedByAge != 1 {
+		t.Errorf("expect the batch dropped by age, but %v", s.Stats())
+	}
+}
@@ -28,7 +28,8 @@ var (
 	TransferClients     map[string]*SingleConnRpcClient = map[string]*SingleConnRpcClient{}
 )
 
-func SendMetrics(metrics []*model.MetricValue, resp *model.TransferResponse) {
+// return false if every transfer failed
+func SendMetrics(metrics []*model.MetricValue, resp *model.TransferResponse) bool {
 	rand.Seed(time.Now().UnixNano())
 	for _, i := range rand.Perm(len(Config().Transfer.Addrs)) {
 		addr := Config().Transfer.Addrs[i]
@@ -39,15 +40,19 @@ func SendMetrics(metrics []*model.MetricValue, resp *model.TransferResponse) {
 		}
 
 		if updateMetrics(c, metrics, resp) {
-			break
+			return true
 		}
 	}
+	return false
 }
 
 func initTransferClient(addr string) *SingleConnRpcClient {
 	var c *SingleConnRpcClient = &SingleConnRpcClient{
-		RpcServer: addr,
-		Timeout:   time.Duration(Config().Transfer.Timeout) * time.Millisecond,
+		RpcServer:  addr,
+		Timeout:    time.Duration(Config().Transfer.Timeout) * time.Millisecond,
+		TLS:        transferTLS,
+		AuthMethod: "Transfer.Auth",
+		Auth:       rpcAuth(Config().Transfer.Token),
 	}
 	TransferClientsLock.Lock()
 	defer TransferClientsLock.Unlock()
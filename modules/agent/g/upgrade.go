@@ -0,0 +1,402 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package g
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/toolkits/sys"
+)
+
+const (
+	DefaultUpgradeTimeout     = 300 // seconds
+	DefaultUpgradeHealthCheck = 60  // seconds
+
+	// the new version is rolled back when it is started more times than this without passing the health check
+	maxUpgradeAttempts = 3
+	// a failed download or check is tried again after
+	upgradeRetryInterval = 600 // seconds
+)
+
+// upgradeState is kept in <binary>.upgrade, it survives the re-exec and the rollback
+type upgradeState struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+	Attempts int    `json:"attempts"`
+	Time     int64  `json:"time"`
+}
+
+var (
+	currUpgrade     *upgradeState
+	currUpgradeLock = new(sync.RWMutex)
+
+	// 1 while downloading
+	upgrading int32
+	// unix time of the last successful Agent.ReportStatus
+	lastReport int64
+)
+
+func SetLastReport(ts int64) {
+	atomic.StoreInt64(&lastReport, ts)
+}
+
+func LastReport() int64 {
+	return atomic.LoadInt64(&lastReport)
+}
+
+// UpgradeStatus is reported to hbs with Agent.ReportStatus
+func UpgradeStatus() *model.AgentUpgradeStatus {
+	currUpgradeLock.RLock()
+	defer currUpgradeLock.RUnlock()
+	if currUpgrade == nil {
+		return nil
+	}
+	return &model.AgentUpgradeStatus{
+		Version: currUpgrade.To,
+		Status:  currUpgrade.Status,
+		Message: currUpgrade.Message,
+	}
+}
+
+// UpgradeInTrial is true when this process is a new version not passed the health check yet
+func UpgradeInTrial() bool {
+	currUpgradeLock.RLock()
+	defer currUpgradeLock.RUnlock()
+	return currUpgrade != nil && currUpgrade.Status == model.UpgradeRestarting && currUpgrade.To == VERSION
+}
+
+func executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+func setUpgradeState(exe string, state *upgradeState) {
+	state.Time = time.Now().Unix()
+
+	currUpgradeLock.Lock()
+	currUpgrade = state
+	currUpgradeLock.Unlock()
+
+	bs, err := json.Marshal(state)
+	if err != nil {
+		log.Println("marshal upgrade state fail:", err)
+		return
+	}
+	if err := ioutil.WriteFile(exe+".upgrade", bs, 0644); err != nil {
+		log.Println("write upgrade state fail:", err)
+	}
+}
+
+func loadUpgradeState(exe string) (*upgradeState, error) {
+	bs, err := ioutil.ReadFile(exe + ".upgrade")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var state upgradeState
+	if err := json.Unmarshal(bs, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// InitUpgrade loads the state of the last upgrade, a new version
+// restarted too many times before its health check is rolled back here
+func InitUpgrade() {
+	exe, err := executable()
+	if err != nil {
+		log.Println("get executable fail:", err)
+		return
+	}
+
+	state, err := loadUpgradeState(exe)
+	if err != nil {
+		log.Println("load upgrade state fail:", err)
+		return
+	}
+	if state == nil {
+		return
+	}
+
+	if state.Status != model.UpgradeRestarting {
+		currUpgradeLock.Lock()
+		currUpgrade = state
+		currUpgradeLock.Unlock()
+		return
+	}
+
+	if state.To != VERSION {
+		state.Status = model.UpgradeFailed
+		state.Message = "restarted as version " + VERSION
+		setUpgradeState(exe, state)
+		return
+	}
+
+	state.Attempts++
+	setUpgradeState(exe, state)
+	if state.Attempts > maxUpgradeAttempts {
+		RollbackUpgrade(fmt.Sprintf("restarted %d times before the health check", state.Attempts-1))
+	}
+}
+
+// Upgrade starts to upgrade to the version set in hbs unless it is running,
+// rolled back before or failed recently
+func Upgrade(u *model.AgentUpgrade) {
+	cfg := Config().Upgrade
+	if cfg == nil || !cfg.Enabled || u == nil || u.Version == "" || u.Version == VERSION {
+		return
+	}
+
+	currUpgradeLock.RLock()
+	state := currUpgrade
+	currUpgradeLock.RUnlock()
+	if state != nil && state.To == u.Version {
+		switch state.Status {
+		case model.UpgradeRolledBack, model.UpgradeRestarting:
+			return
+		case model.UpgradeFailed:
+			if time.Now().Unix()-state.Time < upgradeRetryInterval {
+				return
+			}
+		}
+	}
+
+	if !atomic.CompareAndSwapInt32(&upgrading, 0, 1) {
+		return
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultUpgradeTimeout
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&upgrading, 0)
+
+		exe, err := executable()
+		if err != nil {
+			log.Println("get executable fail:", err)
+			return
+		}
+
+		if err := upgrade(exe, u, time.Duration(timeout)*time.Second); err != nil {
+			log.Println("upgrade to", u.Version, "fail:", err)
+			setUpgradeState(exe, &upgradeState{From: VERSION, To: u.Version, Status: model.UpgradeFailed, Message: err.Error()})
+		}
+	}()
+}
+
+// upgrade only returns on failure, the process is replaced by the new binary otherwise
+func upgrade(exe string, u *model.AgentUpgrade, timeout time.Duration) error {
+	log.Println("upgrading to", u.Version, "from", u.Url)
+	setUpgradeState(exe, &upgradeState{From: VERSION, To: u.Version, Status: model.UpgradeDownloading})
+
+	newPath := exe + ".new"
+	if err := downloadBinary(u.Url, u.Checksum, newPath, timeout); err != nil {
+		return err
+	}
+
+	version, err := binaryVersion(newPath)
+	if err != nil {
+		os.Remove(newPath)
+		return err
+	}
+	if version != u.Version {
+		os.Remove(newPath)
+		return fmt.Errorf("the new binary is version %s", version)
+	}
+
+	if err := swapBinary(exe, newPath, exe+".bak"); err != nil {
+		return err
+	}
+
+	setUpgradeState(exe, &upgradeState{From: VERSION, To: u.Version, Status: model.UpgradeRestarting})
+	log.Println("restarting as version", u.Version)
+
+	err = syscall.Exec(exe, os.Args, os.Environ())
+	if rerr := os.Rename(exe+".bak", exe); rerr != nil {
+		log.Println("restore binary fail:", rerr)
+	}
+	return fmt.Errorf("exec fail: %v", err)
+}
+
+// downloadBinary saves the url to path if the sha256 of the content is checksum
+func downloadBinary(url, checksum, path string, timeout time.Duration) error {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("download fail: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download fail: %s", resp.Status)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("download fail: %v", err)
+	}
+
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, checksum) {
+		os.Remove(path)
+		return fmt.Errorf("checksum mismatch: %s", sum)
+	}
+	return nil
+}
+
+// the output of `binary -v`, makes sure the download runs on this host
+func binaryVersion(path string) (string, error) {
+	var out bytes.Buffer
+	cmd := exec.Command(path, "-v")
+	cmd.Stdout = &out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("run the new binary fail: %v", err)
+	}
+
+	err, isTimeout := sys.CmdRunWithTimeout(cmd, 10*time.Second)
+	if isTimeout {
+		return "", fmt.Errorf("run the new binary timeout")
+	}
+	if err != nil {
+		return "", fmt.Errorf("run the new binary fail: %v", err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// swapBinary keeps exe as bak and renames newPath to exe, which is atomic
+func swapBinary(exe, newPath, bak string) error {
+	os.Remove(bak)
+	if err := os.Link(exe, bak); err != nil {
+		if err := copyFile(exe, bak); err != nil {
+			return fmt.Errorf("backup binary fail: %v", err)
+		}
+	}
+
+	if err := os.Rename(newPath, exe); err != nil {
+		return fmt.Errorf("replace binary fail: %v", err)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ConfirmUpgrade keeps the new version after its health check
+func ConfirmUpgrade() {
+	exe, err := executable()
+	if err != nil {
+		log.Println("get executable fail:", err)
+		return
+	}
+
+	currUpgradeLock.RLock()
+	state := *currUpgrade
+	currUpgradeLock.RUnlock()
+
+	state.Status = model.UpgradeDone
+	state.Message = ""
+	setUpgradeState(exe, &state)
+	os.Remove(exe + ".bak")
+	log.Println("upgraded to", VERSION)
+}
+
+// RollbackUpgrade restores the previous binary and re-execs it
+func RollbackUpgrade(reason string) {
+	exe, err := executable()
+	if err != nil {
+		log.Println("get executable fail:", err)
+		return
+	}
+
+	currUpgradeLock.RLock()
+	state := *currUpgrade
+	currUpgradeLock.RUnlock()
+
+	log.Println("rolling back to", state.From, "for", reason)
+	if err := os.Rename(exe+".bak", exe); err != nil {
+		state.Status = model.UpgradeFailed
+		state.Message = fmt.Sprintf("%s, rollback fail: %v", reason, err)
+		setUpgradeState(exe, &state)
+		return
+	}
+
+	state.Status = model.UpgradeRolledBack
+	state.Message = reason
+	setUpgradeState(exe, &state)
+
+	err = syscall.Exec(exe, os.Args, os.Environ())
+	log.Println("exec the previous binary fail:", err)
+}
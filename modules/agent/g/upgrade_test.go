@@ -0,0 +1,74 @@
+package g
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDownloadBinary(t *testing.T) {
+	content := []byte("#!/bin/sh\necho 5.1.3\n")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "falcon-agent.new")
+	if err := downloadBinary(ts.URL, "0000", path, time.Second); err == nil {
+		t.Error("expect checksum mismatch")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expect the mismatched download removed")
+	}
+
+	sum := sha256.Sum256(content)
+	if err := downloadBinary(ts.URL, hex.EncodeToString(sum[:]), path, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := binaryVersion(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "5.1.3" {
+		t.Errorf("expect 5.1.3, but %s", version)
+	}
+}
+
+func TestSwapBinary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	exe := filepath.Join(dir, "falcon-agent")
+	ioutil.WriteFile(exe, []byte("old"), 0755)
+	ioutil.WriteFile(exe+".new", []byte("new"), 0755)
+
+	if err := swapBinary(exe, exe+".new", exe+".bak"); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expect := range map[string]string{exe: "new", exe + ".bak": "old"} {
+		bs, err := ioutil.ReadFile(path)
+		if err != nil || string(bs) != expect {
+			t.Errorf("expect %s in %s, but %s %v", expect, path, bs, err)
+		}
+	}
+	if _, err := os.Stat(exe + ".new"); !os.IsNotExist(err) {
+		t.Error("expect the new binary renamed")
+	}
+}
@@ -16,11 +16,14 @@ package g
 
 import (
 	"bytes"
+	"crypto/tls"
 	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/utils"
 	"github.com/toolkits/slice"
 	"log"
 	"net"
 	"os"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -54,17 +57,48 @@ func InitLocalIp() {
 
 var (
 	HbsClient *SingleConnRpcClient
+
+	transferTLS *tls.Config
 )
 
 func InitRpcClients() {
+	transferTLS = rpcClientTLS(Config().Transfer.Tls)
+
 	if Config().Heartbeat.Enabled {
 		HbsClient = &SingleConnRpcClient{
-			RpcServer: Config().Heartbeat.Addr,
-			Timeout:   time.Duration(Config().Heartbeat.Timeout) * time.Millisecond,
+			RpcServer:  Config().Heartbeat.Addr,
+			Timeout:    time.Duration(Config().Heartbeat.Timeout) * time.Millisecond,
+			TLS:        rpcClientTLS(Config().Heartbeat.Tls),
+			AuthMethod: "Agent.Auth",
+			Auth:       rpcAuth(Config().Heartbeat.Token),
 		}
 	}
 }
 
+func rpcClientTLS(c *utils.TLSConfig) *tls.Config {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	conf, err := utils.ClientTLSConfig(c)
+	if err != nil {
+		log.Fatalln("load tls config fail:", err)
+	}
+	return conf
+}
+
+func rpcAuth(token string) *model.AuthRequest {
+	if token == "" {
+		return nil
+	}
+
+	hostname, err := Hostname()
+	if err != nil {
+		log.Println("get hostname fail:", err)
+	}
+	return &model.AuthRequest{Hostname: hostname, Token: token}
+}
+
 func SendToTransfer(metrics []*model.MetricValue) {
 	if len(metrics) == 0 {
 		return
@@ -96,37 +130,121 @@ func SendToTransfer(metrics []*model.MetricValue) {
 		}
 	}
 
+	metrics = Relabel(metrics)
+	metrics = Dedup(metrics)
+	if len(metrics) == 0 {
+		return
+	}
+
 	debug := Config().Debug
 
 	if debug {
 		log.Printf("=> <Total=%d> %v\n", len(metrics), metrics[0])
 	}
 
+	// the spool is drained in order by cron.ReplaySpool,
+	// newer batches have to wait behind it or graph would drop the older ones
+	if TransferSpool != nil && TransferSpool.Depth() > 0 {
+		if err := TransferSpool.Put(metrics); err != nil {
+			log.Println("spool metrics fail:", err)
+		}
+		return
+	}
+
 	var resp model.TransferResponse
-	SendMetrics(metrics, &resp)
+	if !SendMetrics(metrics, &resp) {
+		if TransferSpool != nil {
+			if err := TransferSpool.Put(metrics); err != nil {
+				log.Println("spool metrics fail:", err)
+			}
+		}
+		return
+	}
+
+	RecordDedup(metrics)
+	RecordLastValues(metrics)
 
 	if debug {
 		log.Println("<=", &resp)
 	}
 }
 
+// UrlProbe is one url.check.health strategy,
+// e.g. 'url=http://127.0.0.1/health,timeout=3,expect=204,match=ok'
+type UrlProbe struct {
+	Url     string
+	Timeout int    // seconds
+	Method  string // GET by default
+	Expect  int    // expected status code, 200 by default
+	Match   string // optional substring of the response body
+	MaxBody int64  // bytes of the body read at most, DefaultUrlMaxBody by default
+	Tags    string // the strategy tags, reported as is
+}
+
+const DefaultUrlMaxBody = 102400
+
 var (
-	reportUrls     map[string]string
+	// strategy tags => *UrlProbe
+	reportUrls     map[string]*UrlProbe
 	reportUrlsLock = new(sync.RWMutex)
 )
 
-func ReportUrls() map[string]string {
+func ReportUrls() map[string]*UrlProbe {
 	reportUrlsLock.RLock()
 	defer reportUrlsLock.RUnlock()
 	return reportUrls
 }
 
-func SetReportUrls(urls map[string]string) {
-	reportUrlsLock.RLock()
-	defer reportUrlsLock.RUnlock()
+func SetReportUrls(urls map[string]*UrlProbe) {
+	reportUrlsLock.Lock()
+	defer reportUrlsLock.Unlock()
 	reportUrls = urls
 }
 
+// ConnectProbe is one net.port.connect strategy, e.g. 'host=db1,port=3306,timeout=3'
+type ConnectProbe struct {
+	Host    string
+	Port    int
+	Timeout float64 // seconds
+	Tags    string  // the strategy tags, reported as is
+}
+
+var (
+	// strategy tags => *ConnectProbe
+	reportConnects     map[string]*ConnectProbe
+	reportConnectsLock = new(sync.RWMutex)
+)
+
+func ReportConnects() map[string]*ConnectProbe {
+	reportConnectsLock.RLock()
+	defer reportConnectsLock.RUnlock()
+	return reportConnects
+}
+
+func SetReportConnects(probes map[string]*ConnectProbe) {
+	reportConnectsLock.Lock()
+	defer reportConnectsLock.Unlock()
+	reportConnects = probes
+}
+
+var (
+	// redis.up/mysql.up/nginx.up => address => strategy tags
+	reportServices     map[string]map[string]string
+	reportServicesLock = new(sync.RWMutex)
+)
+
+func ReportServices(metric string) map[string]string {
+	reportServicesLock.RLock()
+	defer reportServicesLock.RUnlock()
+	return reportServices[metric]
+}
+
+func SetReportServices(services map[string]map[string]string) {
+	reportServicesLock.Lock()
+	defer reportServicesLock.Unlock()
+	reportServices = services
+}
+
 var (
 	reportPorts     []int64
 	reportPortsLock = new(sync.RWMutex)
@@ -144,6 +262,24 @@ func SetReportPorts(ports []int64) {
 	reportPorts = ports
 }
 
+var (
+	// ports of the net.port.established, net.port.timewait and net.port.accept.queue strategies
+	reportConnPorts     []int64
+	reportConnPortsLock = new(sync.RWMutex)
+)
+
+func ReportConnPorts() []int64 {
+	reportConnPortsLock.RLock()
+	defer reportConnPortsLock.RUnlock()
+	return reportConnPorts
+}
+
+func SetReportConnPorts(ports []int64) {
+	reportConnPortsLock.Lock()
+	defer reportConnPortsLock.Unlock()
+	reportConnPorts = ports
+}
+
 var (
 	duPaths     []string
 	duPathsLock = new(sync.RWMutex)
@@ -181,6 +317,49 @@ func SetReportProcs(procs map[string]map[int]string) {
 	reportProcs = procs
 }
 
+var (
+	// strategy tags => *PrometheusTarget
+	reportPromTargets     map[string]*PrometheusTarget
+	reportPromTargetsLock = new(sync.RWMutex)
+)
+
+func ReportPromTargets() map[string]*PrometheusTarget {
+	reportPromTargetsLock.RLock()
+	defer reportPromTargetsLock.RUnlock()
+	return reportPromTargets
+}
+
+func SetReportPromTargets(targets map[string]*PrometheusTarget) {
+	reportPromTargetsLock.Lock()
+	defer reportPromTargetsLock.Unlock()
+	reportPromTargets = targets
+}
+
+// LogKeyword is one log.keyword strategy, e.g. 'file=/var/log/app.log,pattern=ERROR|FATAL'
+type LogKeyword struct {
+	File    string
+	Pattern *regexp.Regexp
+	Tags    string // the strategy tags, reported as is
+}
+
+var (
+	// strategy tags => *LogKeyword
+	reportLogKeywords     map[string]*LogKeyword
+	reportLogKeywordsLock = new(sync.RWMutex)
+)
+
+func ReportLogKeywords() map[string]*LogKeyword {
+	reportLogKeywordsLock.RLock()
+	defer reportLogKeywordsLock.RUnlock()
+	return reportLogKeywords
+}
+
+func SetReportLogKeywords(keywords map[string]*LogKeyword) {
+	reportLogKeywordsLock.Lock()
+	defer reportLogKeywordsLock.Unlock()
+	reportLogKeywords = keywords
+}
+
 var (
 	ips     []string
 	ipsLock = new(sync.Mutex)
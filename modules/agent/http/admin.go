@@ -15,6 +15,7 @@
 package http
 
 import (
+	"github.com/open-falcon/falcon-plus/modules/agent/cron"
 	"github.com/open-falcon/falcon-plus/modules/agent/g"
 	"github.com/toolkits/file"
 	"net/http"
@@ -37,8 +38,12 @@ func configAdminRoutes() {
 
 	http.HandleFunc("/config/reload", func(w http.ResponseWriter, r *http.Request) {
 		if g.IsTrustable(r.RemoteAddr) {
-			g.ParseConfig(g.ConfigFile)
-			RenderDataJson(w, g.Config())
+			if err := g.ReloadConfig(); err != nil {
+				RenderMsgJson(w, err.Error())
+				return
+			}
+			cron.Collect()
+			RenderDataJson(w, g.RedactedConfig())
 		} else {
 			w.Write([]byte("no privilege"))
 		}
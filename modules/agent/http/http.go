@@ -35,10 +35,12 @@ func init() {
 	configIoStatRoutes()
 	configKernelRoutes()
 	configMemoryRoutes()
+	configMetricsRoutes()
 	configPageRoutes()
 	configPluginRoutes()
 	configPushRoutes()
 	configRunRoutes()
+	configSpoolRoutes()
 	configSystemRoutes()
 }
 
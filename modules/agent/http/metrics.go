@@ -0,0 +1,30 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+	"net/http"
+)
+
+// /v1/metrics?prefix=df.&tags=mount=/,fstype=ext4&endpoint=
+// lists the last values sent to transfer
+func configMetricsRoutes() {
+	http.HandleFunc("/v1/metrics", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		RenderDataJson(w, g.LastValues(q.Get("prefix"), q.Get("endpoint"), utils.DictedTagstring(q.Get("tags"))))
+	})
+}
@@ -81,4 +81,8 @@ func configPluginRoutes() {
 		//TODO: not thread safe
 		RenderDataJson(w, plugins.Plugins)
 	})
+
+	http.HandleFunc("/plugin/stats", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, plugins.Stats())
+	})
 }
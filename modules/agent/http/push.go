@@ -15,12 +15,25 @@
 package http
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/utils"
 	"github.com/open-falcon/falcon-plus/modules/agent/g"
+	"github.com/open-falcon/falcon-plus/modules/agent/plugins"
+	"io/ioutil"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// bytes of a push body at most
+const maxPushBodySize = 4 << 20
+
 func configPushRoutes() {
 	http.HandleFunc("/v1/push", func(w http.ResponseWriter, req *http.Request) {
 		if req.ContentLength == 0 {
@@ -28,7 +41,7 @@ func configPushRoutes() {
 			return
 		}
 
-		decoder := json.NewDecoder(req.Body)
+		decoder := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxPushBodySize))
 		var metrics []*model.MetricValue
 		err := decoder.Decode(&metrics)
 		if err != nil {
@@ -39,4 +52,206 @@ func configPushRoutes() {
 		g.SendToTransfer(metrics)
 		w.Write([]byte("success"))
 	})
+
+	http.HandleFunc("/v1/push/graphite", pushHandler(func(data []byte, req *http.Request) ([]*model.MetricValue, error) {
+		return parseGraphite(data)
+	}))
+
+	opentsdb := pushHandler(func(data []byte, req *http.Request) ([]*model.MetricValue, error) {
+		return parseOpenTSDB(data)
+	})
+	http.HandleFunc("/v1/push/opentsdb", opentsdb)
+	http.HandleFunc("/api/put", opentsdb)
+
+	influx := pushHandler(func(data []byte, req *http.Request) ([]*model.MetricValue, error) {
+		return plugins.ParseInflux(data, req.URL.Query().Get("precision"))
+	})
+	http.HandleFunc("/v1/push/influx", influx)
+	http.HandleFunc("/write", influx)
+}
+
+// pushHandler reads the body in a third party format, the step is set by ?step=, transfer.interval by default.
+// /api/put and /write answer 204 like opentsdb and influxdb do
+func pushHandler(parse func([]byte, *http.Request) ([]*model.MetricValue, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.ContentLength == 0 {
+			http.Error(w, "body is blank", http.StatusBadRequest)
+			return
+		}
+
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxPushBodySize))
+		if err != nil {
+			// MaxBytesReader fails after reading exactly the limit
+			if len(data) >= maxPushBodySize {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		metrics, err := parse(data, req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		step := int64(g.Config().Transfer.Interval)
+		if s := req.URL.Query().Get("step"); s != "" {
+			step, err = strconv.ParseInt(s, 10, 64)
+			if err != nil || step <= 0 {
+				http.Error(w, "bad step", http.StatusBadRequest)
+				return
+			}
+		}
+
+		fillPushDefaults(metrics, step)
+		g.SendToTransfer(metrics)
+
+		if req.URL.Path == "/api/put" || req.URL.Path == "/write" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte("success"))
+	}
+}
+
+// the endpoint tag, or else the host tag, names the endpoint, the local hostname by default
+func fillPushDefaults(metrics []*model.MetricValue, step int64) {
+	hostname, err := g.Hostname()
+	if err != nil {
+		hostname = ""
+	}
+
+	now := time.Now().Unix()
+	for _, mv := range metrics {
+		tags := utils.DictedTagstring(mv.Tags)
+		if v, ok := tags["endpoint"]; ok {
+			mv.Endpoint = v
+			delete(tags, "endpoint")
+		} else if v, ok := tags["host"]; ok {
+			mv.Endpoint = v
+			delete(tags, "host")
+		}
+		mv.Tags = utils.SortedTags(tags)
+
+		if mv.Endpoint == "" {
+			mv.Endpoint = hostname
+		}
+		if mv.Step == 0 {
+			mv.Step = step
+		}
+		if mv.Timestamp <= 0 {
+			mv.Timestamp = now
+		}
+		if mv.Type == "" {
+			mv.Type = "GAUGE"
+		}
+	}
+}
+
+// metric.path[;tag=val...] value [timestamp], tags as in graphite 1.1
+func parseGraphite(data []byte) ([]*model.MetricValue, error) {
+	L := []*model.MetricValue{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 3 || len(fields) < 2 {
+			return nil, fmt.Errorf("bad line: %s", scanner.Text())
+		}
+
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad value: %s", scanner.Text())
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		var timestamp int64
+		if len(fields) == 3 {
+			ts, err := strconv.ParseFloat(fields[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad timestamp: %s", scanner.Text())
+			}
+			timestamp = int64(ts)
+		}
+
+		parts := strings.Split(fields[0], ";")
+		tags := make(map[string]string)
+		for _, kv := range parts[1:] {
+			idx := strings.Index(kv, "=")
+			if idx <= 0 {
+				return nil, fmt.Errorf("bad tag %s: %s", kv, scanner.Text())
+			}
+			tags[utils.SanitizeTag(kv[:idx])] = utils.SanitizeTag(kv[idx+1:])
+		}
+
+		L = append(L, &model.MetricValue{
+			Metric:    parts[0],
+			Value:     value,
+			Tags:      utils.SortedTags(tags),
+			Timestamp: timestamp,
+		})
+	}
+
+	return L, scanner.Err()
+}
+
+type openTSDBPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     json.Number       `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// a data point of /api/put or an array of them, timestamps may be in milliseconds
+func parseOpenTSDB(data []byte) ([]*model.MetricValue, error) {
+	var points []*openTSDBPoint
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var p openTSDBPoint
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, err
+		}
+		points = append(points, &p)
+	} else if err := json.Unmarshal(data, &points); err != nil {
+		return nil, err
+	}
+
+	L := make([]*model.MetricValue, 0, len(points))
+	for _, p := range points {
+		if p.Metric == "" {
+			return nil, fmt.Errorf("metric is blank")
+		}
+
+		value, err := p.Value.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("bad value of %s: %s", p.Metric, p.Value)
+		}
+
+		timestamp := p.Timestamp
+		if timestamp > 1e10 {
+			timestamp /= 1000
+		}
+
+		tags := make(map[string]string, len(p.Tags))
+		for k, v := range p.Tags {
+			tags[utils.SanitizeTag(k)] = utils.SanitizeTag(v)
+		}
+
+		L = append(L, &model.MetricValue{
+			Metric:    p.Metric,
+			Value:     value,
+			Tags:      utils.SortedTags(tags),
+			Timestamp: timestamp,
+		})
+	}
+
+	return L, nil
 }
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+)
+
+func dumpMetrics(metrics []*model.MetricValue) string {
+	got := []string{}
+	for _, mv := range metrics {
+		got = append(got, fmt.Sprintf("%s/%s/%v@%d", mv.Metric, mv.Tags, mv.Value, mv.Timestamp))
+	}
+	return fmt.Sprint(got)
+}
+
+func TestParseGraphite(t *testing.T) {
+	metrics, err := parseGraphite([]byte("app.requests 10 1500000000\n\napp.latency;host=web1;path=/a,b 0.5 -1\napp.nan nan\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "[app.requests//10@1500000000 app.latency/host=web1,path=/a_b/0.5@-1]"
+	if got := dumpMetrics(metrics); got != expect {
+		t.Errorf("expect %s, but %s", expect, got)
+	}
+
+	for _, bad := range []string{"app.requests", "app.requests x", "app.requests;host 1"} {
+		if _, err := parseGraphite([]byte(bad)); err == nil {
+			t.Errorf("expect error for %q", bad)
+		}
+	}
+}
+
+func TestParseOpenTSDB(t *testing.T) {
+	metrics, err := parseOpenTSDB([]byte(`[{"metric":"sys.cpu.nice","timestamp":1500000000000,"value":"18","tags":{"host":"web01","dc":"lga"}},{"metric":"sys.load","timestamp":1500000000,"value":0.5}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "[sys.cpu.nice/dc=lga,host=web01/18@1500000000 sys.load//0.5@1500000000]"
+	if got := dumpMetrics(metrics); got != expect {
+		t.Errorf("expect %s, but %s", expect, got)
+	}
+
+	if _, err := parseOpenTSDB([]byte(`{"metric":"sys.load","value":"x"}`)); err == nil {
+		t.Error("expect bad value")
+	}
+}
+
+func TestPushTooLarge(t *testing.T) {
+	handler := pushHandler(func(data []byte, req *http.Request) ([]*model.MetricValue, error) {
+		t.Error("expect the body rejected before parsing")
+		return nil, nil
+	})
+
+	req := httptest.NewRequest("POST", "/v1/push/graphite", bytes.NewReader(make([]byte, maxPushBodySize+1)))
+	rw := httptest.NewRecorder()
+	handler(rw, req)
+	if rw.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expect 413, but %d", rw.Code)
+	}
+}
@@ -16,7 +16,7 @@ package http
 
 import (
 	"github.com/open-falcon/falcon-plus/modules/agent/g"
-	"github.com/toolkits/sys"
+	"io"
 	"io/ioutil"
 	"net/http"
 )
@@ -28,28 +28,24 @@ func configRunRoutes() {
 			return
 		}
 
-		if g.IsTrustable(r.RemoteAddr) {
-			if r.ContentLength == 0 {
-				http.Error(w, "body is blank", http.StatusBadRequest)
-				return
-			}
-
-			bs, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+		cfg := g.Config().Run
+		if cfg == nil {
+			w.Write([]byte("/run not configured"))
+			return
+		}
 
-			body := string(bs)
-			out, err := sys.CmdOutBytes("sh", "-c", body)
-			if err != nil {
-				w.Write([]byte("exec fail: " + err.Error()))
-				return
-			}
+		if r.ContentLength == 0 {
+			http.Error(w, "body is blank", http.StatusBadRequest)
+			return
+		}
 
-			w.Write(out)
-		} else {
-			w.Write([]byte("no privilege"))
+		bs, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
+
+		result, err := g.Run(cfg, r.RemoteAddr, bs, r.Header.Get("X-Signature"))
+		AutoRender(w, result, err)
 	})
 }
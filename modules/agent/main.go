@@ -21,6 +21,7 @@ import (
 	"github.com/open-falcon/falcon-plus/modules/agent/funcs"
 	"github.com/open-falcon/falcon-plus/modules/agent/g"
 	"github.com/open-falcon/falcon-plus/modules/agent/http"
+	"github.com/open-falcon/falcon-plus/modules/agent/statsd"
 	"os"
 )
 
@@ -53,8 +54,8 @@ func main() {
 	g.InitRootDir()
 	g.InitLocalIp()
 	g.InitRpcClients()
-
-	funcs.BuildMappers()
+	g.InitSpool()
+	g.InitUpgrade()
 
 	go cron.InitDataHistory()
 
@@ -62,9 +63,12 @@ func main() {
 	cron.SyncMinePlugins()
 	cron.SyncBuiltinMetrics()
 	cron.SyncTrustableIps()
+	cron.ReplaySpool()
 	cron.Collect()
+	cron.CheckUpgrade()
 
 	go http.Start()
+	go statsd.Start()
 
 	select {}
 
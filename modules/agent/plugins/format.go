@@ -0,0 +1,339 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugins
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/utils"
+)
+
+// the output format of a plugin is declared by a header line, e.g. '# format: nagios',
+// or by the file name, e.g. 60_check_load.nagios.sh; json MetricValue arrays by default
+const (
+	FormatJson   = "json"
+	FormatNagios = "nagios"
+	FormatInflux = "influx"
+	FormatSimple = "simple"
+)
+
+var formatHeaderRegexp = regexp.MustCompile(`^#\s*format:\s*(\w+)\s*$`)
+
+func isFormat(s string) bool {
+	switch s {
+	case FormatJson, FormatNagios, FormatInflux, FormatSimple:
+		return true
+	}
+	return false
+}
+
+// OutputFormat returns the format of the output and the output without the header line
+func OutputFormat(fpath string, data []byte) (string, []byte) {
+	line := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		line = data[:i]
+	}
+	if m := formatHeaderRegexp.FindSubmatch(bytes.TrimSpace(line)); m != nil && isFormat(string(m[1])) {
+		return string(m[1]), data[len(line):]
+	}
+
+	parts := strings.Split(filepath.Base(fpath), ".")
+	for _, part := range parts[1:] {
+		if isFormat(part) {
+			return part, data
+		}
+	}
+
+	return FormatJson, data
+}
+
+// PluginName strips the cycle and the extensions, e.g. sys/60_check_load.nagios.sh => check_load
+func PluginName(fpath string) string {
+	name := filepath.Base(fpath)
+	if i := strings.Index(name, "_"); i >= 0 {
+		if _, err := strconv.Atoi(name[:i]); err == nil {
+			name = name[i+1:]
+		}
+	}
+	if i := strings.Index(name, "."); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// ParseOutput converts the stdout of a plugin to metrics,
+// endpoint, step and timestamp are left for the caller unless the format carries them
+func ParseOutput(format string, name string, data []byte, exitCode int) ([]*model.MetricValue, error) {
+	switch format {
+	case FormatNagios:
+		return parseNagios(name, data, exitCode)
+	case FormatInflux:
+		return ParseInflux(data, "ns")
+	case FormatSimple:
+		return parseSimple(data)
+	}
+
+	var metrics []*model.MetricValue
+	err := json.Unmarshal(data, &metrics)
+	return metrics, err
+}
+
+// nagios.status is the exit code, 0:OK 1:WARNING 2:CRITICAL 3:UNKNOWN,
+// every perfdata 'label'=value[UOM];[warn];[crit];[min];[max] becomes nagios.$label
+func parseNagios(name string, data []byte, exitCode int) ([]*model.MetricValue, error) {
+	tags := "check=" + utils.SanitizeTag(name)
+	L := []*model.MetricValue{newMetricValue("nagios.status", exitCode, "GAUGE", tags)}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.Index(line, "|")
+		if i < 0 {
+			continue
+		}
+
+		for _, perf := range splitPerfdata(line[i+1:]) {
+			eq := strings.LastIndex(perf, "=")
+			if eq <= 0 {
+				continue
+			}
+
+			label := strings.Trim(perf[:eq], "'")
+			raw := strings.Split(perf[eq+1:], ";")[0]
+			num := strings.TrimRightFunc(raw, func(r rune) bool {
+				return (r < '0' || r > '9') && r != '.'
+			})
+			value, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				// e.g. U, the value could not be determined
+				continue
+			}
+
+			dataType := "GAUGE"
+			if raw[len(num):] == "c" {
+				dataType = "COUNTER"
+			}
+
+			metric := "nagios." + strings.Replace(strings.TrimSpace(label), " ", "_", -1)
+			L = append(L, newMetricValue(metric, value, dataType, tags))
+		}
+	}
+
+	return L, scanner.Err()
+}
+
+// items are separated by spaces, the quoted labels may contain spaces
+func splitPerfdata(s string) []string {
+	ret := []string{}
+	var buf bytes.Buffer
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\'' {
+			quoted = !quoted
+		}
+		if c == ' ' && !quoted {
+			if buf.Len() > 0 {
+				ret = append(ret, buf.String())
+				buf.Reset()
+			}
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	if buf.Len() > 0 {
+		ret = append(ret, buf.String())
+	}
+	return ret
+}
+
+// measurement[,tag=val...] field=val[,field=val...] [timestamp in precision],
+// the metric is $measurement.$field, or just $measurement for the field named value
+func ParseInflux(data []byte, precision string) ([]*model.MetricValue, error) {
+	toSeconds, ok := influxPrecisions[precision]
+	if !ok {
+		return nil, fmt.Errorf("bad precision: %s", precision)
+	}
+
+	L := []*model.MetricValue{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := splitEscaped(line, ' ')
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("bad line: %s", line)
+		}
+
+		keys := splitEscaped(parts[0], ',')
+		measurement := unescape(keys[0])
+		tags := []string{}
+		for _, kv := range keys[1:] {
+			pair := splitEscaped(kv, '=')
+			if len(pair) != 2 {
+				return nil, fmt.Errorf("bad tag %s: %s", kv, line)
+			}
+			tags = append(tags, utils.SanitizeTag(unescape(pair[0]))+"="+utils.SanitizeTag(unescape(pair[1])))
+		}
+
+		var timestamp int64
+		if len(parts) == 3 {
+			ts, err := strconv.ParseInt(parts[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad timestamp: %s", line)
+			}
+			timestamp = toSeconds(ts)
+		}
+
+		for _, kv := range splitEscaped(parts[1], ',') {
+			pair := splitEscaped(kv, '=')
+			if len(pair) != 2 {
+				return nil, fmt.Errorf("bad field %s: %s", kv, line)
+			}
+
+			value, ok := influxFieldValue(pair[1])
+			if !ok {
+				// strings can not be stored
+				continue
+			}
+
+			metric := measurement
+			if field := unescape(pair[0]); field != "value" {
+				metric = measurement + "." + field
+			}
+
+			mv := newMetricValue(metric, value, "GAUGE", tags...)
+			mv.Timestamp = timestamp
+			L = append(L, mv)
+		}
+	}
+
+	return L, scanner.Err()
+}
+
+// timestamps are in nanoseconds unless the precision of the writer says otherwise
+var influxPrecisions = map[string]func(int64) int64{
+	"":   func(ts int64) int64 { return ts / 1e9 },
+	"n":  func(ts int64) int64 { return ts / 1e9 },
+	"ns": func(ts int64) int64 { return ts / 1e9 },
+	"u":  func(ts int64) int64 { return ts / 1e6 },
+	"us": func(ts int64) int64 { return ts / 1e6 },
+	"ms": func(ts int64) int64 { return ts / 1e3 },
+	"s":  func(ts int64) int64 { return ts },
+	"m":  func(ts int64) int64 { return ts * 60 },
+	"h":  func(ts int64) int64 { return ts * 3600 },
+}
+
+func influxFieldValue(s string) (float64, bool) {
+	switch s {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true
+	}
+
+	if strings.HasPrefix(s, "\"") {
+		return 0, false
+	}
+
+	s = strings.TrimRight(s, "iu")
+	value, err := strconv.ParseFloat(s, 64)
+	return value, err == nil
+}
+
+// splitEscaped splits s by the sep which is neither escaped by '\' nor in double quotes
+func splitEscaped(s string, sep byte) []string {
+	ret := []string{}
+	start := 0
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				ret = append(ret, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(ret, s[start:])
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// metric value [tags], e.g. disk.io.util 12.5 device=sda
+func parseSimple(data []byte) ([]*model.MetricValue, error) {
+	L := []*model.MetricValue{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("bad line: %s", scanner.Text())
+		}
+
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad value: %s", scanner.Text())
+		}
+
+		mv := newMetricValue(fields[0], value, "GAUGE")
+		if len(fields) == 3 {
+			mv.Tags = fields[2]
+		}
+		L = append(L, mv)
+	}
+
+	return L, scanner.Err()
+}
+
+func newMetricValue(metric string, val interface{}, dataType string, tags ...string) *model.MetricValue {
+	return &model.MetricValue{
+		Metric: metric,
+		Value:  val,
+		Type:   dataType,
+		Tags:   strings.Join(tags, ","),
+	}
+}
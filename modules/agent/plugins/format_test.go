@@ -0,0 +1,95 @@
+package plugins
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestOutputFormat(t *testing.T) {
+	cases := []struct {
+		fpath  string
+		data   string
+		format string
+		rest   string
+	}{
+		{"sys/60_ntp.py", `[{"metric":"ntp.offset"}]`, FormatJson, `[{"metric":"ntp.offset"}]`},
+		{"sys/60_check_load.nagios.sh", "OK", FormatNagios, "OK"},
+		{"sys/60_check_load", "# format: influx\ncpu value=1", FormatInflux, "\ncpu value=1"},
+		{"sys/60_check_load.nagios", "#format: simple\ncpu 1", FormatSimple, "\ncpu 1"},
+	}
+
+	for _, c := range cases {
+		format, rest := OutputFormat(c.fpath, []byte(c.data))
+		if format != c.format || string(rest) != c.rest {
+			t.Errorf("%s: expect %s %q, but %s %q", c.fpath, c.format, c.rest, format, rest)
+		}
+	}
+
+	if name := PluginName("sys/60_check_load.nagios.sh"); name != "check_load" {
+		t.Errorf("expect check_load, but %s", name)
+	}
+}
+
+func TestParseOutput(t *testing.T) {
+	cases := []struct {
+		format string
+		data   string
+		expect string
+	}{
+		{
+			FormatNagios,
+			"WARNING - load average: 5.1 | load1=5.1;5;10;0; 'disk used'=80%;90;95 uptime=12c time=U",
+			"[nagios.status/GAUGE/check=check_load/1 nagios.load1/GAUGE/check=check_load/5.1 nagios.disk_used/GAUGE/check=check_load/80 nagios.uptime/COUNTER/check=check_load/12]",
+		},
+		{
+			FormatInflux,
+			"cpu,host=a\\ b,core=0 value=1.5,user=2i,ok=t,msg=\"x, y\" 1500000000000000000\nmem free=3",
+			"[cpu/GAUGE/host=a_b,core=0/1.5@1500000000 cpu.user/GAUGE/host=a_b,core=0/2@1500000000 cpu.ok/GAUGE/host=a_b,core=0/1@1500000000 mem.free/GAUGE//3]",
+		},
+		{
+			FormatSimple,
+			"disk.io.util 12.5 device=sda\n\nload.1min 0.3\n",
+			"[disk.io.util/GAUGE/device=sda/12.5 load.1min/GAUGE//0.3]",
+		},
+	}
+
+	for _, c := range cases {
+		metrics, err := ParseOutput(c.format, "check_load", []byte(c.data), 1)
+		if err != nil {
+			t.Errorf("parse %s fail: %v", c.format, err)
+			continue
+		}
+
+		got := []string{}
+		for _, mv := range metrics {
+			s := fmt.Sprintf("%s/%s/%s/%v", mv.Metric, mv.Type, mv.Tags, mv.Value)
+			if mv.Timestamp != 0 {
+				s = fmt.Sprintf("%s@%d", s, mv.Timestamp)
+			}
+			got = append(got, s)
+		}
+		if fmt.Sprint(got) != c.expect {
+			t.Errorf("parse %s, expect %s, but %v", c.format, c.expect, got)
+		}
+	}
+
+	for _, bad := range []string{"disk.io.util", "disk.io.util x", "a 1 b=1 c"} {
+		if _, err := ParseOutput(FormatSimple, "", []byte(bad), 0); err == nil {
+			t.Errorf("expect error for %q", bad)
+		}
+	}
+}
+
+func TestParseInfluxPrecision(t *testing.T) {
+	metrics, err := ParseInflux([]byte("cpu value=1 1500000000000"), "ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 1 || metrics[0].Timestamp != 1500000000 {
+		t.Errorf("unexpected %v", metrics)
+	}
+
+	if _, err := ParseInflux([]byte("cpu value=1"), "d"); err == nil {
+		t.Error("expect bad precision")
+	}
+}
@@ -58,6 +58,7 @@ func deletePlugin(key string) {
 	v, ok := PluginsWithScheduler[key]
 	if ok {
 		v.Stop()
+		deleteStat(v.Plugin)
 		delete(PluginsWithScheduler, key)
 	}
 	delete(Plugins, key)
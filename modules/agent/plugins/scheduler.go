@@ -16,11 +16,12 @@ package plugins
 
 import (
 	"bytes"
-	"encoding/json"
 	"log"
+	"math/rand"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -38,13 +39,21 @@ type PluginScheduler struct {
 
 func NewPluginScheduler(p *Plugin) *PluginScheduler {
 	scheduler := PluginScheduler{Plugin: p}
-	scheduler.Ticker = time.NewTicker(time.Duration(p.Cycle) * time.Second)
 	scheduler.Quit = make(chan struct{})
 	return &scheduler
 }
 
 func (this *PluginScheduler) Schedule() {
 	go func() {
+		// spread the plugins with the same cycle, or they fork at once
+		cycle := time.Duration(this.Plugin.Cycle) * time.Second
+		select {
+		case <-time.After(jitter(cycle)):
+		case <-this.Quit:
+			return
+		}
+
+		this.Ticker = time.NewTicker(cycle)
 		for {
 			select {
 			case <-this.Ticker.C:
@@ -57,6 +66,14 @@ func (this *PluginScheduler) Schedule() {
 	}()
 }
 
+// the delay of the first run, within one cycle
+func jitter(cycle time.Duration) time.Duration {
+	if cycle <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(cycle)))
+}
+
 func (this *PluginScheduler) Stop() {
 	close(this.Quit)
 }
@@ -104,14 +121,64 @@ func PluginArgsParse(raw_args string) []string {
 	return ret
 }
 
+var (
+	sema     chan struct{}
+	semaOnce sync.Once
+)
+
+// acquire waits at most one cycle for a slot when plugin.maxConcurrency is set
+func acquire(plugin *Plugin) bool {
+	semaOnce.Do(func() {
+		if n := g.Config().Plugin.MaxConcurrency; n > 0 {
+			sema = make(chan struct{}, n)
+		}
+	})
+
+	if sema == nil {
+		return true
+	}
+
+	select {
+	case sema <- struct{}{}:
+		return true
+	case <-time.After(time.Duration(plugin.Cycle) * time.Second):
+		log.Printf("[WARN] too many plugins running, skip %s(%s)", plugin.FilePath, plugin.Args)
+		return false
+	}
+}
+
+func release() {
+	if sema != nil {
+		<-sema
+	}
+}
+
 func PluginRun(plugin *Plugin) {
+	if !acquire(plugin) {
+		return
+	}
+	defer release()
+
+	start := time.Now()
+	metrics, exitCode, ok, isTimeout := runPlugin(plugin)
+	stat := recordRun(plugin, time.Since(start), exitCode, ok, isTimeout)
+
+	if len(metrics) > 0 {
+		g.SendToTransfer(metrics)
+	}
+	g.SendToTransfer(stat.Metrics(plugin))
+}
+
+// return: the metrics parsed from the output, the exit code, -1 if the plugin did not exit by itself,
+// whether the output is parsed and whether it timed out
+func runPlugin(plugin *Plugin) ([]*model.MetricValue, int, bool, bool) {
 	timeout := plugin.Cycle*1000 - 500
 	fpath := filepath.Join(g.Config().Plugin.Dir, plugin.FilePath)
 	args := plugin.Args
 
 	if !file.IsExist(fpath) {
 		log.Printf("no such plugin: %s(%s)", fpath, args)
-		return
+		return nil, -1, false, false
 	}
 
 	debug := g.Config().Debug
@@ -134,7 +201,7 @@ func PluginRun(plugin *Plugin) {
 	err := cmd.Start()
 	if err != nil {
 		log.Printf("[ERROR] plugin start fail: %s(%s) , error: %s\n", fpath, args, err)
-		return
+		return nil, -1, false, false
 	}
 	if debug {
 		log.Printf("plugin started: %s(%s)", fpath, args)
@@ -144,9 +211,11 @@ func PluginRun(plugin *Plugin) {
 
 	errStr := stderr.String()
 	if errStr != "" {
-		logFile := filepath.Join(g.Config().Plugin.LogDir, plugin.FilePath+"("+plugin.Args+")"+".stderr.log")
-		if _, err = file.WriteString(logFile, errStr); err != nil {
-			log.Printf("[ERROR] write log to %s fail, error: %s\n", logFile, err)
+		// args may contain '/'
+		logFile := filepath.Join(g.Config().Plugin.LogDir, plugin.FilePath+"("+strings.Replace(plugin.Args, "/", "_", -1)+")"+".stderr.log")
+		// err is the exit status of the plugin, keep it
+		if _, werr := file.WriteString(logFile, errStr); werr != nil {
+			log.Printf("[ERROR] write log to %s fail, error: %s\n", logFile, werr)
 		}
 	}
 
@@ -160,29 +229,68 @@ func PluginRun(plugin *Plugin) {
 			log.Println("[ERROR] kill process ", fpath, "(", args, ")", " occur error:", err)
 		}
 
-		return
+		return nil, -1, false, true
 	}
 
+	format, data := OutputFormat(plugin.FilePath, stdout.Bytes())
+	exitCode := 0
+
 	if err != nil {
-		log.Println("[ERROR] exec plugin", fpath, "(", args, ")", "fail. error:", err)
-		return
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			log.Println("[ERROR] exec plugin", fpath, "(", args, ")", "fail. error:", err)
+			return nil, -1, false, false
+		}
+		exitCode = exitErr.Sys().(syscall.WaitStatus).ExitStatus()
+
+		// nagios checks exit with the status
+		if format != FormatNagios {
+			log.Println("[ERROR] exec plugin", fpath, "(", args, ")", "fail. error:", err)
+			return nil, exitCode, false, false
+		}
 	}
 
 	// exec successfully
-	data := stdout.Bytes()
-	if len(data) == 0 {
+	if len(bytes.TrimSpace(data)) == 0 && format != FormatNagios {
 		if debug {
 			log.Println("[DEBUG] stdout of", fpath, "(", args, ")", "is blank")
 		}
-		return
+		return nil, exitCode, true, false
 	}
 
-	var metrics []*model.MetricValue
-	err = json.Unmarshal(data, &metrics)
+	metrics, err := ParseOutput(format, PluginName(plugin.FilePath), data, exitCode)
 	if err != nil {
-		log.Printf("[ERROR] json.Unmarshal stdout of %s(%s) fail. error:%s stdout: \n%s\n", fpath, args, err, stdout.String())
-		return
+		log.Printf("[ERROR] parse %s stdout of %s(%s) fail. error:%s stdout: \n%s\n", format, fpath, args, err, stdout.String())
+		return nil, exitCode, false, false
 	}
 
-	g.SendToTransfer(metrics)
+	if format != FormatJson {
+		fillDefaults(metrics, plugin)
+	}
+
+	return metrics, exitCode, true, false
+}
+
+// the other formats than json carry metric, value and tags only
+func fillDefaults(metrics []*model.MetricValue, plugin *Plugin) {
+	hostname, err := g.Hostname()
+	if err != nil {
+		hostname = ""
+	}
+
+	now := time.Now().Unix()
+	for _, mv := range metrics {
+		if mv.Endpoint == "" {
+			mv.Endpoint = hostname
+		}
+		if mv.Step == 0 {
+			mv.Step = int64(plugin.Cycle)
+		}
+		if mv.Timestamp == 0 {
+			mv.Timestamp = now
+		}
+		if mv.Type == "" {
+			mv.Type = "GAUGE"
+		}
+	}
 }
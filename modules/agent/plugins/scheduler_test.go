@@ -0,0 +1,41 @@
+package plugins
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+)
+
+func TestRunNagiosPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := filepath.Join(dir, "cfg.json")
+	ioutil.WriteFile(cfg, []byte(fmt.Sprintf(`{"hostname": "host", "plugin": {"dir": %q, "logs": %q}}`, dir, dir)), 0644)
+	g.ParseConfig(cfg)
+
+	// the stderr written to the log does not hide the exit status
+	script := "#!/bin/sh\necho 'DISK CRITICAL - / is 95% full | used=95%;80;90'\necho 'df warning' >&2\nexit 2\n"
+	ioutil.WriteFile(filepath.Join(dir, "60_check_disk.nagios.sh"), []byte(script), 0755)
+
+	metrics, exitCode, ok, _ := runPlugin(&Plugin{FilePath: "60_check_disk.nagios.sh", Cycle: 60})
+	if exitCode != 2 || !ok {
+		t.Errorf("expect exit code 2 and the output parsed, but %d %v", exitCode, ok)
+	}
+	if len(metrics) == 0 {
+		t.Fatal("expect the metrics of the nagios check")
+	}
+	if mv := metrics[0]; mv.Metric != "nagios.status" || fmt.Sprint(mv.Value) != "2" {
+		t.Errorf("expect nagios.status 2, but %v", mv)
+	}
+	if bs, _ := ioutil.ReadFile(filepath.Join(dir, "60_check_disk.nagios.sh().stderr.log")); string(bs) != "df warning\n" {
+		t.Errorf("expect the stderr logged, but %q", bs)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugins
+
+import (
+	"sync"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+)
+
+type PluginStat struct {
+	Duration    float64 `json:"duration"` // seconds of the last run
+	ExitCode    int     `json:"exitCode"`
+	Runs        int64   `json:"runs"`
+	Timeouts    int64   `json:"timeouts"`
+	LastSuccess int64   `json:"lastSuccess"`
+}
+
+var (
+	// FilePath(Args) => *PluginStat
+	stats     = make(map[string]*PluginStat)
+	statsLock = new(sync.RWMutex)
+)
+
+func statKey(plugin *Plugin) string {
+	return plugin.FilePath + "(" + plugin.Args + ")"
+}
+
+func Stats() map[string]PluginStat {
+	statsLock.RLock()
+	defer statsLock.RUnlock()
+	ret := make(map[string]PluginStat, len(stats))
+	for k, v := range stats {
+		ret[k] = *v
+	}
+	return ret
+}
+
+func recordRun(plugin *Plugin, duration time.Duration, exitCode int, ok bool, isTimeout bool) PluginStat {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	key := statKey(plugin)
+	stat, exists := stats[key]
+	if !exists {
+		stat = &PluginStat{}
+		stats[key] = stat
+	}
+
+	stat.Duration = duration.Seconds()
+	stat.ExitCode = exitCode
+	stat.Runs++
+	if isTimeout {
+		stat.Timeouts++
+	}
+	if ok {
+		stat.LastSuccess = time.Now().Unix()
+	}
+
+	return *stat
+}
+
+func deleteStat(plugin *Plugin) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	delete(stats, statKey(plugin))
+}
+
+// Metrics are tagged by plugin=$name as the metrics of nagios checks, plus args=$Args if any
+func (this PluginStat) Metrics(plugin *Plugin) []*model.MetricValue {
+	hostname, err := g.Hostname()
+	if err != nil {
+		return nil
+	}
+
+	tags := "plugin=" + utils.SanitizeTag(PluginName(plugin.FilePath))
+	if plugin.Args != "" {
+		tags += ",args=" + utils.SanitizeTag(plugin.Args)
+	}
+
+	L := []*model.MetricValue{
+		newMetricValue("plugin.duration", this.Duration, "GAUGE", tags),
+		newMetricValue("plugin.exit.code", this.ExitCode, "GAUGE", tags),
+		newMetricValue("plugin.timeout.count", this.Timeouts, "COUNTER", tags),
+		newMetricValue("plugin.last.success", this.LastSuccess, "GAUGE", tags),
+	}
+
+	now := time.Now().Unix()
+	for _, mv := range L {
+		mv.Endpoint = hostname
+		mv.Step = int64(plugin.Cycle)
+		mv.Timestamp = now
+	}
+
+	return L
+}
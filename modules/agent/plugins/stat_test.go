@@ -0,0 +1,123 @@
+package plugins
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+)
+
+func TestRecordRun(t *testing.T) {
+	plugin := &Plugin{FilePath: "sys/60_check_load.nagios.sh", Args: "1, 2", Cycle: 60}
+	defer deleteStat(plugin)
+
+	stat := recordRun(plugin, 2*time.Second, 0, true, false)
+	if stat.Runs != 1 || stat.ExitCode != 0 || stat.Duration != 2 || stat.Timeouts != 0 || stat.LastSuccess == 0 {
+		t.Errorf("unexpected stat of a success %+v", stat)
+	}
+	success := stat.LastSuccess
+
+	stat = recordRun(plugin, time.Second, 2, false, false)
+	if stat.Runs != 2 || stat.ExitCode != 2 || stat.Duration != 1 || stat.Timeouts != 0 || stat.LastSuccess != success {
+		t.Errorf("unexpected stat of a failure %+v", stat)
+	}
+
+	stat = recordRun(plugin, 59*time.Second, -1, false, true)
+	if stat.Runs != 3 || stat.ExitCode != -1 || stat.Timeouts != 1 || stat.LastSuccess != success {
+		t.Errorf("unexpected stat of a timeout %+v", stat)
+	}
+
+	if s, ok := Stats()[statKey(plugin)]; !ok || s != stat {
+		t.Errorf("expect %+v in the stats, but %+v", stat, s)
+	}
+}
+
+func TestStatMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := filepath.Join(dir, "cfg.json")
+	ioutil.WriteFile(cfg, []byte(`{"hostname": "host", "plugin": {}}`), 0644)
+	g.ParseConfig(cfg)
+
+	plugin := &Plugin{FilePath: "sys/60_check_load.nagios.sh", Args: "a=1, b", Cycle: 60}
+	stat := PluginStat{Duration: 1.5, ExitCode: 2, Runs: 3, Timeouts: 1, LastSuccess: 100}
+
+	got := []string{}
+	for _, mv := range stat.Metrics(plugin) {
+		if mv.Endpoint != "host" || mv.Step != 60 || mv.Timestamp == 0 {
+			t.Errorf("unexpected %v", mv)
+		}
+		got = append(got, fmt.Sprintf("%s/%s/%s=%v", mv.Type, mv.Tags, mv.Metric, mv.Value))
+	}
+
+	tags := "plugin=check_load,args=a_1__b"
+	expect := []string{
+		"GAUGE/" + tags + "/plugin.duration=1.5",
+		"GAUGE/" + tags + "/plugin.exit.code=2",
+		"COUNTER/" + tags + "/plugin.timeout.count=1",
+		"GAUGE/" + tags + "/plugin.last.success=100",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expect) {
+		t.Errorf("expect %v, but %v", expect, got)
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	semaOnce.Do(func() {})
+	sema = make(chan struct{}, 1)
+	defer func() { sema = nil }()
+
+	plugin := &Plugin{FilePath: "check_load.sh", Cycle: 1}
+	if !acquire(plugin) {
+		t.Fatal("expect a free slot")
+	}
+
+	// a slot released within the cycle is taken
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		release()
+	}()
+	start := time.Now()
+	if !acquire(plugin) {
+		t.Fatal("expect the released slot")
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed >= time.Second {
+		t.Errorf("expect to wait for the release, but %v", elapsed)
+	}
+
+	// none released, skipped after one cycle
+	start = time.Now()
+	if acquire(plugin) {
+		t.Fatal("expect no slot")
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expect to wait one cycle, but %v", elapsed)
+	}
+	release()
+}
+
+func TestJitter(t *testing.T) {
+	cycle := 60 * time.Second
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		d := jitter(cycle)
+		if d < 0 || d >= cycle {
+			t.Fatalf("expect the delay within the cycle, but %v", d)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 50 {
+		t.Errorf("expect the delays spread, but %d distinct", len(seen))
+	}
+	if d := jitter(0); d != 0 {
+		t.Errorf("expect no delay without a cycle, but %v", d)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+)
+
+type series struct {
+	Name string
+	Tags string
+}
+
+// a gauge not updated for so many flushes is forgotten
+const GaugeExpireFlushes = 10
+
+// Aggregator keeps the values received in one interval,
+// counters, timers and sets are reset by Flush, gauges are kept until they expire.
+type Aggregator struct {
+	sync.Mutex
+	counters map[series]float64
+	gauges   map[series]*gauge
+	timers   map[series]*timer
+	sets     map[series]map[string]struct{}
+}
+
+type gauge struct {
+	Value float64
+	Idle  int // flushes since the last update
+}
+
+type timer struct {
+	Count  float64 // scaled by the sample rate
+	Values []float64
+}
+
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		counters: make(map[series]float64),
+		gauges:   make(map[series]*gauge),
+		timers:   make(map[series]*timer),
+		sets:     make(map[series]map[string]struct{}),
+	}
+}
+
+func (this *Aggregator) Add(p *Packet) {
+	this.Lock()
+	defer this.Unlock()
+
+	key := series{Name: p.Name, Tags: p.Tags}
+	switch p.Type {
+	case TypeCounter:
+		this.counters[key] += p.Value / p.SampleRate
+	case TypeGauge:
+		g, ok := this.gauges[key]
+		if !ok {
+			g = &gauge{}
+			this.gauges[key] = g
+		}
+		if p.Relative {
+			g.Value += p.Value
+		} else {
+			g.Value = p.Value
+		}
+		g.Idle = 0
+	case TypeTimer, TypeHisto:
+		t, ok := this.timers[key]
+		if !ok {
+			t = &timer{}
+			this.timers[key] = t
+		}
+		t.Count += 1 / p.SampleRate
+		t.Values = append(t.Values, p.Value)
+	case TypeSet:
+		s, ok := this.sets[key]
+		if !ok {
+			s = make(map[string]struct{})
+			this.sets[key] = s
+		}
+		s[p.SetValue] = struct{}{}
+	}
+}
+
+// Flush returns the metrics of the interval in seconds, endpoint and timestamp are left blank.
+// The metrics are named by type as statsd does, a name used by several types stays apart.
+func (this *Aggregator) Flush(interval int64) (L []*model.MetricValue) {
+	this.Lock()
+	counters, timers, sets := this.counters, this.timers, this.sets
+	this.counters = make(map[series]float64)
+	this.timers = make(map[series]*timer)
+	this.sets = make(map[series]map[string]struct{})
+	for key, g := range this.gauges {
+		if g.Idle >= GaugeExpireFlushes {
+			delete(this.gauges, key)
+			continue
+		}
+		g.Idle++
+		L = append(L, gaugeValue(key, "gauges."+key.Name, g.Value))
+	}
+	this.Unlock()
+
+	for key, val := range counters {
+		L = append(L, gaugeValue(key, "counters."+key.Name+".count", val))
+		L = append(L, gaugeValue(key, "counters."+key.Name+".rate", val/float64(interval)))
+	}
+
+	for key, s := range sets {
+		L = append(L, gaugeValue(key, "sets."+key.Name+".count", len(s)))
+	}
+
+	for key, t := range timers {
+		values := t.Values
+		sort.Float64s(values)
+
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+
+		name := "timers." + key.Name
+		L = append(L, gaugeValue(key, name+".count", t.Count))
+		L = append(L, gaugeValue(key, name+".mean", sum/float64(len(values))))
+		L = append(L, gaugeValue(key, name+".upper", values[len(values)-1]))
+		L = append(L, gaugeValue(key, name+".lower", values[0]))
+		L = append(L, gaugeValue(key, name+".p90", percentile(values, 90)))
+		L = append(L, gaugeValue(key, name+".p99", percentile(values, 99)))
+	}
+
+	return
+}
+
+// nearest rank of the sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func gaugeValue(key series, metric string, val interface{}) *model.MetricValue {
+	return &model.MetricValue{
+		Metric: metric,
+		Value:  val,
+		Type:   "GAUGE",
+		Tags:   key.Tags,
+	}
+}
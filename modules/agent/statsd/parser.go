@@ -0,0 +1,113 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	TypeCounter = "c"
+	TypeGauge   = "g"
+	TypeTimer   = "ms"
+	TypeHisto   = "h"
+	TypeSet     = "s"
+)
+
+type Packet struct {
+	Name       string
+	Tags       string
+	Type       string
+	Value      float64
+	SetValue   string
+	SampleRate float64
+	// gauge with a leading +/- changes the current value
+	Relative bool
+}
+
+// ParseLine parses one statsd line such as 'api.requests:1|c|@0.1', 'queue.size:+3|g' or 'api.users:jack|s',
+// dogstatsd tags are accepted as well: 'api.latency:320|ms|#method:get,code:200'
+func ParseLine(line string) (*Packet, error) {
+	colon := strings.LastIndex(line, ":")
+	if colon <= 0 {
+		return nil, fmt.Errorf("bad line: %s", line)
+	}
+	// the tags may contain ':' too
+	if pipe := strings.Index(line, "|"); pipe > 0 && colon > pipe {
+		colon = strings.LastIndex(line[:pipe], ":")
+		if colon <= 0 {
+			return nil, fmt.Errorf("bad line: %s", line)
+		}
+	}
+
+	p := &Packet{Name: line[:colon], SampleRate: 1}
+	fields := strings.Split(line[colon+1:], "|")
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("bad line: %s", line)
+	}
+
+	raw := fields[0]
+	p.Type = fields[1]
+
+	for _, field := range fields[2:] {
+		if strings.HasPrefix(field, "@") {
+			rate, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("bad sample rate: %s", line)
+			}
+			p.SampleRate = rate
+		} else if strings.HasPrefix(field, "#") {
+			p.Tags = parseTags(field[1:])
+		}
+	}
+
+	switch p.Type {
+	case TypeSet:
+		p.SetValue = raw
+		return p, nil
+	case TypeCounter, TypeGauge, TypeTimer, TypeHisto:
+	default:
+		return nil, fmt.Errorf("unknown type %s: %s", p.Type, line)
+	}
+
+	if p.Type == TypeGauge && (strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-")) {
+		p.Relative = true
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad value: %s", line)
+	}
+	p.Value = value
+
+	return p, nil
+}
+
+// k1:v1,k2:v2 => k1=v1,k2=v2 sorted
+func parseTags(s string) string {
+	tags := []string{}
+	for _, tag := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(tag), ":", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			continue
+		}
+		tags = append(tags, kv[0]+"="+strings.Replace(kv[1], "=", "_", -1))
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, ",")
+}
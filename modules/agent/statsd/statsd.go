@@ -0,0 +1,99 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/modules/agent/g"
+)
+
+var aggregator = NewAggregator()
+
+func Start() {
+	cfg := g.Config().Statsd
+	if cfg == nil || !cfg.Enabled || cfg.Listen == "" {
+		return
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", cfg.Listen)
+	if err != nil {
+		log.Fatalln("statsd resolve", cfg.Listen, "fail:", err)
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		log.Fatalln("statsd listen", cfg.Listen, "fail:", err)
+	}
+
+	log.Println("statsd listening", cfg.Listen)
+
+	go flush()
+	serve(conn)
+}
+
+func serve(conn *net.UDPConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			log.Println("statsd read fail:", err)
+			continue
+		}
+
+		for _, line := range bytes.Split(buf[:n], []byte("\n")) {
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+
+			p, err := ParseLine(string(line))
+			if err != nil {
+				if g.Config().Debug {
+					log.Println("statsd", err)
+				}
+				continue
+			}
+			aggregator.Add(p)
+		}
+	}
+}
+
+func flush() {
+	interval := int64(g.Config().Transfer.Interval)
+	t := time.NewTicker(time.Second * time.Duration(interval))
+	defer t.Stop()
+	for {
+		<-t.C
+
+		hostname, err := g.Hostname()
+		if err != nil {
+			continue
+		}
+
+		mvs := aggregator.Flush(interval)
+		now := time.Now().Unix()
+		for j := 0; j < len(mvs); j++ {
+			mvs[j].Step = interval
+			mvs[j].Endpoint = hostname
+			mvs[j].Timestamp = now
+		}
+
+		g.SendToTransfer(mvs)
+	}
+}
@@ -0,0 +1,100 @@
+package statsd
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	cases := []struct {
+		line   string
+		expect Packet
+	}{
+		{"api.requests:1|c", Packet{Name: "api.requests", Type: TypeCounter, Value: 1, SampleRate: 1}},
+		{"api.requests:2|c|@0.5", Packet{Name: "api.requests", Type: TypeCounter, Value: 2, SampleRate: 0.5}},
+		{"api.latency:320|ms|#method:get,code:200", Packet{Name: "api.latency", Tags: "code=200,method=get", Type: TypeTimer, Value: 320, SampleRate: 1}},
+		{"queue.size:-3|g", Packet{Name: "queue.size", Type: TypeGauge, Value: -3, SampleRate: 1, Relative: true}},
+		{"api.users:jack|s", Packet{Name: "api.users", Type: TypeSet, SetValue: "jack", SampleRate: 1}},
+	}
+
+	for _, c := range cases {
+		p, err := ParseLine(c.line)
+		if err != nil {
+			t.Errorf("parse %s fail: %v", c.line, err)
+			continue
+		}
+		if *p != c.expect {
+			t.Errorf("parse %s, expect %+v, but %+v", c.line, c.expect, *p)
+		}
+	}
+
+	for _, line := range []string{"api.requests", "api.requests:1", "api.requests:x|c", "api.requests:1|x", "api.requests:1|c|@2"} {
+		if _, err := ParseLine(line); err == nil {
+			t.Errorf("expect error for %s", line)
+		}
+	}
+}
+
+func TestAggregatorFlush(t *testing.T) {
+	a := NewAggregator()
+	lines := []string{"req:1|c", "req:1|c|@0.1", "mem:10|g", "mem:+5|g", "u:a|s", "u:b|s", "u:a|s"}
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf("lat:%d|ms", i))
+	}
+	for _, line := range lines {
+		p, err := ParseLine(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.Add(p)
+	}
+
+	got := []string{}
+	for _, mv := range a.Flush(10) {
+		got = append(got, fmt.Sprintf("%s=%v", mv.Metric, mv.Value))
+	}
+	sort.Strings(got)
+
+	expect := []string{
+		"counters.req.count=11", "counters.req.rate=1.1", "gauges.mem=15", "sets.u.count=2",
+		"timers.lat.count=100", "timers.lat.lower=1", "timers.lat.mean=50.5", "timers.lat.p90=90", "timers.lat.p99=99", "timers.lat.upper=100",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expect) {
+		t.Errorf("expect %v, but %v", expect, got)
+	}
+
+	// only the gauge survives the flush, until it is not updated for GaugeExpireFlushes
+	for i := 1; i < GaugeExpireFlushes; i++ {
+		if L := a.Flush(10); len(L) != 1 || L[0].Metric != "gauges.mem" {
+			t.Fatalf("flush %d: expect only gauge left, but %v", i, L)
+		}
+	}
+	if L := a.Flush(10); len(L) != 0 {
+		t.Errorf("expect the gauge expired, but %v", L)
+	}
+}
+
+func TestAggregatorNameOfTypes(t *testing.T) {
+	a := NewAggregator()
+	for _, line := range []string{"x:3|c", "x:a|s", "x:5|ms"} {
+		p, err := ParseLine(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.Add(p)
+	}
+
+	seen := make(map[string]bool)
+	for _, mv := range a.Flush(10) {
+		if seen[mv.Metric] {
+			t.Errorf("%s is written by two types", mv.Metric)
+		}
+		seen[mv.Metric] = true
+	}
+	for _, metric := range []string{"counters.x.count", "sets.x.count", "timers.x.count"} {
+		if !seen[metric] {
+			t.Errorf("expect %s, but %v", metric, seen)
+		}
+	}
+}
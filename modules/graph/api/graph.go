@@ -417,5 +417,23 @@ func GetLast(endpoint, counter string) *cmodel.RRDData {
 func GetLastRaw(endpoint, counter string) *cmodel.RRDData {
 	md5 := cutils.Md5(endpoint + "/" + counter)
 	item := store.GetLastItem(md5)
-	return cmodel.NewRRDData(item.Timestamp, item.Value)
+	return cmodel.NewRRDData(heldTs(item, time.Now().Unix()), item.Value)
+}
+
+// a deduplicated GAUGE is only sent on change, its value holds
+// till the heartbeat expires, so that nodata does not fire in between
+func heldTs(item *cmodel.GraphItem, now int64) int64 {
+	step := int64(item.Step)
+	if item.DsType != g.GAUGE || step <= 0 || int64(item.Heartbeat) <= 2*step {
+		return item.Timestamp
+	}
+	if now-item.Timestamp >= int64(item.Heartbeat) {
+		return item.Timestamp
+	}
+
+	ts := now - now%step
+	if ts < item.Timestamp {
+		return item.Timestamp
+	}
+	return ts
 }
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"testing"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/graph/g"
+)
+
+func TestHeldTs(t *testing.T) {
+	cases := []struct {
+		dsType    string
+		step      int
+		heartbeat int
+		now       int64
+		expect    int64
+	}{
+		// not deduplicated
+		{g.GAUGE, 60, 120, 900, 600},
+		{g.DERIVE, 60, 660, 700, 600},
+		{g.GAUGE, 0, 660, 700, 600},
+		// held, aligned to the step
+		{g.GAUGE, 60, 660, 600, 600},
+		{g.GAUGE, 60, 660, 659, 600},
+		{g.GAUGE, 60, 660, 725, 720},
+		{g.GAUGE, 60, 660, 1259, 1200},
+		// the heartbeat expired
+		{g.GAUGE, 60, 660, 1260, 600},
+		{g.GAUGE, 60, 660, 5000, 600},
+	}
+
+	for i, c := range cases {
+		item := &cmodel.GraphItem{DsType: c.dsType, Step: c.step, Heartbeat: c.heartbeat, Timestamp: 600}
+		if got := heldTs(item, c.now); got != c.expect {
+			t.Errorf("case %d: expect %d, but %d", i, c.expect, got)
+		}
+	}
+}
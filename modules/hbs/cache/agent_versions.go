@@ -0,0 +1,110 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/hbs/db"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 一个HostGroup最多指定一个agent版本
+type SafeGroupAgentVersions struct {
+	sync.RWMutex
+	M map[int]*model.AgentUpgrade
+}
+
+var GroupAgentVersions = &SafeGroupAgentVersions{M: make(map[int]*model.AgentUpgrade)}
+
+func (this *SafeGroupAgentVersions) Get(gid int) (*model.AgentUpgrade, bool) {
+	this.RLock()
+	defer this.RUnlock()
+	v, exists := this.M[gid]
+	return v, exists
+}
+
+func (this *SafeGroupAgentVersions) Init() {
+	m, err := db.QueryAgentVersions()
+	if err != nil {
+		return
+	}
+
+	this.Lock()
+	defer this.Unlock()
+	this.M = m
+}
+
+// 机器可能属于多个Group，取其中最高的版本
+func GetAgentUpgrade(hostname string) *model.AgentUpgrade {
+	hid, exists := HostMap.GetID(hostname)
+	if !exists {
+		return nil
+	}
+
+	gids, exists := HostGroupsMap.GetGroupIds(hid)
+	if !exists {
+		return nil
+	}
+
+	var ret *model.AgentUpgrade
+	for _, gid := range gids {
+		v, exists := GroupAgentVersions.Get(gid)
+		if !exists {
+			continue
+		}
+
+		if ret == nil || CompareVersion(v.Version, ret.Version) > 0 {
+			ret = v
+		}
+	}
+
+	return ret
+}
+
+// CompareVersion compares dotted versions like 5.1.2 part by part, numerically if both parts are numbers
+func CompareVersion(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+
+		xn, errx := strconv.Atoi(x)
+		yn, erry := strconv.Atoi(y)
+		if errx == nil && erry == nil {
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+			continue
+		}
+
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
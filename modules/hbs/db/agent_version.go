@@ -0,0 +1,47 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"github.com/open-falcon/falcon-plus/common/model"
+	"log"
+)
+
+func QueryAgentVersions() (map[int]*model.AgentUpgrade, error) {
+	m := make(map[int]*model.AgentUpgrade)
+
+	sql := "select grp_id, version, url, checksum from agent_version"
+	rows, err := DB.Query(sql)
+	if err != nil {
+		log.Println("ERROR:", err)
+		return m, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		v := &model.AgentUpgrade{}
+
+		err = rows.Scan(&id, &v.Version, &v.Url, &v.Checksum)
+		if err != nil {
+			log.Println("ERROR:", err)
+			continue
+		}
+
+		m[id] = v
+	}
+
+	return m, nil
+}
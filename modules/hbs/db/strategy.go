@@ -89,7 +89,7 @@ func QueryStrategies(tpls map[int]*model.Template) (map[int]*model.Strategy, err
 
 func QueryBuiltinMetrics(tids string) ([]*model.BuiltinMetric, error) {
 	sql := fmt.Sprintf(
-		"select metric, tags from strategy where tpl_id in (%s) and metric in ('net.port.listen', 'proc.num', 'du.bs', 'url.check.health')",
+		"select metric, tags from strategy where tpl_id in (%s) and metric in ('net.port.listen', 'proc.num', 'du.bs', 'url.check.health', 'prometheus.up', 'log.keyword', 'net.port.connect', 'redis.up', 'mysql.up', 'nginx.up', 'net.port.established', 'net.port.timewait', 'net.port.accept.queue')",
 		tids,
 	)
 
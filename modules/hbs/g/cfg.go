@@ -16,6 +16,8 @@ package g
 
 import (
 	"encoding/json"
+	"github.com/open-falcon/falcon-plus/common/auth"
+	"github.com/open-falcon/falcon-plus/common/utils"
 	"github.com/toolkits/file"
 	"log"
 	"sync"
@@ -27,14 +29,16 @@ type HttpConfig struct {
 }
 
 type GlobalConfig struct {
-	Debug     bool        `json:"debug"`
-	Hosts     string      `json:"hosts"`
-	Database  string      `json:"database"`
-	MaxConns  int         `json:"maxConns"`
-	MaxIdle   int         `json:"maxIdle"`
-	Listen    string      `json:"listen"`
-	Trustable []string    `json:"trustable"`
-	Http      *HttpConfig `json:"http"`
+	Debug     bool             `json:"debug"`
+	Hosts     string           `json:"hosts"`
+	Database  string           `json:"database"`
+	MaxConns  int              `json:"maxConns"`
+	MaxIdle   int              `json:"maxIdle"`
+	Listen    string           `json:"listen"`
+	Tls       *utils.TLSConfig `json:"tls"`
+	Auth      *auth.Config     `json:"auth"`
+	Trustable []string         `json:"trustable"`
+	Http      *HttpConfig      `json:"http"`
 }
 
 var (
@@ -30,6 +30,11 @@ func configProcRoutes() {
 		RenderDataJson(w, cache.Agents.Keys())
 	})
 
+	// rollout progress of the agent versions set on the host groups
+	http.HandleFunc("/agents/upgrade", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, agentUpgradeProgress())
+	})
+
 	http.HandleFunc("/hosts", func(w http.ResponseWriter, r *http.Request) {
 		data := make(map[string]*model.Host, len(cache.MonitoredHosts.Get()))
 		for k, v := range cache.MonitoredHosts.Get() {
@@ -0,0 +1,78 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/hbs/cache"
+)
+
+type AgentUpgradeHost struct {
+	AgentVersion string `json:"agentVersion"`
+	Desired      string `json:"desired"`
+	Status       string `json:"status"`
+	Message      string `json:"message"`
+	LastUpdate   int64  `json:"lastUpdate"`
+}
+
+// desired version => status => count, "pending" for the agents not tried yet
+type AgentUpgradeProgress struct {
+	Versions map[string]map[string]int    `json:"versions"`
+	Hosts    map[string]*AgentUpgradeHost `json:"hosts"`
+}
+
+func agentUpgradeProgress() *AgentUpgradeProgress {
+	ret := &AgentUpgradeProgress{
+		Versions: make(map[string]map[string]int),
+		Hosts:    make(map[string]*AgentUpgradeHost),
+	}
+
+	for _, hostname := range cache.Agents.Keys() {
+		info, exists := cache.Agents.Get(hostname)
+		if !exists {
+			continue
+		}
+
+		desired := cache.GetAgentUpgrade(hostname)
+		if desired == nil {
+			continue
+		}
+
+		req := info.ReportRequest
+		host := &AgentUpgradeHost{
+			AgentVersion: req.AgentVersion,
+			Desired:      desired.Version,
+			LastUpdate:   info.LastUpdate,
+		}
+
+		switch {
+		case req.AgentVersion == desired.Version:
+			host.Status = model.UpgradeDone
+		case req.Upgrade != nil && req.Upgrade.Version == desired.Version:
+			host.Status = req.Upgrade.Status
+			host.Message = req.Upgrade.Message
+		default:
+			host.Status = "pending"
+		}
+
+		ret.Hosts[hostname] = host
+		if _, exists := ret.Versions[desired.Version]; !exists {
+			ret.Versions[desired.Version] = make(map[string]int)
+		}
+		ret.Versions[desired.Version][host.Status]++
+	}
+
+	return ret
+}
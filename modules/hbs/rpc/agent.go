@@ -36,7 +36,12 @@ func (t *Agent) MinePlugins(args model.AgentHeartbeatRequest, reply *model.Agent
 	return nil
 }
 
-func (t *Agent) ReportStatus(args *model.AgentReportRequest, reply *model.SimpleRpcResponse) error {
+// the credential is checked by the codec when auth is enabled
+func (t *Agent) Auth(args *model.AuthRequest, reply *model.SimpleRpcResponse) error {
+	return nil
+}
+
+func (t *Agent) ReportStatus(args *model.AgentReportRequest, reply *model.AgentReportResponse) error {
 	if args.Hostname == "" {
 		reply.Code = 1
 		return nil
@@ -44,6 +49,11 @@ func (t *Agent) ReportStatus(args *model.AgentReportRequest, reply *model.Simple
 
 	cache.Agents.Put(args)
 
+	// 老版本的agent不认识Upgrade字段，会直接忽略
+	if upgrade := cache.GetAgentUpgrade(args.Hostname); upgrade != nil && upgrade.Version != args.AgentVersion {
+		reply.Upgrade = upgrade
+	}
+
 	return nil
 }
 
@@ -15,26 +15,48 @@
 package rpc
 
 import (
+	"crypto/tls"
+	"errors"
 	"log"
 	"net"
 	"net/rpc"
 	"net/rpc/jsonrpc"
 	"time"
 
+	"github.com/open-falcon/falcon-plus/common/auth"
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/utils"
 	"github.com/open-falcon/falcon-plus/modules/hbs/g"
 )
 
 type Hbs int
 type Agent int
 
+var server = rpc.NewServer()
+
 func Start() {
 	addr := g.Config().Listen
 
-	server := rpc.NewServer()
 	// server.Register(new(filter.Filter))
 	server.Register(new(Agent))
 	server.Register(new(Hbs))
 
+	// judge only speaks plain rpc, agents across untrusted networks use the tls listener
+	if tlsCfg := g.Config().Tls; tlsCfg != nil && tlsCfg.Enabled {
+		conf, err := utils.ServerTLSConfig(tlsCfg)
+		if err != nil {
+			log.Fatalln("load tls config error:", err)
+		}
+
+		l, e := tls.Listen("tcp", tlsCfg.Listen, conf)
+		if e != nil {
+			log.Fatalln("listen error:", e)
+		} else {
+			log.Println("tls listening", tlsCfg.Listen)
+		}
+		go serve(l)
+	}
+
 	l, e := net.Listen("tcp", addr)
 	if e != nil {
 		log.Fatalln("listen error:", e)
@@ -42,6 +64,10 @@ func Start() {
 		log.Println("listening", addr)
 	}
 
+	serve(l)
+}
+
+func serve(l net.Listener) {
 	for {
 		conn, err := l.Accept()
 		if err != nil {
@@ -49,6 +75,48 @@ func Start() {
 			time.Sleep(time.Duration(100) * time.Millisecond)
 			continue
 		}
-		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+		go serveConn(conn)
+	}
+}
+
+func serveConn(conn net.Conn) {
+	codec := jsonrpc.NewServerCodec(conn)
+	if cfg := g.Config().Auth; cfg != nil && cfg.Enabled {
+		codec = auth.NewServerCodec(codec, conn, cfg, "Agent.Auth", map[string]auth.Check{
+			"Agent.ReportStatus":   checkHostname,
+			"Agent.MinePlugins":    checkHostname,
+			"Agent.BuiltinMetrics": checkHostname,
+			"Hbs.GetStrategies":    checkShared,
+			"Hbs.GetExpressions":   checkShared,
+		})
+	}
+	server.ServeCodec(codec)
+}
+
+// the strategies of every host, for judge with the shared token only
+func checkShared(host string, args interface{}) error {
+	if host != auth.AnyHost {
+		return errors.New(host + " may not call it with a host token")
+	}
+	return nil
+}
+
+// a host may only act as itself
+func checkHostname(host string, args interface{}) error {
+	if host == auth.AnyHost {
+		return nil
+	}
+
+	var hostname string
+	switch req := args.(type) {
+	case *model.AgentReportRequest:
+		hostname = req.Hostname
+	case *model.AgentHeartbeatRequest:
+		hostname = req.Hostname
+	}
+
+	if hostname != host {
+		return errors.New("hostname " + hostname + " is not " + host)
 	}
+	return nil
 }
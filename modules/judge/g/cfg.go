@@ -35,6 +35,7 @@ type HbsConfig struct {
 	Servers  []string `json:"servers"`
 	Timeout  int64    `json:"timeout"`
 	Interval int64    `json:"interval"`
+	Token    string   `json:"token"` // shared token of hbs auth, sent by Agent.Auth
 }
 
 type RedisConfig struct {
@@ -15,6 +15,7 @@
 package g
 
 import (
+	"github.com/open-falcon/falcon-plus/common/model"
 	"github.com/toolkits/net"
 	"log"
 	"math"
@@ -28,6 +29,7 @@ type SingleConnRpcClient struct {
 	rpcClient  *rpc.Client
 	RpcServers []string
 	Timeout    time.Duration
+	Auth       *model.AuthRequest // called by Agent.Auth first on every connection if set
 }
 
 func (this *SingleConnRpcClient) close() {
@@ -52,6 +54,12 @@ func (this *SingleConnRpcClient) insureConn() {
 
 		for _, s := range this.RpcServers {
 			this.rpcClient, err = net.JsonRpcClient("tcp", s, this.Timeout)
+			if err == nil && this.Auth != nil {
+				var resp model.SimpleRpcResponse
+				if err = this.rpcClient.Call("Agent.Auth", this.Auth, &resp); err != nil {
+					this.close()
+				}
+			}
 			if err == nil {
 				return
 			}
@@ -15,6 +15,7 @@
 package g
 
 import (
+	"os"
 	"sync"
 	"time"
 
@@ -57,6 +58,10 @@ func InitHbsClient() {
 		RpcServers: Config().Hbs.Servers,
 		Timeout:    time.Duration(Config().Hbs.Timeout) * time.Millisecond,
 	}
+	if token := Config().Hbs.Token; token != "" {
+		hostname, _ := os.Hostname()
+		HbsClient.Auth = &model.AuthRequest{Hostname: hostname, Token: token}
+	}
 }
 
 func (this *SafeStrategyMap) ReInit(m map[string][]model.Strategy) {
@@ -16,6 +16,9 @@ package g
 
 import (
 	"encoding/json"
+	"fmt"
+	"github.com/open-falcon/falcon-plus/common/auth"
+	"github.com/open-falcon/falcon-plus/common/utils"
 	"github.com/toolkits/file"
 	"log"
 	"strings"
@@ -28,14 +31,73 @@ type HttpConfig struct {
 }
 
 type RpcConfig struct {
+	Enabled bool             `json:"enabled"`
+	Listen  string           `json:"listen"`
+	Tls     *utils.TLSConfig `json:"tls"`
+	Auth    *auth.Config     `json:"auth"`
+}
+
+type SocketConfig struct {
 	Enabled bool   `json:"enabled"`
 	Listen  string `json:"listen"`
+	Timeout int    `json:"timeout"`
 }
 
-type SocketConfig struct {
+// the items which can not be sent or queued in memory overflow to a queue on disk
+// per backend node, which is drained in order when the node recovers
+type OverflowConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Dir         string `json:"dir"`
+	MaxSize     int64  `json:"maxSize"`     // MB per backend node, the oldest segments are dropped beyond it
+	SegmentSize int64  `json:"segmentSize"` // MB
+}
+
+// graphite plaintext `path value [ts]` over tcp and udp,
+// a template is "[filter] template [tag1=v1,tag2=v2]", see receiver/socket/graphite.go
+type GraphiteConfig struct {
+	Enabled   bool     `json:"enabled"`
+	Listen    string   `json:"listen"`
+	Timeout   int      `json:"timeout"`     // seconds a tcp connection may be idle
+	Step      int64    `json:"step"`        // 60 by default
+	Type      string   `json:"counterType"` // GAUGE by default
+	Endpoint  string   `json:"endpoint"`    // when the template has none, the peer ip otherwise
+	Templates []string `json:"templates"`
+}
+
+// opentsdb `put metric ts value tag1=v1` lines over tcp and udp,
+// the endpoint is the host tag, the peer ip without one
+type OpenTsdbConfig struct {
 	Enabled bool   `json:"enabled"`
 	Listen  string `json:"listen"`
 	Timeout int    `json:"timeout"`
+	Step    int64  `json:"step"`
+	Type    string `json:"counterType"`
+}
+
+// prometheus remote write to http /api/v1/prom/write
+type PrometheusConfig struct {
+	Enabled       bool   `json:"enabled"`
+	EndpointLabel string `json:"endpointLabel"` // instance by default
+	TrimPort      bool   `json:"trimPort"`      // host:port of the endpoint label => host
+	Step          int64  `json:"step"`          // the scrape interval, 60 by default
+}
+
+// route rules decide the backends and clusters of the items received,
+// the first rule matched is used, route.default without one
+type RouteConfig struct {
+	Enabled bool         `json:"enabled"`
+	Default []string     `json:"default"` // all the backends if not set
+	Rules   []*RouteRule `json:"rules"`
+}
+
+// the conditions set have to be matched all, a regexp has to match the whole value
+type RouteRule struct {
+	Name         string            `json:"name"`
+	MetricPrefix string            `json:"metricPrefix"`
+	Metric       string            `json:"metric"`   // regexp
+	Endpoint     string            `json:"endpoint"` // regexp
+	Tags         map[string]string `json:"tags"`     // tag -> regexp, the tag has to exist
+	Backends     []string          `json:"backends"` // graph, judge, tsdb, judge:cluster
 }
 
 type JudgeConfig struct {
@@ -47,7 +109,9 @@ type JudgeConfig struct {
 	MaxIdle     int                     `json:"maxIdle"`
 	Replicas    int                     `json:"replicas"`
 	Cluster     map[string]string       `json:"cluster"`
-	ClusterList map[string]*ClusterNode `json:"clusterList"`
+	ClusterList map[string]*ClusterNode `json:"clusterList"` // the nodes of cluster and clusters
+	// the clusters used by route rules, cluster -> node -> addr
+	Clusters map[string]map[string]string `json:"clusters"`
 }
 
 type GraphConfig struct {
@@ -59,7 +123,9 @@ type GraphConfig struct {
 	MaxIdle     int                     `json:"maxIdle"`
 	Replicas    int                     `json:"replicas"`
 	Cluster     map[string]string       `json:"cluster"`
-	ClusterList map[string]*ClusterNode `json:"clusterList"`
+	ClusterList map[string]*ClusterNode `json:"clusterList"` // the nodes of cluster and clusters
+	// rejected until api and nodata read them, cluster -> node -> addr
+	Clusters map[string]map[string]string `json:"clusters"`
 }
 
 type TsdbConfig struct {
@@ -82,6 +148,13 @@ type GlobalConfig struct {
 	Judge   *JudgeConfig  `json:"judge"`
 	Graph   *GraphConfig  `json:"graph"`
 	Tsdb    *TsdbConfig   `json:"tsdb"`
+
+	Overflow *OverflowConfig `json:"overflow"`
+	Route    *RouteConfig    `json:"route"`
+
+	Prometheus *PrometheusConfig `json:"prometheus"`
+	Graphite   *GraphiteConfig   `json:"graphite"`
+	OpenTsdb   *OpenTsdbConfig   `json:"opentsdb"`
 }
 
 var (
@@ -106,27 +179,56 @@ func ParseConfig(cfg string) {
 	}
 
 	ConfigFile = cfg
+	if err := loadConfig(cfg); err != nil {
+		log.Fatalln(err)
+	}
+
+	log.Println("g.ParseConfig ok, file ", cfg)
+}
+
+// ReloadConfig parses the config file again, the running config is kept if it is bad
+func ReloadConfig() error {
+	if err := loadConfig(ConfigFile); err != nil {
+		log.Println("reload", err)
+		return err
+	}
+	log.Println("g.ReloadConfig ok, file ", ConfigFile)
+	return nil
+}
 
+func loadConfig(cfg string) error {
 	configContent, err := file.ToTrimString(cfg)
 	if err != nil {
-		log.Fatalln("read config file:", cfg, "fail:", err)
+		return fmt.Errorf("read config file: %s fail: %v", cfg, err)
 	}
 
 	var c GlobalConfig
 	err = json.Unmarshal([]byte(configContent), &c)
 	if err != nil {
-		log.Fatalln("parse config file:", cfg, "fail:", err)
+		return fmt.Errorf("parse config file: %s fail: %v", cfg, err)
+	}
+
+	if err := checkClusters(c.Judge.Cluster, c.Judge.Clusters); err != nil {
+		return fmt.Errorf("parse judge clusters in config file: %s fail: %v", cfg, err)
+	}
+	if len(c.Graph.Clusters) > 0 {
+		return fmt.Errorf("parse graph clusters in config file: %s fail: graph.clusters is not supported, api reads graph.cluster only", cfg)
 	}
 
 	// split cluster config
-	c.Judge.ClusterList = formatClusterItems(c.Judge.Cluster)
-	c.Graph.ClusterList = formatClusterItems(c.Graph.Cluster)
+	c.Judge.ClusterList = formatClusterItems(AllNodes(c.Judge.Cluster, c.Judge.Clusters))
+	c.Graph.ClusterList = formatClusterItems(AllNodes(c.Graph.Cluster, c.Graph.Clusters))
+
+	table, err := compileRoutes(&c)
+	if err != nil {
+		return fmt.Errorf("parse route rules in config file: %s fail: %v", cfg, err)
+	}
 
 	configLock.Lock()
 	defer configLock.Unlock()
 	config = &c
-
-	log.Println("g.ParseConfig ok, file ", cfg)
+	routes = table
+	return nil
 }
 
 // CLUSTER NODE
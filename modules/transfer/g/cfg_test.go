@@ -0,0 +1,63 @@
+package g
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "transfer-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestReloadConfigKeepsRunning(t *testing.T) {
+	good := `{"minStep": 30, "judge": {"replicas": 500, "cluster": {"judge-00": "127.0.0.1:6080"}},
+		"graph": {"replicas": 500, "cluster": {"graph-00": "127.0.0.1:6070"}},
+		"route": {"enabled": true, "rules": [{"name": "app", "metric": "app\\..+", "backends": ["graph"]}]}}`
+	cfg := writeConfig(t, good)
+	defer os.Remove(cfg)
+	ParseConfig(cfg)
+	running := Config()
+
+	bad := []string{
+		`{"minStep": `,
+		`{"judge": {"cluster": {"judge-00": "127.0.0.1:6080"}, "clusters": {"tenant-a": {"judge-00": "127.0.0.1:6081"}}},
+			"graph": {"cluster": {"graph-00": "127.0.0.1:6070"}}}`,
+		`{"judge": {"cluster": {"judge-00": "127.0.0.1:6080"}}, "graph": {"cluster": {"graph-00": "127.0.0.1:6070"},
+			"clusters": {"tenant-a": {"graph-a-00": "127.0.0.1:6071"}}}}`,
+		`{"judge": {"cluster": {"judge-00": "127.0.0.1:6080"}}, "graph": {"cluster": {"graph-00": "127.0.0.1:6070"}},
+			"route": {"enabled": true, "rules": [{"name": "app", "metric": "app(", "backends": ["graph"]}]}}`,
+	}
+	for _, content := range bad {
+		if err := ioutil.WriteFile(cfg, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ReloadConfig(); err == nil {
+			t.Errorf("expect an error reloading %s", content)
+		}
+		if Config() != running {
+			t.Errorf("expect the running config kept after reloading %s", content)
+		}
+		if r := Routes(); r == nil || r.Rules[0].Name != "app" {
+			t.Errorf("expect the running routes kept after reloading %s", content)
+		}
+	}
+
+	if err := ioutil.WriteFile(cfg, []byte(good), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if Config() == running {
+		t.Error("expect the config replaced by a good reload")
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package g
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// the cluster of judge.cluster and graph.cluster,
+// the backend graph in a route is short for graph:default
+const DefaultCluster = "default"
+
+// the backends of a route
+const (
+	RouteGraph = "graph"
+	RouteJudge = "judge"
+	RouteTsdb  = "tsdb"
+)
+
+// Route is a compiled route rule, the item matched is sent to the clusters of graph and judge and to tsdb
+type Route struct {
+	Name  string
+	Graph []string
+	Judge []string
+	Tsdb  bool
+
+	metricPrefix string
+	metric       *regexp.Regexp
+	endpoint     *regexp.Regexp
+	tags         map[string]*regexp.Regexp
+}
+
+type RouteTable struct {
+	Rules   []*Route
+	Default *Route
+}
+
+// set with config in ParseConfig and ReloadConfig, nil if route is disabled
+var routes *RouteTable
+
+// Routes returns nil if route is disabled
+func Routes() *RouteTable {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return routes
+}
+
+// Match returns the first rule matched, or the default one
+func (this *RouteTable) Match(endpoint string, metric string, tags map[string]string) *Route {
+	for _, r := range this.Rules {
+		if r.match(endpoint, metric, tags) {
+			return r
+		}
+	}
+	return this.Default
+}
+
+func (r *Route) match(endpoint string, metric string, tags map[string]string) bool {
+	if r.metricPrefix != "" && !strings.HasPrefix(metric, r.metricPrefix) {
+		return false
+	}
+	if r.metric != nil && !r.metric.MatchString(metric) {
+		return false
+	}
+	if r.endpoint != nil && !r.endpoint.MatchString(endpoint) {
+		return false
+	}
+	for k, re := range r.tags {
+		v, exists := tags[k]
+		if !exists || !re.MatchString(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func compileRoutes(c *GlobalConfig) (*RouteTable, error) {
+	if c.Route == nil || !c.Route.Enabled {
+		return nil, nil
+	}
+
+	table := &RouteTable{}
+	for i, rule := range c.Route.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule-%d", i)
+		}
+		if name == DefaultCluster {
+			return nil, fmt.Errorf("rule %d: %s is reserved for the default route", i, name)
+		}
+
+		r, err := compileBackends(c, name, rule.Backends)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %v", name, err)
+		}
+		r.metricPrefix = rule.MetricPrefix
+		if r.metric, err = compileCondition(rule.Metric); err != nil {
+			return nil, fmt.Errorf("rule %s: %v", name, err)
+		}
+		if r.endpoint, err = compileCondition(rule.Endpoint); err != nil {
+			return nil, fmt.Errorf("rule %s: %v", name, err)
+		}
+		r.tags = make(map[string]*regexp.Regexp)
+		for k, v := range rule.Tags {
+			if r.tags[k], err = compileCondition(v); err != nil {
+				return nil, fmt.Errorf("rule %s: %v", name, err)
+			}
+		}
+		table.Rules = append(table.Rules, r)
+	}
+
+	// all the backends without route.default
+	backends := c.Route.Default
+	if backends == nil {
+		backends = []string{RouteGraph, RouteJudge, RouteTsdb}
+	}
+	var err error
+	if table.Default, err = compileBackends(c, DefaultCluster, backends); err != nil {
+		return nil, fmt.Errorf("default route: %v", err)
+	}
+	return table, nil
+}
+
+// backends are graph, judge, tsdb or judge:cluster
+func compileBackends(c *GlobalConfig, name string, backends []string) (*Route, error) {
+	r := &Route{Name: name}
+	seen := make(map[string]bool)
+	for _, b := range backends {
+		if seen[b] {
+			continue
+		}
+		seen[b] = true
+
+		kind, cluster := b, DefaultCluster
+		if i := strings.Index(b, ":"); i >= 0 {
+			kind, cluster = b[:i], b[i+1:]
+		}
+
+		switch kind {
+		case RouteGraph:
+			// api and nodata read the default graph cluster only, the data of another would be lost for them
+			if cluster != DefaultCluster {
+				return nil, fmt.Errorf("graph cluster %s is not supported, graph has the default cluster only", cluster)
+			}
+			r.Graph = append(r.Graph, cluster)
+		case RouteJudge:
+			if _, exists := c.Judge.Clusters[cluster]; !exists && cluster != DefaultCluster {
+				return nil, fmt.Errorf("unknown judge cluster %s", cluster)
+			}
+			r.Judge = append(r.Judge, cluster)
+		case RouteTsdb:
+			if b != RouteTsdb {
+				return nil, fmt.Errorf("tsdb has no cluster")
+			}
+			r.Tsdb = true
+		default:
+			return nil, fmt.Errorf("unknown backend %s", b)
+		}
+	}
+	return r, nil
+}
+
+// the whole value has to match
+func compileCondition(s string) (*regexp.Regexp, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + s + ")$")
+}
+
+// AllNodes merges the nodes of cluster and clusters, node -> addr
+func AllNodes(cluster map[string]string, clusters map[string]map[string]string) map[string]string {
+	ret := make(map[string]string)
+	for node, addr := range cluster {
+		ret[node] = addr
+	}
+	for _, c := range clusters {
+		for node, addr := range c {
+			ret[node] = addr
+		}
+	}
+	return ret
+}
+
+// NodeClusters maps the nodes to their clusters, node -> cluster
+func NodeClusters(cluster map[string]string, clusters map[string]map[string]string) map[string]string {
+	ret := make(map[string]string)
+	for node := range cluster {
+		ret[node] = DefaultCluster
+	}
+	for name, c := range clusters {
+		for node := range c {
+			ret[node] = name
+		}
+	}
+	return ret
+}
+
+// the nodes share the send queues by name, a node belongs to one cluster only
+func checkClusters(cluster map[string]string, clusters map[string]map[string]string) error {
+	seen := make(map[string]string)
+	for node := range cluster {
+		seen[node] = DefaultCluster
+	}
+	for name, c := range clusters {
+		if name == DefaultCluster || name == "" {
+			return fmt.Errorf("bad cluster name %q", name)
+		}
+		for node := range c {
+			if other, exists := seen[node]; exists {
+				return fmt.Errorf("node %s is in both cluster %s and %s", node, other, name)
+			}
+			seen[node] = name
+		}
+	}
+	return nil
+}
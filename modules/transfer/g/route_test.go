@@ -0,0 +1,88 @@
+package g
+
+import (
+	"fmt"
+	"testing"
+)
+
+func routeConfig(rules ...*RouteRule) *GlobalConfig {
+	return &GlobalConfig{
+		Judge: &JudgeConfig{
+			Cluster:  map[string]string{"judge-00": "127.0.0.1:6080"},
+			Clusters: map[string]map[string]string{"tenant-a": {"judge-a-00": "127.0.0.1:6081"}},
+		},
+		Graph: &GraphConfig{Cluster: map[string]string{"graph-00": "127.0.0.1:6070"}},
+		Route: &RouteConfig{Enabled: true, Default: []string{"graph", "judge"}, Rules: rules},
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	table, err := compileRoutes(routeConfig(
+		&RouteRule{Name: "debug", MetricPrefix: "debug.", Backends: []string{"graph"}},
+		&RouteRule{Name: "app", Metric: `app\..+`, Backends: []string{"graph", "judge", "tsdb"}},
+		&RouteRule{Name: "tenant-a", Tags: map[string]string{"tenant": "a"}, Endpoint: "a-.*", Backends: []string{"graph", "judge:tenant-a"}},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		endpoint string
+		metric   string
+		tags     map[string]string
+		expect   string
+	}{
+		{"host", "debug.gc", nil, "debug [default] [] false"},
+		{"host", "app.qps", nil, "app [default] [default] true"},
+		{"host", "app", nil, "default [default] [default] false"},
+		{"a-web", "cpu.idle", map[string]string{"tenant": "a"}, "tenant-a [default] [tenant-a] false"},
+		{"b-web", "cpu.idle", map[string]string{"tenant": "a"}, "default [default] [default] false"},
+		{"a-web", "cpu.idle", nil, "default [default] [default] false"},
+	}
+	for _, c := range cases {
+		r := table.Match(c.endpoint, c.metric, c.tags)
+		if got := fmt.Sprintf("%s %v %v %v", r.Name, r.Graph, r.Judge, r.Tsdb); got != c.expect {
+			t.Errorf("%s %s: expect %s, but %s", c.endpoint, c.metric, c.expect, got)
+		}
+	}
+}
+
+func TestRoutesDefault(t *testing.T) {
+	c := routeConfig()
+	c.Route.Default = nil
+	table, err := compileRoutes(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := table.Default; len(d.Graph) != 1 || len(d.Judge) != 1 || !d.Tsdb {
+		t.Errorf("expect all the backends by default, but %+v", d)
+	}
+
+	c.Route.Enabled = false
+	if table, _ := compileRoutes(c); table != nil {
+		t.Errorf("expect no routes if disabled")
+	}
+}
+
+func TestRoutesError(t *testing.T) {
+	bad := [][]string{
+		{"graph:tenant-a"},
+		{"judge:tenant-b"},
+		{"tsdb:x"},
+		{"opentsdb"},
+	}
+	for _, backends := range bad {
+		if _, err := compileRoutes(routeConfig(&RouteRule{Backends: backends})); err == nil {
+			t.Errorf("expect error for %v", backends)
+		}
+	}
+
+	if _, err := compileRoutes(routeConfig(&RouteRule{Metric: "(", Backends: []string{"graph"}})); err == nil {
+		t.Errorf("expect error for bad regexp")
+	}
+
+	err := checkClusters(map[string]string{"judge-00": ""}, map[string]map[string]string{"tenant-a": {"judge-00": ""}})
+	if err == nil {
+		t.Errorf("expect error for a node in 2 clusters")
+	}
+}
@@ -16,12 +16,36 @@ package http
 
 import (
 	"encoding/json"
+	"github.com/open-falcon/falcon-plus/common/auth"
 	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	"github.com/open-falcon/falcon-plus/modules/transfer/receiver/prom"
 	prpc "github.com/open-falcon/falcon-plus/modules/transfer/receiver/rpc"
+	"io/ioutil"
+	"log"
 	"net/http"
 )
 
+// with rpc.auth enabled, the pushes carry the token of rpc in the headers of auth.TokenHeader and auth.HostHeader
+func authenticate(rw http.ResponseWriter, req *http.Request) (string, bool) {
+	rpc := g.Config().Rpc
+	if rpc == nil || rpc.Auth == nil || !rpc.Auth.Enabled {
+		return auth.AnyHost, true
+	}
+
+	host, ok := rpc.Auth.IdentifyRequest(req)
+	if !ok {
+		http.Error(rw, auth.ErrUnauthorized.Error(), http.StatusUnauthorized)
+	}
+	return host, ok
+}
+
 func api_push_datapoints(rw http.ResponseWriter, req *http.Request) {
+	host, ok := authenticate(rw, req)
+	if !ok {
+		return
+	}
+
 	if req.ContentLength == 0 {
 		http.Error(rw, "blank body", http.StatusBadRequest)
 		return
@@ -34,6 +58,7 @@ func api_push_datapoints(rw http.ResponseWriter, req *http.Request) {
 		http.Error(rw, "decode error", http.StatusBadRequest)
 		return
 	}
+	prpc.CheckEndpoints(host, &metrics)
 
 	reply := &cmodel.TransferResponse{}
 	prpc.RecvMetricValues(metrics, reply, "http")
@@ -41,6 +66,51 @@ func api_push_datapoints(rw http.ResponseWriter, req *http.Request) {
 	RenderDataJson(rw, reply)
 }
 
+// prometheus remote write, a 4xx answer is not retried by prometheus
+func api_prom_write(rw http.ResponseWriter, req *http.Request) {
+	host, ok := authenticate(rw, req)
+	if !ok {
+		return
+	}
+
+	if req.ContentLength > prom.MaxEncodedLen {
+		http.Error(rw, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	req.Body = http.MaxBytesReader(rw, req.Body, prom.MaxEncodedLen)
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		// MaxBytesReader fails after reading exactly the limit
+		if int64(len(body)) >= prom.MaxEncodedLen {
+			http.Error(rw, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	wr, err := prom.Decode(body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metrics, invalid := prom.Convert(wr, g.Config().Prometheus)
+	prpc.CheckEndpoints(host, &metrics)
+	reply := &cmodel.TransferResponse{}
+	prpc.RecvMetricValues(metrics, reply, "prometheus")
+	if invalid > 0 && g.Config().Debug {
+		log.Printf("prometheus remote write from %s: %d invalid samples", req.RemoteAddr, invalid)
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
 func configApiRoutes() {
 	http.HandleFunc("/api/push", api_push_datapoints)
+
+	if cfg := g.Config().Prometheus; cfg != nil && cfg.Enabled {
+		http.HandleFunc("/api/v1/prom/write", api_prom_write)
+	}
 }
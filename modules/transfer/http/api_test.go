@@ -0,0 +1,68 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/open-falcon/falcon-plus/common/auth"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	"github.com/open-falcon/falcon-plus/modules/transfer/receiver/prom"
+)
+
+func parseConfig(t *testing.T, content string) {
+	f, err := ioutil.TempFile("", "transfer-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(content)
+	f.Close()
+	g.ParseConfig(f.Name())
+}
+
+func TestPromWriteTooLarge(t *testing.T) {
+	parseConfig(t, `{"rpc": {"enabled": true}, "judge": {}, "graph": {}}`)
+	body := bytes.Repeat([]byte{0}, prom.MaxEncodedLen+1)
+
+	req := httptest.NewRequest("POST", "/api/v1/prom/write", bytes.NewReader(body))
+	rw := httptest.NewRecorder()
+	api_prom_write(rw, req)
+	if rw.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expect 413, but %d", rw.Code)
+	}
+
+	// a chunked body has no content length
+	req = httptest.NewRequest("POST", "/api/v1/prom/write", io.MultiReader(bytes.NewReader(body)))
+	req.ContentLength = -1
+	rw = httptest.NewRecorder()
+	api_prom_write(rw, req)
+	if rw.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expect 413 for the chunked body, but %d", rw.Code)
+	}
+}
+
+func TestPushAuth(t *testing.T) {
+	parseConfig(t, `{"rpc": {"enabled": true, "auth": {"enabled": true, "token": "shared"}}, "judge": {}, "graph": {}}`)
+
+	for _, handler := range []http.HandlerFunc{api_push_datapoints, api_prom_write} {
+		req := httptest.NewRequest("POST", "/api/push", bytes.NewReader([]byte("[]")))
+		rw := httptest.NewRecorder()
+		handler(rw, req)
+		if rw.Code != http.StatusUnauthorized {
+			t.Errorf("expect 401 without a token, but %d", rw.Code)
+		}
+
+		req = httptest.NewRequest("POST", "/api/push", bytes.NewReader([]byte("[]")))
+		req.Header.Set(auth.TokenHeader, "bad")
+		rw = httptest.NewRecorder()
+		handler(rw, req)
+		if rw.Code != http.StatusUnauthorized {
+			t.Errorf("expect 401 with a bad token, but %d", rw.Code)
+		}
+	}
+}
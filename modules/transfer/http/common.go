@@ -17,6 +17,7 @@ package http
 import (
 	"fmt"
 	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	"github.com/open-falcon/falcon-plus/modules/transfer/sender"
 	"github.com/toolkits/file"
 	"net/http"
 	"strings"
@@ -41,7 +42,11 @@ func configCommonRoutes() {
 
 	http.HandleFunc("/config/reload", func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasPrefix(r.RemoteAddr, "127.0.0.1") {
-			g.ParseConfig(g.ConfigFile)
+			if err := g.ReloadConfig(); err != nil {
+				RenderDataJson(w, err.Error())
+				return
+			}
+			sender.ReloadClusters()
 			RenderDataJson(w, "ok")
 		} else {
 			RenderDataJson(w, "no privilege")
@@ -17,6 +17,7 @@ package proc
 import (
 	nproc "github.com/toolkits/proc"
 	"log"
+	"sync"
 )
 
 // trace
@@ -32,10 +33,13 @@ var (
 // 统计指标的整体数据
 var (
 	// 计数统计,正确计数,错误计数, ...
-	RecvCnt       = nproc.NewSCounterQps("RecvCnt")
-	RpcRecvCnt    = nproc.NewSCounterQps("RpcRecvCnt")
-	HttpRecvCnt   = nproc.NewSCounterQps("HttpRecvCnt")
-	SocketRecvCnt = nproc.NewSCounterQps("SocketRecvCnt")
+	RecvCnt         = nproc.NewSCounterQps("RecvCnt")
+	RpcRecvCnt      = nproc.NewSCounterQps("RpcRecvCnt")
+	HttpRecvCnt     = nproc.NewSCounterQps("HttpRecvCnt")
+	SocketRecvCnt   = nproc.NewSCounterQps("SocketRecvCnt")
+	PromRecvCnt     = nproc.NewSCounterQps("PromRecvCnt")
+	GraphiteRecvCnt = nproc.NewSCounterQps("GraphiteRecvCnt")
+	OpenTsdbRecvCnt = nproc.NewSCounterQps("OpenTsdbRecvCnt")
 
 	SendToJudgeCnt = nproc.NewSCounterQps("SendToJudgeCnt")
 	SendToTsdbCnt  = nproc.NewSCounterQps("SendToTsdbCnt")
@@ -54,6 +58,15 @@ var (
 	TsdbQueuesCnt  = nproc.NewSCounterBase("TsdbSendCacheCnt")
 	GraphQueuesCnt = nproc.NewSCounterBase("GraphSendCacheCnt")
 
+	// 溢出到磁盘的数据, other中为每个节点的depth、bytes、age(秒)和dropped
+	OverflowCnt      = nproc.NewSCounterQps("OverflowCnt")
+	JudgeOverflowCnt = nproc.NewSCounterBase("JudgeOverflowCnt")
+	TsdbOverflowCnt  = nproc.NewSCounterBase("TsdbOverflowCnt")
+	GraphOverflowCnt = nproc.NewSCounterBase("GraphOverflowCnt")
+
+	// 命中路由规则的数据, other中为每条规则的命中次数, 未命中任何规则的计入default
+	RouteHitCnt = nproc.NewSCounterQps("RouteHitCnt")
+
 	// http请求次数
 	HistoryRequestCnt = nproc.NewSCounterQps("HistoryRequestCnt")
 	InfoRequestCnt    = nproc.NewSCounterQps("InfoRequestCnt")
@@ -67,6 +80,21 @@ var (
 	LastRawRequestItemCnt     = nproc.NewSCounterQps("LastRawRequestItemCnt")
 )
 
+var (
+	routeHits     = make(map[string]int64)
+	routeHitsLock = new(sync.Mutex)
+)
+
+func IncrRouteHit(rule string, cnt int64) {
+	routeHitsLock.Lock()
+	routeHits[rule] += cnt
+	hits := routeHits[rule]
+	routeHitsLock.Unlock()
+
+	RouteHitCnt.IncrBy(cnt)
+	RouteHitCnt.PutOther(rule, hits)
+}
+
 func Start() {
 	log.Println("proc.Start, ok")
 }
@@ -79,6 +107,9 @@ func GetAll() []interface{} {
 	ret = append(ret, RpcRecvCnt.Get())
 	ret = append(ret, HttpRecvCnt.Get())
 	ret = append(ret, SocketRecvCnt.Get())
+	ret = append(ret, PromRecvCnt.Get())
+	ret = append(ret, GraphiteRecvCnt.Get())
+	ret = append(ret, OpenTsdbRecvCnt.Get())
 
 	// send cnt
 	ret = append(ret, SendToJudgeCnt.Get())
@@ -100,6 +131,15 @@ func GetAll() []interface{} {
 	ret = append(ret, TsdbQueuesCnt.Get())
 	ret = append(ret, GraphQueuesCnt.Get())
 
+	// overflow
+	ret = append(ret, OverflowCnt.Get())
+	ret = append(ret, JudgeOverflowCnt.Get())
+	ret = append(ret, TsdbOverflowCnt.Get())
+	ret = append(ret, GraphOverflowCnt.Get())
+
+	// route
+	ret = append(ret, RouteHitCnt.Get())
+
 	// http request
 	ret = append(ret, HistoryRequestCnt.Get())
 	ret = append(ret, InfoRequestCnt.Get())
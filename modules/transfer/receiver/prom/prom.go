@@ -0,0 +1,184 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prom
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+)
+
+const (
+	DefaultEndpointLabel = "instance"
+	DefaultStep          = 60
+)
+
+var (
+	// metric family => MetricMetadata.Type,
+	// prometheus sends the metadata apart from the samples
+	familyTypes     = make(map[string]int32)
+	familyTypesLock = new(sync.RWMutex)
+)
+
+// Decode reads the snappy compressed protobuf body of a remote write request
+func Decode(body []byte) (*WriteRequest, error) {
+	data, err := snappyDecode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var req WriteRequest
+	if err := proto.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("bad WriteRequest: %v", err)
+	}
+	return &req, nil
+}
+
+// Convert maps __name__ to the metric, the endpoint label to the endpoint
+// and the other labels to tags, the samples without an endpoint or a finite value are counted as invalid
+func Convert(req *WriteRequest, cfg *g.PrometheusConfig) ([]*cmodel.MetricValue, int) {
+	endpointLabel := cfg.EndpointLabel
+	if endpointLabel == "" {
+		endpointLabel = DefaultEndpointLabel
+	}
+	step := cfg.Step
+	if step <= 0 {
+		step = DefaultStep
+	}
+
+	recordMetadata(req.Metadata)
+
+	ret := []*cmodel.MetricValue{}
+	invalid := 0
+	for _, ts := range req.Timeseries {
+		if ts == nil {
+			continue
+		}
+
+		var name, endpoint string
+		tags := make([]string, 0, len(ts.Labels))
+		for _, l := range ts.Labels {
+			switch {
+			case l == nil || l.Value == "":
+			case l.Name == "__name__":
+				name = l.Value
+			case l.Name == endpointLabel:
+				endpoint = l.Value
+			case strings.HasPrefix(l.Name, "__"):
+			default:
+				tags = append(tags, cutils.SanitizeTag(l.Name)+"="+cutils.SanitizeTag(l.Value))
+			}
+		}
+
+		if cfg.TrimPort {
+			if host, _, err := net.SplitHostPort(endpoint); err == nil {
+				endpoint = host
+			}
+		}
+
+		if name == "" || endpoint == "" {
+			invalid += len(ts.Samples)
+			continue
+		}
+
+		counterType := CounterType(name)
+		tagstring := strings.Join(tags, ",")
+		for _, s := range ts.Samples {
+			// NaN marks stale series
+			if s == nil || math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				invalid++
+				continue
+			}
+			ret = append(ret, &cmodel.MetricValue{
+				Endpoint:  endpoint,
+				Metric:    name,
+				Value:     s.Value,
+				Step:      step,
+				Type:      counterType,
+				Tags:      tagstring,
+				Timestamp: s.Timestamp / 1000,
+			})
+		}
+	}
+	return ret, invalid
+}
+
+func recordMetadata(metadata []*MetricMetadata) {
+	if len(metadata) == 0 {
+		return
+	}
+
+	familyTypesLock.Lock()
+	defer familyTypesLock.Unlock()
+	for _, m := range metadata {
+		if m != nil && m.MetricFamilyName != "" {
+			familyTypes[m.MetricFamilyName] = m.Type
+		}
+	}
+}
+
+func familyType(family string) (int32, bool) {
+	familyTypesLock.RLock()
+	defer familyTypesLock.RUnlock()
+	t, ok := familyTypes[family]
+	return t, ok
+}
+
+// the series of a counter, histogram or summary that only go up
+var counterSuffixes = []string{"_total", "_bucket", "_count", "_sum"}
+
+// CounterType is COUNTER for counters and the buckets, counts and sums of histograms and summaries,
+// known by the metadata or else by the naming convention, GAUGE otherwise
+func CounterType(name string) string {
+	suffix := ""
+	for _, s := range counterSuffixes {
+		if strings.HasSuffix(name, s) {
+			suffix = s
+			break
+		}
+	}
+
+	t, ok := familyType(name)
+	if !ok && suffix != "" {
+		t, ok = familyType(strings.TrimSuffix(name, suffix))
+	}
+
+	if ok {
+		switch t {
+		case MetricTypeCounter:
+			return g.COUNTER
+		case MetricTypeHistogram, MetricTypeSummary:
+			if suffix != "" && suffix != "_total" {
+				return g.COUNTER
+			}
+			return g.GAUGE
+		case MetricTypeUnknown:
+		default:
+			return g.GAUGE
+		}
+	}
+
+	if suffix != "" {
+		return g.COUNTER
+	}
+	return g.GAUGE
+}
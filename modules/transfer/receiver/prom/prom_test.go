@@ -0,0 +1,178 @@
+package prom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+)
+
+// snappy block of literals only
+func snappyLiteral(data []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(len(data)))
+	ret := buf[:n]
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > 60 {
+			chunk = chunk[:60]
+		}
+		ret = append(ret, byte(len(chunk)-1)<<2)
+		ret = append(ret, chunk...)
+		data = data[len(chunk):]
+	}
+	return ret
+}
+
+func TestSnappyDecode(t *testing.T) {
+	// "abcd" and a copy of 8 bytes at offset 4
+	src := []byte{12, 3 << 2, 'a', 'b', 'c', 'd', 0x01 | (8-4)<<2, 4}
+	got, err := snappyDecode(src)
+	if err != nil || string(got) != "abcdabcdabcd" {
+		t.Errorf("expect abcdabcdabcd, but %q %v", got, err)
+	}
+
+	// the same copy with a 2 bytes and a 4 bytes offset
+	for _, src := range [][]byte{
+		{12, 3 << 2, 'a', 'b', 'c', 'd', 0x02 | (8-1)<<2, 4, 0},
+		{12, 3 << 2, 'a', 'b', 'c', 'd', 0x03 | (8-1)<<2, 4, 0, 0, 0},
+	} {
+		got, err := snappyDecode(src)
+		if err != nil || string(got) != "abcdabcdabcd" {
+			t.Errorf("expect abcdabcdabcd for %v, but %q %v", src, got, err)
+		}
+	}
+
+	// a literal of 300 bytes, its length takes 2 bytes
+	literal := bytes.Repeat([]byte("0123456789"), 30)
+	src = append([]byte{0xac, 0x02, 61 << 2, 0x2b, 0x01}, literal...)
+	got, err = snappyDecode(src)
+	if err != nil || !bytes.Equal(got, literal) {
+		t.Errorf("expect the literal of 300 bytes, but %d bytes %v", len(got), err)
+	}
+
+	bad := [][]byte{
+		{},
+		{5, 3 << 2, 'a', 'b', 'c', 'd'},
+		{8, 0x01 | 4<<2, 4},
+		{12, 3 << 2, 'a', 'b', 'c', 'd', 0x02 | (8-1)<<2, 5, 0},
+		{12, 3 << 2, 'a', 'b', 'c', 'd', 0x03 | (8-1)<<2, 4, 0, 0},
+		// tells 64MB, but carries 4 bytes
+		{0x80, 0x80, 0x80, 0x20, 3 << 2, 'a', 'b', 'c', 'd'},
+	}
+	for _, src := range bad {
+		if _, err := snappyDecode(src); err == nil {
+			t.Errorf("expect error for %v", src)
+		}
+	}
+}
+
+// snappyPayload is the input of testdata/payload.snappy, over 64KB with
+// incompressible runs, near repeats and far repeats
+func snappyPayload() []byte {
+	var buf bytes.Buffer
+	x := uint32(1)
+	for buf.Len() < 100<<10 {
+		for i := 0; i < 300; i++ {
+			x = x*1664525 + 1013904223
+			buf.WriteByte(byte(x >> 24))
+		}
+		fmt.Fprintf(&buf, "http_requests_total{path=\"/%d\"} http_requests_total{path=\"/%d\"} ", buf.Len()%7, buf.Len()%7)
+		if buf.Len() > 8000 {
+			far := append([]byte(nil), buf.Bytes()[buf.Len()-6000:buf.Len()-5900]...)
+			buf.Write(far)
+		}
+	}
+	return buf.Bytes()
+}
+
+// testdata/payload.snappy is snappyPayload encoded by github.com/golang/snappy v0.0.4,
+// it has literals with a 1 byte and a 2 bytes length, copies with a 1 byte and a 2 bytes offset
+func TestSnappyDecodeGolden(t *testing.T) {
+	src, err := ioutil.ReadFile("testdata/payload.snappy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := snappyDecode(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := snappyPayload(); !bytes.Equal(got, want) {
+		t.Errorf("expect %d bytes decoded as the payload, but %d bytes differ", len(want), len(got))
+	}
+}
+
+func TestDecodeAndConvert(t *testing.T) {
+	defer func() { familyTypes = make(map[string]int32) }()
+
+	wr := &WriteRequest{
+		Timeseries: []*TimeSeries{
+			{
+				Labels: []*Label{
+					{Name: "__name__", Value: "http_requests_total"},
+					{Name: "instance", Value: "web1:9100"},
+					{Name: "job", Value: "node"},
+					{Name: "path", Value: "/a,b"},
+				},
+				Samples: []*Sample{{Value: 10, Timestamp: 1500000000000}, {Value: math.NaN(), Timestamp: 1500000060000}},
+			},
+			{
+				Labels:  []*Label{{Name: "__name__", Value: "rpc_latency_sum"}, {Name: "instance", Value: "web1:9100"}},
+				Samples: []*Sample{{Value: 1.5, Timestamp: 1500000000000}},
+			},
+			{
+				Labels:  []*Label{{Name: "__name__", Value: "up"}},
+				Samples: []*Sample{{Value: 1, Timestamp: 1500000000000}},
+			},
+		},
+		Metadata: []*MetricMetadata{{Type: MetricTypeGauge, MetricFamilyName: "rpc_latency_sum"}},
+	}
+	data, err := proto.Marshal(wr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := Decode(snappyLiteral(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, invalid := Convert(req, &g.PrometheusConfig{TrimPort: true, Step: 30})
+	got := []string{}
+	for _, mv := range metrics {
+		got = append(got, fmt.Sprintf("%s/%s/%s/%s/%v/%d/%d", mv.Endpoint, mv.Metric, mv.Tags, mv.Type, mv.Value, mv.Step, mv.Timestamp))
+	}
+	expect := "[web1/http_requests_total/job=node,path=/a_b/COUNTER/10/30/1500000000 web1/rpc_latency_sum//GAUGE/1.5/30/1500000000]"
+	if fmt.Sprint(got) != expect {
+		t.Errorf("expect %s, but %v", expect, got)
+	}
+	if invalid != 2 {
+		t.Errorf("expect 2 invalid, but %d", invalid)
+	}
+}
+
+func TestCounterType(t *testing.T) {
+	defer func() { familyTypes = make(map[string]int32) }()
+	recordMetadata([]*MetricMetadata{
+		{Type: MetricTypeHistogram, MetricFamilyName: "rpc_duration_seconds"},
+		{Type: MetricTypeCounter, MetricFamilyName: "errors"},
+	})
+
+	cases := map[string]string{
+		"node_cpu_seconds_total":      g.COUNTER,
+		"rpc_duration_seconds_bucket": g.COUNTER,
+		"rpc_duration_seconds":        g.GAUGE,
+		"errors":                      g.COUNTER,
+		"node_load1":                  g.GAUGE,
+	}
+	for name, expect := range cases {
+		if got := CounterType(name); got != expect {
+			t.Errorf("%s: expect %s, but %s", name, expect, got)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prom
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// the messages of prometheus/prompb/remote.proto and types.proto used by remote write,
+// exemplars and native histograms are skipped as unknown fields
+
+type WriteRequest struct {
+	Timeseries []*TimeSeries     `protobuf:"bytes,1,rep,name=timeseries" json:"timeseries,omitempty"`
+	Metadata   []*MetricMetadata `protobuf:"bytes,3,rep,name=metadata" json:"metadata,omitempty"`
+}
+
+func (m *WriteRequest) Reset()         { *m = WriteRequest{} }
+func (m *WriteRequest) String() string { return proto.CompactTextString(m) }
+func (*WriteRequest) ProtoMessage()    {}
+
+type TimeSeries struct {
+	Labels  []*Label  `protobuf:"bytes,1,rep,name=labels" json:"labels,omitempty"`
+	Samples []*Sample `protobuf:"bytes,2,rep,name=samples" json:"samples,omitempty"`
+}
+
+func (m *TimeSeries) Reset()         { *m = TimeSeries{} }
+func (m *TimeSeries) String() string { return proto.CompactTextString(m) }
+func (*TimeSeries) ProtoMessage()    {}
+
+type Label struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (m *Label) Reset()         { *m = Label{} }
+func (m *Label) String() string { return proto.CompactTextString(m) }
+func (*Label) ProtoMessage()    {}
+
+type Sample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value,proto3" json:"value,omitempty"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // ms
+}
+
+func (m *Sample) Reset()         { *m = Sample{} }
+func (m *Sample) String() string { return proto.CompactTextString(m) }
+func (*Sample) ProtoMessage()    {}
+
+// MetricMetadata.Type
+const (
+	MetricTypeUnknown        = 0
+	MetricTypeCounter        = 1
+	MetricTypeGauge          = 2
+	MetricTypeHistogram      = 3
+	MetricTypeGaugeHistogram = 4
+	MetricTypeSummary        = 5
+	MetricTypeInfo           = 6
+	MetricTypeStateset       = 7
+)
+
+type MetricMetadata struct {
+	Type             int32  `protobuf:"varint,1,opt,name=type,proto3" json:"type,omitempty"`
+	MetricFamilyName string `protobuf:"bytes,2,opt,name=metric_family_name,json=metricFamilyName,proto3" json:"metric_family_name,omitempty"`
+	Help             string `protobuf:"bytes,4,opt,name=help,proto3" json:"help,omitempty"`
+	Unit             string `protobuf:"bytes,5,opt,name=unit,proto3" json:"unit,omitempty"`
+}
+
+func (m *MetricMetadata) Reset()         { *m = MetricMetadata{} }
+func (m *MetricMetadata) String() string { return proto.CompactTextString(m) }
+func (*MetricMetadata) ProtoMessage()    {}
@@ -0,0 +1,104 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prom
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errCorrupt = errors.New("snappy: corrupt input")
+
+// max decoded size of a remote write request
+const maxDecodedLen = 64 << 20
+
+// MaxEncodedLen is the max size of a snappy encoded remote write request
+const MaxEncodedLen = 16 << 20
+
+// snappyDecode decodes the snappy block format remote write uses,
+// see https://github.com/google/snappy/blob/master/format_description.txt
+func snappyDecode(src []byte) ([]byte, error) {
+	n, k := binary.Uvarint(src)
+	if k <= 0 || n > maxDecodedLen {
+		return nil, errCorrupt
+	}
+	src = src[k:]
+	// n is told by the sender, grow dst with what is really decoded
+	var dst []byte
+
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+
+		switch tag & 0x03 {
+		case 0x00: // literal
+			length = int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				nb := length - 59
+				if len(src) < nb {
+					return nil, errCorrupt
+				}
+				length = 0
+				for i := nb - 1; i >= 0; i-- {
+					length = length<<8 | int(src[i])
+				}
+				src = src[nb:]
+			}
+			length++
+			if length <= 0 || length > len(src) || len(dst)+length > int(n) {
+				return nil, errCorrupt
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case 0x01: // copy with a 1 byte offset
+			if len(src) < 2 {
+				return nil, errCorrupt
+			}
+			length = 4 + int(tag>>2&0x07)
+			offset = int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+		case 0x02: // copy with a 2 bytes offset
+			if len(src) < 3 {
+				return nil, errCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 0x03: // copy with a 4 bytes offset
+			if len(src) < 5 {
+				return nil, errCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+
+		if offset <= 0 || offset > len(dst) || len(dst)+length > int(n) {
+			return nil, errCorrupt
+		}
+		// the copy may overlap what it appends
+		start := len(dst) - offset
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+
+	if len(dst) != int(n) {
+		return nil, errCorrupt
+	}
+	return dst, nil
+}
@@ -22,4 +22,6 @@ import (
 func Start() {
 	go rpc.StartRpc()
 	go socket.StartSocket()
+	go socket.StartGraphite()
+	go socket.StartOpenTsdb()
 }
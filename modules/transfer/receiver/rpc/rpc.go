@@ -15,6 +15,10 @@
 package rpc
 
 import (
+	"crypto/tls"
+	"github.com/open-falcon/falcon-plus/common/auth"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/utils"
 	"github.com/open-falcon/falcon-plus/modules/transfer/g"
 	"log"
 	"net"
@@ -22,11 +26,30 @@ import (
 	"net/rpc/jsonrpc"
 )
 
+var server = rpc.NewServer()
+
 func StartRpc() {
 	if !g.Config().Rpc.Enabled {
 		return
 	}
 
+	server.Register(new(Transfer))
+
+	if tlsCfg := g.Config().Rpc.Tls; tlsCfg != nil && tlsCfg.Enabled {
+		conf, err := utils.ServerTLSConfig(tlsCfg)
+		if err != nil {
+			log.Fatalf("load tls config fail: %s", err)
+		}
+
+		listener, err := tls.Listen("tcp", tlsCfg.Listen, conf)
+		if err != nil {
+			log.Fatalf("listen %s fail: %s", tlsCfg.Listen, err)
+		} else {
+			log.Println("rpc tls listening", tlsCfg.Listen)
+		}
+		go serve(listener)
+	}
+
 	addr := g.Config().Rpc.Listen
 	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
 	if err != nil {
@@ -40,15 +63,41 @@ func StartRpc() {
 		log.Println("rpc listening", addr)
 	}
 
-	server := rpc.NewServer()
-	server.Register(new(Transfer))
+	serve(listener)
+}
 
+func serve(listener net.Listener) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
 			log.Println("listener.Accept occur error:", err)
 			continue
 		}
-		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+		go serveConn(conn)
+	}
+}
+
+func serveConn(conn net.Conn) {
+	codec := jsonrpc.NewServerCodec(conn)
+	if cfg := g.Config().Rpc.Auth; cfg != nil && cfg.Enabled {
+		codec = auth.NewServerCodec(codec, conn, cfg, "Transfer.Auth", map[string]auth.Check{
+			"Transfer.Update": CheckEndpoints,
+		})
+	}
+	server.ServeCodec(codec)
+}
+
+// CheckEndpoints lets a host push its own metrics only, the others are counted as invalid
+func CheckEndpoints(host string, args interface{}) error {
+	if host == auth.AnyHost {
+		return nil
+	}
+
+	items := *args.(*[]*cmodel.MetricValue)
+	for i, v := range items {
+		if v != nil && v.Endpoint != host {
+			items[i] = nil
+		}
 	}
+	return nil
 }
@@ -47,6 +47,11 @@ func (this *Transfer) Ping(req cmodel.NullRpcRequest, resp *cmodel.SimpleRpcResp
 	return nil
 }
 
+// the credential is checked by the codec when rpc.auth is enabled
+func (this *Transfer) Auth(req cmodel.AuthRequest, resp *cmodel.SimpleRpcResponse) error {
+	return nil
+}
+
 func (t *Transfer) Update(args []*cmodel.MetricValue, reply *cmodel.TransferResponse) error {
 	return RecvMetricValues(args, reply, "rpc")
 }
@@ -108,6 +113,7 @@ func RecvMetricValues(args []*cmodel.MetricValue, reply *cmodel.TransferResponse
 			Step:        v.Step,
 			CounterType: v.Type,
 			Tags:        cutils.DictedTagstring(v.Tags), //TODO tags键值对的个数,要做一下限制
+			Heartbeat:   v.Heartbeat,
 		}
 
 		valid := true
@@ -144,20 +150,30 @@ func RecvMetricValues(args []*cmodel.MetricValue, reply *cmodel.TransferResponse
 		proc.RpcRecvCnt.IncrBy(cnt)
 	} else if from == "http" {
 		proc.HttpRecvCnt.IncrBy(cnt)
+	} else if from == "prometheus" {
+		proc.PromRecvCnt.IncrBy(cnt)
+	} else if from == "graphite" {
+		proc.GraphiteRecvCnt.IncrBy(cnt)
+	} else if from == "opentsdb" {
+		proc.OpenTsdbRecvCnt.IncrBy(cnt)
 	}
 
 	cfg := g.Config()
 
-	if cfg.Graph.Enabled {
-		sender.Push2GraphSendQueue(items)
-	}
+	if routes := g.Routes(); routes != nil {
+		sender.PushByRoutes(routes, items)
+	} else {
+		if cfg.Graph.Enabled {
+			sender.Push2GraphSendQueue(items)
+		}
 
-	if cfg.Judge.Enabled {
-		sender.Push2JudgeSendQueue(items)
-	}
+		if cfg.Judge.Enabled {
+			sender.Push2JudgeSendQueue(items)
+		}
 
-	if cfg.Tsdb.Enabled {
-		sender.Push2TsdbSendQueue(items)
+		if cfg.Tsdb.Enabled {
+			sender.Push2TsdbSendQueue(items)
+		}
 	}
 
 	reply.Message = "ok"
@@ -0,0 +1,248 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socket
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+)
+
+// the parts of a graphite template, others are tag names
+const (
+	templateEndpoint = "endpoint" // the segments joined with . make the endpoint
+	templateMetric   = "metric"   // the segments joined with . make the metric
+	templateRest     = "metric*"  // the rest segments are appended to the metric
+	templateSkip     = "_"        // the segment is dropped, so is an empty part
+)
+
+// graphiteTemplate maps the segments of a path matched by the filter,
+// e.g. "servers.* .endpoint.metric*" or "collectd.* .endpoint.plugin.metric* source=collectd"
+type graphiteTemplate struct {
+	filter []string
+	parts  []string
+	tags   map[string]string
+}
+
+func parseGraphiteTemplate(s string) (*graphiteTemplate, error) {
+	fields := strings.Fields(s)
+	t := &graphiteTemplate{tags: map[string]string{}}
+
+	switch len(fields) {
+	case 1:
+	case 2:
+		if strings.Contains(fields[1], "=") {
+			t.tags = cutils.DictedTagstring(fields[1])
+		} else {
+			t.filter = strings.Split(fields[0], ".")
+			fields = fields[1:]
+		}
+	case 3:
+		t.filter = strings.Split(fields[0], ".")
+		t.tags = cutils.DictedTagstring(fields[2])
+		fields = fields[1:]
+	default:
+		return nil, fmt.Errorf("bad template %q", s)
+	}
+
+	t.parts = strings.Split(fields[0], ".")
+	hasMetric := false
+	for i, part := range t.parts {
+		if part == templateRest && i != len(t.parts)-1 {
+			return nil, fmt.Errorf("%s has to be the last part of %q", templateRest, s)
+		}
+		if part == templateMetric || part == templateRest {
+			hasMetric = true
+		}
+	}
+	if !hasMetric {
+		return nil, fmt.Errorf("no metric in template %q", s)
+	}
+
+	for _, f := range t.filter {
+		if _, err := path.Match(f, ""); err != nil {
+			return nil, fmt.Errorf("bad filter of template %q", s)
+		}
+	}
+	return t, nil
+}
+
+// every segment of the filter matches the segment of the path at the same position
+func (t *graphiteTemplate) match(segs []string) bool {
+	if len(t.filter) > len(segs) {
+		return false
+	}
+	for i, f := range t.filter {
+		if ok, _ := path.Match(f, segs[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *graphiteTemplate) apply(segs []string, tags map[string]string) (string, string) {
+	var endpoint, metric []string
+	seen := map[string]bool{}
+	for k, v := range t.tags {
+		tags[cutils.SanitizeTag(k)] = cutils.SanitizeTag(v)
+	}
+
+	for i, part := range t.parts {
+		if i >= len(segs) {
+			break
+		}
+		switch part {
+		case templateEndpoint:
+			endpoint = append(endpoint, segs[i])
+		case templateMetric:
+			metric = append(metric, segs[i])
+		case templateRest:
+			metric = append(metric, segs[i:]...)
+		case templateSkip, "":
+		default:
+			// the segments of a repeated tag name are joined with .
+			part = cutils.SanitizeTag(part)
+			if seen[part] {
+				tags[part] += "." + cutils.SanitizeTag(segs[i])
+			} else {
+				tags[part] = cutils.SanitizeTag(segs[i])
+				seen[part] = true
+			}
+		}
+	}
+	return strings.Join(endpoint, "."), strings.Join(metric, ".")
+}
+
+type graphiteParser struct {
+	cfg       *g.GraphiteConfig
+	templates []*graphiteTemplate
+}
+
+func newGraphiteParser(cfg *g.GraphiteConfig) (*graphiteParser, error) {
+	p := &graphiteParser{cfg: cfg}
+	for _, s := range cfg.Templates {
+		t, err := parseGraphiteTemplate(s)
+		if err != nil {
+			return nil, err
+		}
+		p.templates = append(p.templates, t)
+	}
+	return p, nil
+}
+
+// Parse reads `path[;tag=value...] value [timestamp]`, the first template matching the path is applied,
+// the whole path is the metric without one. The endpoint comes from the template, the endpoint tag,
+// graphite.endpoint or the peer in order
+func (p *graphiteParser) Parse(line string, peer string) (*cmodel.MetricValue, string, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, "", fmt.Errorf("bad fields")
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, "", fmt.Errorf("bad value")
+	}
+
+	ts := time.Now().Unix()
+	if len(fields) == 3 {
+		f, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("bad timestamp")
+		}
+		// -1 means now for graphite
+		if f > 0 {
+			ts = int64(f)
+		}
+	}
+
+	tags := map[string]string{}
+	parts := strings.Split(fields[0], ";")
+	for _, tag := range parts[1:] {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, "", fmt.Errorf("bad tag %s", tag)
+		}
+		tags[cutils.SanitizeTag(kv[0])] = cutils.SanitizeTag(kv[1])
+	}
+
+	name := parts[0]
+	endpoint, metric := "", name
+	segs := strings.Split(name, ".")
+	for _, t := range p.templates {
+		if t.match(segs) {
+			endpoint, metric = t.apply(segs, tags)
+			break
+		}
+	}
+
+	if metric == "" {
+		return nil, "", fmt.Errorf("no metric")
+	}
+	if endpoint == "" {
+		endpoint = tags["endpoint"]
+	}
+	delete(tags, "endpoint")
+	if endpoint == "" {
+		endpoint = p.cfg.Endpoint
+	}
+	if endpoint == "" {
+		endpoint = peer
+	}
+
+	return &cmodel.MetricValue{
+		Endpoint:  endpoint,
+		Metric:    metric,
+		Value:     value,
+		Step:      lineStep(p.cfg.Step),
+		Type:      lineType(p.cfg.Type),
+		Tags:      cutils.SortedTags(tags),
+		Timestamp: ts,
+	}, "", nil
+}
+
+func StartGraphite() {
+	cfg := g.Config().Graphite
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+
+	parser, err := newGraphiteParser(cfg)
+	if err != nil {
+		log.Fatalln("parse graphite templates fail:", err)
+	}
+	listenLines(cfg.Listen, cfg.Timeout, "graphite", parser.Parse)
+}
+
+func lineStep(step int64) int64 {
+	if step <= 0 {
+		return g.DEFAULT_STEP
+	}
+	return step
+}
+
+func lineType(t string) string {
+	if t == "" {
+		return g.GAUGE
+	}
+	return t
+}
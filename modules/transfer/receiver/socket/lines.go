@@ -0,0 +1,201 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socket
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	"github.com/open-falcon/falcon-plus/modules/transfer/receiver/rpc"
+)
+
+const (
+	lineBatchSize     = 1000
+	lineFlushInterval = time.Second
+	maxLineLen        = 64 * 1024
+	maxPacketLen      = 64 * 1024
+)
+
+// parses one line sent by peer, nil for the lines to skip.
+// the answer, if any, is written back on tcp
+type lineParser func(line string, peer string) (mv *cmodel.MetricValue, answer string, err error)
+
+// lineBatch collects the metrics of all the connections of a listener,
+// they are passed to rpc.RecvMetricValues by batch or every second
+type lineBatch struct {
+	sync.Mutex
+	from  string
+	items []*cmodel.MetricValue
+}
+
+func newLineBatch(from string) *lineBatch {
+	b := &lineBatch{from: from}
+	go func() {
+		for range time.Tick(lineFlushInterval) {
+			b.Lock()
+			items := b.take()
+			b.Unlock()
+			b.flush(items)
+		}
+	}()
+	return b
+}
+
+func (b *lineBatch) Add(mv *cmodel.MetricValue) {
+	var items []*cmodel.MetricValue
+	b.Lock()
+	b.items = append(b.items, mv)
+	if len(b.items) >= lineBatchSize {
+		items = b.take()
+	}
+	b.Unlock()
+	b.flush(items)
+}
+
+// take swaps out the items collected, called with the lock held
+func (b *lineBatch) take() []*cmodel.MetricValue {
+	items := b.items
+	b.items = nil
+	return items
+}
+
+// flush is called without the lock, a slow enqueue does not block the other readers
+func (b *lineBatch) flush(items []*cmodel.MetricValue) {
+	if len(items) == 0 {
+		return
+	}
+	reply := &cmodel.TransferResponse{}
+	rpc.RecvMetricValues(items, reply, b.from)
+}
+
+// listenLines serves the same line protocol on tcp and udp of addr
+func listenLines(addr string, timeout int, from string, parse lineParser) {
+	warnUnauthenticated(from)
+	batch := newLineBatch(from)
+
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		log.Fatalf("net.ResolveUDPAddr fail: %s", err)
+	}
+	udpConn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		log.Fatalf("listen udp %s fail: %s", addr, err)
+	}
+	go serveUdpLines(udpConn, from, parse, batch)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("listen %s fail: %s", addr, err)
+	} else {
+		log.Println(from, "listening", addr)
+	}
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Println("listener.Accept occur error:", err)
+			continue
+		}
+
+		go serveTcpLines(conn, time.Duration(timeout)*time.Second, from, parse, batch)
+	}
+}
+
+func serveTcpLines(conn net.Conn, timeout time.Duration, from string, parse lineParser, batch *lineBatch) {
+	defer conn.Close()
+
+	peer := peerHost(conn.RemoteAddr())
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxLineLen)
+
+	for {
+		if timeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line == "quit" {
+			break
+		}
+
+		mv, answer, err := parse(line, peer)
+		if err != nil {
+			debugLine(from, line, err)
+			continue
+		}
+		if answer != "" {
+			conn.Write([]byte(answer + "\n"))
+		}
+		if mv != nil {
+			batch.Add(mv)
+		}
+	}
+}
+
+func serveUdpLines(conn *net.UDPConn, from string, parse lineParser, batch *lineBatch) {
+	buf := make([]byte, maxPacketLen)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			log.Println("read udp occur error:", err)
+			continue
+		}
+
+		peer := peerHost(addr)
+		for _, line := range bytes.Split(buf[:n], []byte("\n")) {
+			s := strings.TrimSpace(string(line))
+			if s == "" {
+				continue
+			}
+
+			mv, _, err := parse(s, peer)
+			if err != nil {
+				debugLine(from, s, err)
+				continue
+			}
+			if mv != nil {
+				batch.Add(mv)
+			}
+		}
+	}
+}
+
+func debugLine(from string, line string, err error) {
+	if g.Config().Debug {
+		log.Printf("%s: bad line %q: %v", from, line, err)
+	}
+}
+
+func peerHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
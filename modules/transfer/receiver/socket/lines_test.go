@@ -0,0 +1,91 @@
+package socket
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+)
+
+func TestGraphiteParse(t *testing.T) {
+	p, err := newGraphiteParser(&g.GraphiteConfig{
+		Step: 10,
+		Templates: []string{
+			"servers.* .endpoint.metric*",
+			"collectd.*.*.* .endpoint.plugin.instance.metric* source=collectd",
+			"app.* .app.app.metric env=prod",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"servers.web1.cpu.load 1.5 1500000000":            "web1/cpu.load//1.5/10/GAUGE/1500000000",
+		"collectd.web1.disk.sda.octets.read 7 1500000000": "web1/octets.read/instance=sda,plugin=disk,source=collectd/7/10/GAUGE/1500000000",
+		"app.shop.cart.size 3 1500000000":                 "10.0.0.1/size/app=shop.cart,env=prod/3/10/GAUGE/1500000000",
+		"jvm.heap;endpoint=web2;pool=old 9 1500000000":    "web2/jvm.heap/pool=old/9/10/GAUGE/1500000000",
+		"jvm.heap;pool=old,young;k=a=b 9 1500000000":      "10.0.0.1/jvm.heap/k=a_b,pool=old_young/9/10/GAUGE/1500000000",
+		"app.shop=1.cart.size 3 1500000000":               "10.0.0.1/size/app=shop_1.cart,env=prod/3/10/GAUGE/1500000000",
+		"servers.web1 1 1500000000":                       "no metric",
+		"cpu.load x 1500000000":                           "bad value",
+		"cpu.load 1 2 3":                                  "bad fields",
+		"cpu.load;bad 1 1500000000":                       "bad tag bad",
+	}
+	for line, expect := range cases {
+		got := ""
+		mv, _, err := p.Parse(line, "10.0.0.1")
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = fmt.Sprintf("%s/%s/%s/%v/%d/%s/%d", mv.Endpoint, mv.Metric, mv.Tags, mv.Value, mv.Step, mv.Type, mv.Timestamp)
+		}
+		if got != expect {
+			t.Errorf("%s: expect %s, but %s", line, expect, got)
+		}
+	}
+}
+
+func TestParseGraphiteTemplate(t *testing.T) {
+	bad := []string{
+		".endpoint.host",
+		".metric*.endpoint",
+		"a.[ .metric",
+		"a b c d",
+	}
+	for _, s := range bad {
+		if _, err := parseGraphiteTemplate(s); err == nil {
+			t.Errorf("expect error for %q", s)
+		}
+	}
+}
+
+func TestOpenTsdbParse(t *testing.T) {
+	p := &openTsdbParser{cfg: &g.OpenTsdbConfig{Type: g.COUNTER}}
+
+	cases := map[string]string{
+		"put sys.cpu.user 1500000000 42.5 host=web1 cpu=0": "web1/sys.cpu.user/cpu=0/42.5/60/COUNTER/1500000000",
+		"put sys.cpu.user 1500000000123 1 endpoint=web2":   "web2/sys.cpu.user//1/60/COUNTER/1500000000",
+		"put proc.loadavg.1m 1500000000 0.5":               "10.0.0.1/proc.loadavg.1m//0.5/60/COUNTER/1500000000",
+		"put disk.used 1500000000 1 host=web1 path=a,b=c":  "web1/disk.used/path=a_b_c/1/60/COUNTER/1500000000",
+		"put sys.cpu.user 1500000000 1 host":               "bad tag host",
+		"put sys.cpu.user now 1":                           "bad timestamp",
+		"get sys.cpu.user":                                 "unknown command get",
+	}
+	for line, expect := range cases {
+		got := ""
+		mv, _, err := p.Parse(line, "10.0.0.1")
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = fmt.Sprintf("%s/%s/%s/%v/%d/%s/%d", mv.Endpoint, mv.Metric, mv.Tags, mv.Value, mv.Step, mv.Type, mv.Timestamp)
+		}
+		if got != expect {
+			t.Errorf("%s: expect %s, but %s", line, expect, got)
+		}
+	}
+
+	if mv, answer, err := p.Parse("version", "10.0.0.1"); mv != nil || answer != openTsdbVersion || err != nil {
+		t.Errorf("unexpected answer of version: %v %q %v", mv, answer, err)
+	}
+}
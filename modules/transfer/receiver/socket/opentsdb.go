@@ -0,0 +1,101 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socket
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+)
+
+// tcollector checks the connection with the version command
+const openTsdbVersion = "net.opentsdb compatible open-falcon transfer " + g.VERSION
+
+type openTsdbParser struct {
+	cfg *g.OpenTsdbConfig
+}
+
+// Parse reads `put metric timestamp value tag1=v1 ...`, the timestamp is in seconds or milliseconds.
+// The host tag, or else the endpoint tag, becomes the endpoint, the peer without them
+func (p *openTsdbParser) Parse(line string, peer string) (*cmodel.MetricValue, string, error) {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case "put":
+	case "version":
+		return nil, openTsdbVersion, nil
+	default:
+		return nil, "", fmt.Errorf("unknown command %s", fields[0])
+	}
+
+	if len(fields) < 4 {
+		return nil, "", fmt.Errorf("bad fields")
+	}
+
+	ts, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || ts <= 0 {
+		return nil, "", fmt.Errorf("bad timestamp")
+	}
+	if ts > 1e12 {
+		ts /= 1000
+	}
+
+	value, err := strconv.ParseFloat(fields[3], 64)
+	if err != nil {
+		return nil, "", fmt.Errorf("bad value")
+	}
+
+	tags := map[string]string{}
+	for _, tag := range fields[4:] {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, "", fmt.Errorf("bad tag %s", tag)
+		}
+		tags[cutils.SanitizeTag(kv[0])] = cutils.SanitizeTag(kv[1])
+	}
+
+	endpoint := tags["host"]
+	if endpoint == "" {
+		endpoint = tags["endpoint"]
+	}
+	if endpoint == "" {
+		endpoint = peer
+	}
+	delete(tags, "host")
+	delete(tags, "endpoint")
+
+	return &cmodel.MetricValue{
+		Endpoint:  endpoint,
+		Metric:    fields[1],
+		Value:     value,
+		Step:      lineStep(p.cfg.Step),
+		Type:      lineType(p.cfg.Type),
+		Tags:      cutils.SortedTags(tags),
+		Timestamp: ts,
+	}, "", nil
+}
+
+func StartOpenTsdb() {
+	cfg := g.Config().OpenTsdb
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+
+	parser := &openTsdbParser{cfg: cfg}
+	listenLines(cfg.Listen, cfg.Timeout, "opentsdb", parser.Parse)
+}
@@ -20,11 +20,20 @@ import (
 	"net"
 )
 
+// the line protocols carry no credential, rpc.auth does not cover them.
+// They should listen on a trusted network only when auth is enabled
+func warnUnauthenticated(from string) {
+	if rpc := g.Config().Rpc; rpc != nil && rpc.Auth != nil && rpc.Auth.Enabled {
+		log.Println(from, "takes the metrics of any endpoint without rpc.auth, listen on a trusted network only")
+	}
+}
+
 func StartSocket() {
 	if !g.Config().Socket.Enabled {
 		return
 	}
 
+	warnUnauthenticated("socket")
 	addr := g.Config().Socket.Listen
 	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
 	if err != nil {
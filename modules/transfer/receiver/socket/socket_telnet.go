@@ -76,6 +76,11 @@ func socketTelnetHandle(conn net.Conn) {
 	proc.SocketRecvCnt.IncrBy(int64(len(items)))
 	proc.RecvCnt.IncrBy(int64(len(items)))
 
+	if routes := g.Routes(); routes != nil {
+		sender.PushByRoutes(routes, items)
+		return
+	}
+
 	if cfg.Graph.Enabled {
 		sender.Push2GraphSendQueue(items)
 	}
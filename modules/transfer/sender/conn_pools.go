@@ -25,7 +25,7 @@ func initConnPools() {
 
 	// judge
 	judgeInstances := nset.NewStringSet()
-	for _, instance := range cfg.Judge.Cluster {
+	for _, instance := range g.AllNodes(cfg.Judge.Cluster, cfg.Judge.Clusters) {
 		judgeInstances.Add(instance)
 	}
 	JudgeConnPools = backend.CreateSafeRpcConnPools(cfg.Judge.MaxConns, cfg.Judge.MaxIdle,
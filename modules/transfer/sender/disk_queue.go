@@ -0,0 +1,464 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sender
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/toolkits/file"
+)
+
+const (
+	diskSegmentExt = ".seg"
+	diskHeadFile   = "head"
+	// payload length uint32, item count uint32, unix time int64
+	diskRecordHeaderLen = 16
+)
+
+// DiskQueue is a fifo of records in segment files,
+// a record is the json of a batch of items. Records are appended to the newest segment,
+// read from the oldest one and the position read is kept in the head file, so that
+// the queue survives restarts. The oldest segments are dropped beyond maxSize.
+// There may be many writers but only one reader, which peeks a record and commits it once sent.
+type DiskQueue struct {
+	sync.Mutex
+	dir         string
+	maxSize     int64 // bytes
+	segmentSize int64 // bytes
+
+	segments []int64         // ids of the segments, the oldest first
+	sizes    map[int64]int64 // id => bytes
+	counts   map[int64]int64 // id => items not read
+	size     int64
+	depth    int64
+	oldest   int64 // unix time of the oldest record not read
+
+	w    *os.File // the newest segment
+	wid  int64
+	r    *os.File // the oldest segment
+	rid  int64
+	roff int64 // offset of the oldest record not read
+
+	// the record peeked
+	peekId, peekOff, peekLen, peekCount int64
+
+	dropped int64 // items dropped beyond maxSize
+}
+
+type diskRecordHeader struct {
+	length int64
+	count  int64
+	ts     int64
+}
+
+func NewDiskQueue(dir string, maxSize int64, segmentSize int64) (*DiskQueue, error) {
+	if err := file.InsureDir(dir); err != nil {
+		return nil, err
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &DiskQueue{
+		dir:         dir,
+		maxSize:     maxSize,
+		segmentSize: segmentSize,
+		sizes:       make(map[int64]int64),
+		counts:      make(map[int64]int64),
+		peekId:      -1,
+	}
+
+	for _, fi := range fis {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), diskSegmentExt) {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimSuffix(fi.Name(), diskSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		q.segments = append(q.segments, id)
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i] < q.segments[j] })
+
+	headId, headOff := q.loadHead()
+	// the segments before the head were read before the restart
+	for len(q.segments) > 0 && q.segments[0] < headId {
+		os.Remove(q.segmentPath(q.segments[0]))
+		q.segments = q.segments[1:]
+	}
+	if len(q.segments) == 0 || q.segments[0] != headId {
+		headOff = 0
+	}
+
+	for i, id := range q.segments {
+		from := int64(0)
+		if i == 0 {
+			from = headOff
+		}
+		size, count, oldest, err := scanSegment(q.segmentPath(id), from)
+		if err != nil {
+			return nil, err
+		}
+		q.sizes[id] = size
+		q.counts[id] = count
+		q.size += size
+		q.depth += count
+		if q.oldest == 0 {
+			q.oldest = oldest
+		}
+	}
+
+	if len(q.segments) > 0 {
+		q.rid = q.segments[0]
+		q.roff = headOff
+	}
+
+	if err := q.openWriter(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (this *DiskQueue) segmentPath(id int64) string {
+	return filepath.Join(this.dir, fmt.Sprintf("%020d%s", id, diskSegmentExt))
+}
+
+func (this *DiskQueue) loadHead() (int64, int64) {
+	bs, err := ioutil.ReadFile(filepath.Join(this.dir, diskHeadFile))
+	if err != nil {
+		return 0, 0
+	}
+	var id, off int64
+	if _, err := fmt.Sscanf(string(bs), "%d %d", &id, &off); err != nil {
+		return 0, 0
+	}
+	return id, off
+}
+
+func (this *DiskQueue) saveHead() {
+	path := filepath.Join(this.dir, diskHeadFile)
+	bs := []byte(fmt.Sprintf("%d %d", this.rid, this.roff))
+	if err := ioutil.WriteFile(path+".tmp", bs, 0644); err != nil {
+		log.Println("write", path, "fail:", err)
+		return
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		log.Println("rename", path, "fail:", err)
+	}
+}
+
+// scanSegment returns the bytes up to the last whole record, the items and the time of the first record after from,
+// a record partly written before a crash is cut off
+func scanSegment(path string, from int64) (int64, int64, int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var count, oldest int64
+	off := from
+	for off+diskRecordHeaderLen <= fi.Size() {
+		h, err := readRecordHeader(f, off)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if off+diskRecordHeaderLen+h.length > fi.Size() {
+			break
+		}
+		if oldest == 0 {
+			oldest = h.ts
+		}
+		count += h.count
+		off += diskRecordHeaderLen + h.length
+	}
+
+	if off < fi.Size() {
+		log.Printf("truncate %s from %d to %d bytes", path, fi.Size(), off)
+		if err := f.Truncate(off); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return off, count, oldest, nil
+}
+
+func readRecordHeader(f *os.File, off int64) (*diskRecordHeader, error) {
+	buf := make([]byte, diskRecordHeaderLen)
+	if _, err := f.ReadAt(buf, off); err != nil {
+		return nil, err
+	}
+	return &diskRecordHeader{
+		length: int64(binary.BigEndian.Uint32(buf[0:4])),
+		count:  int64(binary.BigEndian.Uint32(buf[4:8])),
+		ts:     int64(binary.BigEndian.Uint64(buf[8:16])),
+	}, nil
+}
+
+// the last segment is appended unless it is full
+func (this *DiskQueue) openWriter() error {
+	id := int64(1)
+	if n := len(this.segments); n > 0 {
+		id = this.segments[n-1]
+		if this.sizes[id] >= this.segmentSize {
+			id++
+		}
+	}
+	return this.openSegment(id)
+}
+
+func (this *DiskQueue) openSegment(id int64) error {
+	f, err := os.OpenFile(this.segmentPath(id), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if n := len(this.segments); n == 0 || this.segments[n-1] != id {
+		this.segments = append(this.segments, id)
+		if n == 0 {
+			this.rid, this.roff = id, 0
+		}
+	}
+	this.w, this.wid = f, id
+	return nil
+}
+
+// Put appends a record of count items
+func (this *DiskQueue) Put(payload []byte, count int) error {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.w == nil {
+		return fmt.Errorf("disk queue %s closed", this.dir)
+	}
+
+	if this.sizes[this.wid] > 0 && this.sizes[this.wid]+diskRecordHeaderLen+int64(len(payload)) > this.segmentSize {
+		this.w.Close()
+		this.w = nil
+		if err := this.openSegment(this.wid + 1); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().Unix()
+	buf := make([]byte, diskRecordHeaderLen+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], uint32(count))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(now))
+	copy(buf[diskRecordHeaderLen:], payload)
+
+	if _, err := this.w.Write(buf); err != nil {
+		// cut the partial record off, the next ones would not be readable
+		this.w.Truncate(this.sizes[this.wid])
+		return err
+	}
+
+	this.sizes[this.wid] += int64(len(buf))
+	this.counts[this.wid] += int64(count)
+	this.size += int64(len(buf))
+	if this.depth == 0 {
+		this.oldest = now
+	}
+	this.depth += int64(count)
+
+	// the segment written is never dropped
+	for this.maxSize > 0 && this.size > this.maxSize && len(this.segments) > 1 {
+		id := this.segments[0]
+		this.dropped += this.counts[id]
+		this.removeOldestSegment()
+		log.Printf("disk queue %s is full, segment %d dropped", this.dir, id)
+	}
+	return nil
+}
+
+// Peek returns the oldest record and its item count, nil if the queue is empty
+func (this *DiskQueue) Peek() ([]byte, int, error) {
+	this.Lock()
+	defer this.Unlock()
+
+	for this.depth > 0 && len(this.segments) > 0 {
+		id := this.segments[0]
+		if this.roff >= this.sizes[id] {
+			if id == this.wid {
+				break
+			}
+			this.removeOldestSegment()
+			continue
+		}
+
+		if this.r == nil || this.rid != id {
+			if err := this.openReader(id); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		h, err := readRecordHeader(this.r, this.roff)
+		var payload []byte
+		if err == nil {
+			payload = make([]byte, h.length)
+			_, err = this.r.ReadAt(payload, this.roff+diskRecordHeaderLen)
+		}
+		if err != nil {
+			// a broken segment can not be read any more
+			log.Printf("read segment %d of %s fail: %v", id, this.dir, err)
+			if id == this.wid {
+				return nil, 0, err
+			}
+			this.dropped += this.counts[id]
+			this.removeOldestSegment()
+			continue
+		}
+
+		this.peekId, this.peekOff, this.peekLen, this.peekCount = id, this.roff, h.length, h.count
+		return payload, int(h.count), nil
+	}
+	return nil, 0, nil
+}
+
+// Commit removes the record peeked
+func (this *DiskQueue) Commit() {
+	this.Lock()
+	defer this.Unlock()
+
+	// dropped beyond maxSize after the peek
+	if this.peekId != this.rid || this.peekOff != this.roff {
+		return
+	}
+
+	this.roff += diskRecordHeaderLen + this.peekLen
+	this.counts[this.rid] -= this.peekCount
+	this.depth -= this.peekCount
+	this.peekId = -1
+
+	if this.roff >= this.sizes[this.rid] && this.rid != this.wid {
+		this.removeOldestSegment()
+	} else {
+		this.saveHead()
+		this.refreshOldest()
+	}
+}
+
+func (this *DiskQueue) openReader(id int64) error {
+	if this.r != nil {
+		this.r.Close()
+	}
+	f, err := os.Open(this.segmentPath(id))
+	if err != nil {
+		this.r = nil
+		return err
+	}
+	this.r, this.rid = f, id
+	return nil
+}
+
+// removeOldestSegment deletes the oldest segment, which is not the one written,
+// and moves the head to the next one
+func (this *DiskQueue) removeOldestSegment() {
+	id := this.segments[0]
+	this.segments = this.segments[1:]
+	this.size -= this.sizes[id]
+	this.depth -= this.counts[id]
+	delete(this.sizes, id)
+	delete(this.counts, id)
+
+	if this.r != nil && this.rid == id {
+		this.r.Close()
+		this.r = nil
+	}
+	if err := os.Remove(this.segmentPath(id)); err != nil && !os.IsNotExist(err) {
+		log.Println("remove segment fail:", err)
+	}
+
+	this.rid, this.roff = this.segments[0], 0
+	this.saveHead()
+	this.refreshOldest()
+}
+
+func (this *DiskQueue) refreshOldest() {
+	this.oldest = 0
+	if this.depth <= 0 || this.roff >= this.sizes[this.rid] {
+		return
+	}
+
+	if this.r == nil || this.rid != this.segments[0] {
+		if err := this.openReader(this.segments[0]); err != nil {
+			return
+		}
+	}
+	if h, err := readRecordHeader(this.r, this.roff); err == nil {
+		this.oldest = h.ts
+	}
+}
+
+// Depth is the number of items not read
+func (this *DiskQueue) Depth() int64 {
+	this.Lock()
+	defer this.Unlock()
+	return this.depth
+}
+
+func (this *DiskQueue) Stats() map[string]interface{} {
+	this.Lock()
+	defer this.Unlock()
+
+	age := int64(0)
+	if this.depth > 0 && this.oldest > 0 {
+		age = time.Now().Unix() - this.oldest
+	}
+	return map[string]interface{}{
+		"depth":   this.depth,
+		"bytes":   this.size,
+		"age":     age,
+		"dropped": this.dropped,
+	}
+}
+
+func (this *DiskQueue) Close() error {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.r != nil {
+		this.r.Close()
+		this.r = nil
+	}
+	if this.w == nil {
+		return nil
+	}
+	err := this.w.Close()
+	this.w = nil
+	return err
+}
+
+// Remove closes the queue and deletes its dir with the items not read
+func (this *DiskQueue) Remove() error {
+	this.Close()
+	return os.RemoveAll(this.dir)
+}
@@ -0,0 +1,130 @@
+package sender
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func drain(t *testing.T, q *DiskQueue) []string {
+	ret := []string{}
+	for {
+		payload, _, err := q.Peek()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payload == nil {
+			return ret
+		}
+		ret = append(ret, string(payload))
+		q.Commit()
+	}
+}
+
+func TestDiskQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk_queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 3 records of 16+4 bytes per segment
+	q, err := NewDiskQueue(dir, 1024, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		if err := q.Put([]byte(fmt.Sprintf("r%03d", i)), 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := q.Depth(); d != 16 {
+		t.Errorf("expect depth 16, but %d", d)
+	}
+
+	for i := 0; i < 4; i++ {
+		q.Peek()
+		q.Commit()
+	}
+	q.Close()
+
+	// the records read are not read again after a restart
+	q, err = NewDiskQueue(dir, 1024, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := q.Depth(); d != 8 {
+		t.Errorf("expect depth 8 after restart, but %d", d)
+	}
+	q.Put([]byte("r008"), 2)
+	if got := fmt.Sprint(drain(t, q)); got != "[r004 r005 r006 r007 r008]" {
+		t.Errorf("unexpected records %s", got)
+	}
+	if d := q.Depth(); d != 0 {
+		t.Errorf("expect depth 0, but %d", d)
+	}
+	q.Close()
+}
+
+func TestDiskQueueQuota(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk_queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := NewDiskQueue(dir, 100, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	for i := 0; i < 10; i++ {
+		q.Put([]byte(fmt.Sprintf("r%03d", i)), 1)
+	}
+
+	// the oldest segments of 2 records are dropped to keep 100 bytes
+	stats := q.Stats()
+	if stats["bytes"].(int64) > 100 || stats["dropped"].(int64) != 6 {
+		t.Errorf("unexpected stats %v", stats)
+	}
+	if got := fmt.Sprint(drain(t, q)); got != "[r006 r007 r008 r009]" {
+		t.Errorf("unexpected records %s", got)
+	}
+}
+
+func TestDiskQueuePartialRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk_queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := NewDiskQueue(dir, 1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Put([]byte("r000"), 1)
+	q.Close()
+
+	// a crash in the middle of a write
+	f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%020d%s", 1, diskSegmentExt)), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 4, 0, 0})
+	f.Close()
+
+	q, err = NewDiskQueue(dir, 1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	q.Put([]byte("r001"), 1)
+	if got := fmt.Sprint(drain(t, q)); got != "[r000 r001]" {
+		t.Errorf("unexpected records %s", got)
+	}
+}
@@ -23,6 +23,31 @@ import (
 func initNodeRings() {
 	cfg := g.Config()
 
-	JudgeNodeRing = rings.NewConsistentHashNodesRing(int32(cfg.Judge.Replicas), cutils.KeysOfMap(cfg.Judge.Cluster))
-	GraphNodeRing = rings.NewConsistentHashNodesRing(int32(cfg.Graph.Replicas), cutils.KeysOfMap(cfg.Graph.Cluster))
+	JudgeNodeRing, JudgeClusterRings = newNodeRings(cfg.Judge.Replicas, cfg.Judge.Cluster, cfg.Judge.Clusters)
+	GraphNodeRing, GraphClusterRings = newNodeRings(cfg.Graph.Replicas, cfg.Graph.Cluster, cfg.Graph.Clusters)
+}
+
+// 默认集群和路由规则使用的其他集群的哈希环
+func newNodeRings(replicas int, cluster map[string]string, clusters map[string]map[string]string) (*rings.ConsistentHashNodeRing, map[string]*rings.ConsistentHashNodeRing) {
+	ring := rings.NewConsistentHashNodesRing(int32(replicas), cutils.KeysOfMap(cluster))
+	clusterRings := make(map[string]*rings.ConsistentHashNodeRing)
+	for name, c := range clusters {
+		clusterRings[name] = rings.NewConsistentHashNodesRing(int32(replicas), cutils.KeysOfMap(c))
+	}
+	return ring, clusterRings
+}
+
+// 调用时需持有clusterLock, 集群不存在时返回nil
+func judgeRing(cluster string) *rings.ConsistentHashNodeRing {
+	if cluster == g.DefaultCluster {
+		return JudgeNodeRing
+	}
+	return JudgeClusterRings[cluster]
+}
+
+func graphRing(cluster string) *rings.ConsistentHashNodeRing {
+	if cluster == g.DefaultCluster {
+		return GraphNodeRing
+	}
+	return GraphClusterRings[cluster]
 }
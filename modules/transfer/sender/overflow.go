@@ -0,0 +1,285 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sender
+
+import (
+	"encoding/json"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	"github.com/open-falcon/falcon-plus/modules/transfer/proc"
+	nlist "github.com/toolkits/container/list"
+)
+
+const (
+	DefaultOverflowMaxSize     = 1024 // MB
+	DefaultOverflowSegmentSize = 64   // MB
+	// the oldest record on disk is sent again after
+	DefaultOverflowRetryInterval = time.Second
+)
+
+// 溢出到磁盘的发送队列, 未开启overflow时为nil
+// node -> queue_on_disk
+var (
+	TsdbOverflow   *DiskQueue
+	JudgeOverflows = make(map[string]*DiskQueue)
+	GraphOverflows = make(map[string]*DiskQueue)
+)
+
+var overflowDirReplacer = strings.NewReplacer("/", "_", ":", "_")
+
+// newOverflow opens the queue of a backend node in overflow.dir/kind/name,
+// the items left by the last run are sent first
+func newOverflow(kind string, name string) *DiskQueue {
+	cfg := g.Config().Overflow
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+
+	maxSize, segmentSize := cfg.MaxSize, cfg.SegmentSize
+	if maxSize <= 0 {
+		maxSize = DefaultOverflowMaxSize
+	}
+	if segmentSize <= 0 {
+		segmentSize = DefaultOverflowSegmentSize
+	}
+	// the segment written is never dropped, keep it small against the quota
+	maxSize, segmentSize = maxSize<<20, segmentSize<<20
+	if segmentSize > maxSize/4 {
+		segmentSize = maxSize / 4
+	}
+
+	dir := filepath.Join(cfg.Dir, kind, overflowDirReplacer.Replace(name))
+	Q, err := NewDiskQueue(dir, maxSize, segmentSize)
+	if err != nil {
+		log.Fatalln("open overflow queue", dir, "fail:", err)
+	}
+	if depth := Q.Depth(); depth > 0 {
+		log.Printf("overflow queue %s has %d items left", dir, depth)
+	}
+	return Q
+}
+
+// overflowItems appends the items to D as a record, false if they are lost
+func overflowItems(D *DiskQueue, items []interface{}) bool {
+	if D == nil || len(items) == 0 {
+		return false
+	}
+
+	bs, err := json.Marshal(items)
+	if err == nil {
+		err = D.Put(bs, len(items))
+	}
+	if err != nil {
+		log.Println("overflow to disk fail:", err)
+		return false
+	}
+
+	proc.OverflowCnt.IncrBy(int64(len(items)))
+	return true
+}
+
+// overflowBatch collects the items overflowing in a push, written to disk at once
+type overflowBatch map[*DiskQueue][]interface{}
+
+// push puts the item to the memory queue unless it is full or D is not drained yet,
+// D is sent after the memory queue, so the item goes to D as well to keep the order
+func (this overflowBatch) push(Q *nlist.SafeListLimited, D *DiskQueue, item interface{}) bool {
+	if D == nil {
+		return Q.PushFront(item)
+	}
+	if len(this[D]) == 0 && D.Depth() == 0 && Q.PushFront(item) {
+		return true
+	}
+	this[D] = append(this[D], item)
+	return true
+}
+
+// flush returns the number of items lost
+func (this overflowBatch) flush() int {
+	lost := 0
+	for D, items := range this {
+		if !overflowItems(D, items) {
+			lost += len(items)
+		}
+	}
+	return lost
+}
+
+// drainOverflow sends the oldest record of D by batch when the memory queue is empty,
+// it stays on disk and is sent again later if sending fails.
+// false if nothing is sent
+func drainOverflow(D *DiskQueue, batch int, decode func([]byte) ([]interface{}, error), send func([]interface{}) error) bool {
+	if D == nil {
+		return false
+	}
+
+	payload, _, err := D.Peek()
+	if err != nil {
+		log.Println("read overflow queue fail:", err)
+		time.Sleep(DefaultOverflowRetryInterval)
+		return false
+	}
+	if payload == nil {
+		return false
+	}
+
+	items, err := decode(payload)
+	if err != nil {
+		log.Println("drop broken overflow record:", err)
+		D.Commit()
+		return true
+	}
+
+	if batch < 1 {
+		batch = len(items)
+	}
+	for start := 0; start < len(items); start += batch {
+		end := start + batch
+		if end > len(items) {
+			end = len(items)
+		}
+		if err := send(items[start:end]); err != nil {
+			time.Sleep(DefaultOverflowRetryInterval)
+			return false
+		}
+	}
+
+	D.Commit()
+	return true
+}
+
+// failedBatches keeps the batches failed to send by their pop order,
+// they are sent again before anything popped later
+type failedBatches struct {
+	sync.Mutex
+	seq     int64
+	batches []*failedBatch
+}
+
+type failedBatch struct {
+	seq   int64
+	items []interface{}
+}
+
+// next returns the pop order of a batch
+func (this *failedBatches) next() int64 {
+	this.Lock()
+	defer this.Unlock()
+	this.seq++
+	return this.seq
+}
+
+func (this *failedBatches) add(seq int64, items []interface{}) {
+	this.Lock()
+	defer this.Unlock()
+	this.batches = append(this.batches, &failedBatch{seq: seq, items: items})
+}
+
+func (this *failedBatches) size() int {
+	this.Lock()
+	defer this.Unlock()
+	return len(this.batches)
+}
+
+// sorted takes the batches out by pop order
+func (this *failedBatches) sorted() []*failedBatch {
+	this.Lock()
+	defer this.Unlock()
+	batches := this.batches
+	this.batches = nil
+	sort.Slice(batches, func(i, j int) bool { return batches[i].seq < batches[j].seq })
+	return batches
+}
+
+// resend sends the batches in order, each one till it is sent,
+// the rest is kept if the task stops
+func (this *failedBatches) resend(task *sendTask, send func([]interface{}) error) {
+	batches := this.sorted()
+	for i, b := range batches {
+		for send(b.items) != nil {
+			if task.stopping() {
+				this.Lock()
+				this.batches = append(batches[i:], this.batches...)
+				this.Unlock()
+				return
+			}
+			time.Sleep(DefaultOverflowRetryInterval)
+		}
+	}
+}
+
+// spill writes the batches left to D in order
+func (this *failedBatches) spill(D *DiskQueue) {
+	for _, b := range this.sorted() {
+		overflowItems(D, b.items)
+	}
+}
+
+func decodeJudgeItems(bs []byte) ([]interface{}, error) {
+	var items []*cmodel.JudgeItem
+	if err := json.Unmarshal(bs, &items); err != nil {
+		return nil, err
+	}
+	ret := make([]interface{}, len(items))
+	for i, item := range items {
+		ret[i] = item
+	}
+	return ret, nil
+}
+
+func decodeGraphItems(bs []byte) ([]interface{}, error) {
+	var items []*cmodel.GraphItem
+	if err := json.Unmarshal(bs, &items); err != nil {
+		return nil, err
+	}
+	ret := make([]interface{}, len(items))
+	for i, item := range items {
+		ret[i] = item
+	}
+	return ret, nil
+}
+
+func decodeTsdbItems(bs []byte) ([]interface{}, error) {
+	var items []*cmodel.TsdbItem
+	if err := json.Unmarshal(bs, &items); err != nil {
+		return nil, err
+	}
+	ret := make([]interface{}, len(items))
+	for i, item := range items {
+		ret[i] = item
+	}
+	return ret, nil
+}
+
+func overflowStats(queues map[string]*DiskQueue) (int64, map[string]interface{}) {
+	var depth int64
+	stats := make(map[string]interface{})
+	for name, D := range queues {
+		if D == nil {
+			continue
+		}
+		s := D.Stats()
+		depth += s["depth"].(int64)
+		stats[name] = s
+	}
+	return depth, stats
+}
@@ -0,0 +1,306 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sender
+
+import (
+	"log"
+	"reflect"
+	"sync"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	"github.com/open-falcon/falcon-plus/modules/transfer/proc"
+	nlist "github.com/toolkits/container/list"
+)
+
+var reloadLock = new(sync.Mutex)
+
+// ReloadClusters 应用重新加载的配置中judge、graph的cluster, 不需要重启transfer.
+// 哈希环和发送队列一次性替换; 新增节点启动发送任务, 移除节点停止发送任务,
+// 其内存和磁盘队列中剩余的数据按新的哈希环重新分配到其他节点
+func ReloadClusters() {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	cfg := g.Config()
+	reloadJudgeCluster(cfg.Judge)
+	reloadGraphCluster(cfg.Graph)
+}
+
+// the queues of a node removed from the cluster
+type removedQueue struct {
+	node    string
+	cluster string
+	Q       *nlist.SafeListLimited
+	D       *DiskQueue
+}
+
+func reloadJudgeCluster(cfg *g.JudgeConfig) {
+	nodes := g.AllNodes(cfg.Cluster, cfg.Clusters)
+	nodeClusters := g.NodeClusters(cfg.Cluster, cfg.Clusters)
+
+	var added, changed []string
+	var removed []*removedQueue
+	for node, addr := range nodes {
+		if old, exists := judgeCluster[node]; !exists {
+			added = append(added, node)
+		} else if old != addr {
+			changed = append(changed, node)
+		}
+	}
+	for node := range judgeCluster {
+		if _, exists := nodes[node]; !exists {
+			removed = append(removed, &removedQueue{node: node, cluster: judgeNodeClusters[node], Q: JudgeQueues[node], D: JudgeOverflows[node]})
+		}
+	}
+	if len(added) == 0 && len(changed) == 0 && len(removed) == 0 && reflect.DeepEqual(nodeClusters, judgeNodeClusters) && cfg.Replicas == judgeReplicas {
+		return
+	}
+
+	ring, clusterRings := newNodeRings(cfg.Replicas, cfg.Cluster, cfg.Clusters)
+	clusterLock.Lock()
+	JudgeNodeRing, JudgeClusterRings = ring, clusterRings
+	judgeCluster, judgeNodeClusters = nodes, nodeClusters
+	judgeReplicas = cfg.Replicas
+	for _, node := range added {
+		JudgeQueues[node] = nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
+		JudgeOverflows[node] = newOverflow("judge", node)
+	}
+	for _, r := range removed {
+		delete(JudgeQueues, r.node)
+		delete(JudgeOverflows, r.node)
+	}
+	clusterLock.Unlock()
+
+	// 地址变更的节点保留发送队列, 以新地址重启发送任务
+	for _, node := range changed {
+		judgeTasks[node].Stop()
+	}
+	for _, r := range removed {
+		judgeTasks[r.node].Stop()
+		delete(judgeTasks, r.node)
+	}
+
+	addrs := make([]string, 0, len(nodes))
+	for _, addr := range nodes {
+		addrs = append(addrs, addr)
+	}
+	JudgeConnPools.Update(addrs)
+
+	for _, node := range append(added, changed...) {
+		startJudgeTask(node, nodes[node])
+	}
+
+	for _, r := range removed {
+		cluster := r.cluster
+		drainRemovedQueue(r, decodeJudgeItems, func(items []interface{}) {
+			repushJudgeItems(cluster, items)
+		})
+	}
+	log.Printf("reload judge cluster, added: %v, changed: %v, removed: %d", added, changed, len(removed))
+}
+
+func reloadGraphCluster(cfg *g.GraphConfig) {
+	nodeClusters := g.NodeClusters(cfg.Cluster, cfg.Clusters)
+	// node+addr -> node
+	oldKeys, newKeys := graphNodeKeys(graphCluster), graphNodeKeys(cfg.ClusterList)
+
+	var added []string
+	var removed []*removedQueue
+	for key := range newKeys {
+		if _, exists := oldKeys[key]; !exists {
+			added = append(added, key)
+		}
+	}
+	for key, node := range oldKeys {
+		if _, exists := newKeys[key]; !exists {
+			removed = append(removed, &removedQueue{node: node, cluster: graphNodeClusters[node], Q: GraphQueues[key], D: GraphOverflows[key]})
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 && reflect.DeepEqual(nodeClusters, graphNodeClusters) && cfg.Replicas == graphReplicas {
+		return
+	}
+
+	oldCluster := graphCluster
+	ring, clusterRings := newNodeRings(cfg.Replicas, cfg.Cluster, cfg.Clusters)
+	clusterLock.Lock()
+	GraphNodeRing, GraphClusterRings = ring, clusterRings
+	graphCluster, graphNodeClusters = cfg.ClusterList, nodeClusters
+	graphReplicas = cfg.Replicas
+	for _, key := range added {
+		node := newKeys[key]
+		GraphQueues[key] = nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
+		GraphOverflows[key] = newOverflow("graph", node+"@"+key[len(node):])
+	}
+	for key := range oldKeys {
+		if _, exists := newKeys[key]; !exists {
+			delete(GraphQueues, key)
+			delete(GraphOverflows, key)
+		}
+	}
+	clusterLock.Unlock()
+
+	for key := range oldKeys {
+		if _, exists := newKeys[key]; !exists {
+			graphTasks[key].Stop()
+			delete(graphTasks, key)
+		}
+	}
+
+	addrs := make([]string, 0)
+	for _, nitem := range cfg.ClusterList {
+		addrs = append(addrs, nitem.Addrs...)
+	}
+	GraphConnPools.Update(addrs)
+
+	for _, key := range added {
+		node := newKeys[key]
+		startGraphTask(node, key[len(node):])
+	}
+
+	for _, r := range removed {
+		// 同一节点中仍然存在的地址有各自的发送队列, 不再重复发送
+		skip := make(map[string]bool)
+		if nitem, exists := oldCluster[r.node]; exists {
+			for _, addr := range nitem.Addrs {
+				skip[addr] = true
+			}
+		}
+		from, cluster := r.node, r.cluster
+		drainRemovedQueue(r, decodeGraphItems, func(items []interface{}) {
+			repushGraphItems(from, cluster, skip, items)
+		})
+	}
+	log.Printf("reload graph cluster, added: %v, removed: %d", added, len(removed))
+}
+
+func graphNodeKeys(cluster map[string]*g.ClusterNode) map[string]string {
+	keys := make(map[string]string)
+	for node, nitem := range cluster {
+		for _, addr := range nitem.Addrs {
+			keys[node+addr] = node
+		}
+	}
+	return keys
+}
+
+// drainRemovedQueue 将移除节点的内存队列和磁盘队列中的数据重新分配, 然后删除磁盘队列
+func drainRemovedQueue(r *removedQueue, decode func([]byte) ([]interface{}, error), repush func([]interface{})) {
+	cnt := 0
+	if r.Q != nil {
+		for {
+			items := r.Q.PopBackBy(DefaultSendQueueMaxSize)
+			if len(items) == 0 {
+				break
+			}
+			cnt += len(items)
+			repush(items)
+		}
+	}
+
+	if r.D == nil {
+		log.Printf("drain the queue of removed node %s, %d items", r.node, cnt)
+		return
+	}
+	for {
+		payload, _, err := r.D.Peek()
+		if err != nil {
+			log.Println("read overflow queue fail:", err)
+			break
+		}
+		if payload == nil {
+			break
+		}
+		items, err := decode(payload)
+		if err != nil {
+			log.Println("drop broken overflow record:", err)
+		} else {
+			cnt += len(items)
+			repush(items)
+		}
+		r.D.Commit()
+	}
+	if err := r.D.Remove(); err != nil {
+		log.Println("remove overflow queue fail:", err)
+	}
+	log.Printf("drain the queue of removed node %s, %d items", r.node, cnt)
+}
+
+// repushJudgeItems 按集群cluster的哈希环重新分配数据, 集群已不存在时使用默认集群
+func repushJudgeItems(cluster string, items []interface{}) {
+	clusterLock.RLock()
+	defer clusterLock.RUnlock()
+
+	ring := judgeRing(cluster)
+	if ring == nil {
+		ring = JudgeNodeRing
+	}
+
+	overflow := make(overflowBatch)
+	defer func() {
+		proc.SendToJudgeDropCnt.IncrBy(int64(overflow.flush()))
+	}()
+
+	for _, it := range items {
+		item := it.(*cmodel.JudgeItem)
+		node, err := ring.GetNode(cutils.PK(item.Endpoint, item.Metric, item.Tags))
+		if err != nil {
+			proc.SendToJudgeDropCnt.Incr()
+			continue
+		}
+		if !overflow.push(JudgeQueues[node], JudgeOverflows[node], item) {
+			proc.SendToJudgeDropCnt.Incr()
+		}
+	}
+}
+
+// repushGraphItems 重新分配原属于集群cluster中节点from的数据, skip为from中已有这份数据的地址
+func repushGraphItems(from string, cluster string, skip map[string]bool, items []interface{}) {
+	clusterLock.RLock()
+	defer clusterLock.RUnlock()
+
+	ring := graphRing(cluster)
+	if ring == nil {
+		ring = GraphNodeRing
+	}
+
+	overflow := make(overflowBatch)
+	defer func() {
+		proc.SendToGraphDropCnt.IncrBy(int64(overflow.flush()))
+	}()
+
+	for _, it := range items {
+		item := it.(*cmodel.GraphItem)
+		node, err := ring.GetNode(cutils.PK(item.Endpoint, item.Metric, item.Tags))
+		if err != nil {
+			proc.SendToGraphDropCnt.Incr()
+			continue
+		}
+
+		errCnt := 0
+		for _, addr := range graphCluster[node].Addrs {
+			if node == from && skip[addr] {
+				continue
+			}
+			if !overflow.push(GraphQueues[node+addr], GraphOverflows[node+addr], item) {
+				errCnt += 1
+			}
+		}
+		if errCnt > 0 {
+			proc.SendToGraphDropCnt.Incr()
+		}
+	}
+}
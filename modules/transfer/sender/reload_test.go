@@ -0,0 +1,74 @@
+package sender
+
+import (
+	"fmt"
+	"testing"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	rings "github.com/toolkits/consistent/rings"
+	nlist "github.com/toolkits/container/list"
+)
+
+func TestDrainRemovedJudgeQueue(t *testing.T) {
+	removed := nlist.NewSafeListLimited(100)
+	for i := 0; i < 10; i++ {
+		removed.PushFront(&cmodel.JudgeItem{Endpoint: "host", Metric: fmt.Sprintf("m%d", i)})
+	}
+
+	JudgeNodeRing = rings.NewConsistentHashNodesRing(500, []string{"judge-01", "judge-02"})
+	JudgeQueues = map[string]*nlist.SafeListLimited{
+		"judge-01": nlist.NewSafeListLimited(100),
+		"judge-02": nlist.NewSafeListLimited(100),
+	}
+	JudgeOverflows = map[string]*DiskQueue{}
+
+	drainRemovedQueue(&removedQueue{node: "judge-00", Q: removed}, decodeJudgeItems, func(items []interface{}) {
+		repushJudgeItems(g.DefaultCluster, items)
+	})
+
+	if removed.Len() != 0 {
+		t.Errorf("expect the removed queue drained, but %d left", removed.Len())
+	}
+	total := 0
+	for node, Q := range JudgeQueues {
+		for _, it := range Q.FrontAll() {
+			item := it.(*cmodel.JudgeItem)
+			owner, _ := JudgeNodeRing.GetNode(cutils.PK(item.Endpoint, item.Metric, item.Tags))
+			if owner != node {
+				t.Errorf("%s is queued for %s, but owned by %s", item.Metric, node, owner)
+			}
+			total++
+		}
+	}
+	if total != 10 {
+		t.Errorf("expect 10 items repushed, but %d", total)
+	}
+}
+
+func TestDrainRemovedGraphAddr(t *testing.T) {
+	// graph-00 had a,b and b is replaced by c
+	removed := nlist.NewSafeListLimited(100)
+	removed.PushFront(&cmodel.GraphItem{Endpoint: "host", Metric: "m"})
+
+	GraphNodeRing = rings.NewConsistentHashNodesRing(500, []string{"graph-00"})
+	graphCluster = map[string]*g.ClusterNode{"graph-00": g.NewClusterNode([]string{"a", "c"})}
+	GraphQueues = map[string]*nlist.SafeListLimited{
+		"graph-00a": nlist.NewSafeListLimited(100),
+		"graph-00c": nlist.NewSafeListLimited(100),
+	}
+	GraphOverflows = map[string]*DiskQueue{}
+
+	skip := map[string]bool{"a": true, "b": true}
+	drainRemovedQueue(&removedQueue{node: "graph-00", Q: removed}, decodeGraphItems, func(items []interface{}) {
+		repushGraphItems("graph-00", g.DefaultCluster, skip, items)
+	})
+
+	if n := GraphQueues["graph-00a"].Len(); n != 0 {
+		t.Errorf("expect nothing sent to a again, but %d", n)
+	}
+	if n := GraphQueues["graph-00c"].Len(); n != 1 {
+		t.Errorf("expect the item sent to c, but %d", n)
+	}
+}
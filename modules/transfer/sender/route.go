@@ -0,0 +1,68 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sender
+
+import (
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	"github.com/open-falcon/falcon-plus/modules/transfer/proc"
+)
+
+// 按路由规则将数据打入graph、judge集群和tsdb的发送缓存队列, 每条数据使用第一条匹配的规则.
+// 未开启的后端不发送
+func PushByRoutes(table *g.RouteTable, items []*cmodel.MetaData) {
+	graphs := make(map[string][]*cmodel.MetaData)
+	judges := make(map[string][]*cmodel.MetaData)
+	tsdbs := []*cmodel.MetaData{}
+	hits := make(map[string]int64)
+
+	for _, item := range items {
+		r := table.Match(item.Endpoint, item.Metric, item.Tags)
+		hits[r.Name]++
+
+		for _, cluster := range r.Graph {
+			graphs[cluster] = append(graphs[cluster], item)
+		}
+		for _, cluster := range r.Judge {
+			judges[cluster] = append(judges[cluster], item)
+		}
+		if r.Tsdb {
+			tsdbs = append(tsdbs, item)
+		}
+	}
+
+	// statistics
+	for name, cnt := range hits {
+		proc.IncrRouteHit(name, cnt)
+	}
+
+	cfg := g.Config()
+
+	if cfg.Graph.Enabled {
+		for cluster, items := range graphs {
+			Push2GraphClusterSendQueue(cluster, items)
+		}
+	}
+
+	if cfg.Judge.Enabled {
+		for cluster, items := range judges {
+			Push2JudgeClusterSendQueue(cluster, items)
+		}
+	}
+
+	if cfg.Tsdb.Enabled && len(tsdbs) > 0 {
+		Push2TsdbSendQueue(tsdbs)
+	}
+}
@@ -0,0 +1,114 @@
+package sender
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	"github.com/open-falcon/falcon-plus/modules/transfer/proc"
+	nlist "github.com/toolkits/container/list"
+)
+
+func parseRouteConfig(t *testing.T, judgeEnabled bool) {
+	content := `{"minStep": 30,
+		"judge": {"enabled": ` + strconv.FormatBool(judgeEnabled) + `, "replicas": 500,
+			"cluster": {"judge-00": "127.0.0.1:6080"}, "clusters": {"tenant-a": {"judge-a-00": "127.0.0.1:6081"}}},
+		"graph": {"enabled": true, "replicas": 500, "cluster": {"graph-00": "127.0.0.1:6070"}},
+		"tsdb": {"enabled": false},
+		"route": {"enabled": true, "default": ["graph", "judge"], "rules": [
+			{"name": "debug", "metricPrefix": "debug.", "backends": ["graph"]},
+			{"name": "app", "metricPrefix": "app.", "backends": ["graph", "judge", "tsdb"]},
+			{"name": "tenant-a", "tags": {"tenant": "a"}, "backends": ["graph", "judge:tenant-a"]},
+			{"name": "app-a", "metricPrefix": "app.", "tags": {"tenant": "a"}, "backends": ["tsdb"]}]}}`
+
+	f, err := ioutil.TempFile("", "transfer-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(content)
+	f.Close()
+	g.ParseConfig(f.Name())
+
+	cfg := g.Config()
+	MinStep = cfg.MinStep
+	initNodeRings()
+	graphCluster = cfg.Graph.ClusterList
+	JudgeQueues = map[string]*nlist.SafeListLimited{
+		"judge-00":   nlist.NewSafeListLimited(100),
+		"judge-a-00": nlist.NewSafeListLimited(100),
+	}
+	JudgeOverflows = map[string]*DiskQueue{}
+	GraphQueues = map[string]*nlist.SafeListLimited{"graph-00127.0.0.1:6070": nlist.NewSafeListLimited(100)}
+	GraphOverflows = map[string]*DiskQueue{}
+	TsdbQueue = nlist.NewSafeListLimited(100)
+	TsdbOverflow = nil
+}
+
+func routeHits() map[string]int64 {
+	ret := make(map[string]int64)
+	for k, v := range proc.RouteHitCnt.Get().Other {
+		ret[k] = v.(int64)
+	}
+	return ret
+}
+
+func TestPushByRoutes(t *testing.T) {
+	parseRouteConfig(t, true)
+
+	item := func(metric string, tags map[string]string) *cmodel.MetaData {
+		return &cmodel.MetaData{Endpoint: "host", Metric: metric, Value: 1, Step: 60, CounterType: "GAUGE", Timestamp: 120, Tags: tags}
+	}
+	items := []*cmodel.MetaData{
+		item("debug.gc", nil),
+		item("app.qps", nil),
+		item("app.qps", map[string]string{"tenant": "a"}), // the first match, not app-a
+		item("cpu.idle", map[string]string{"tenant": "a"}),
+		item("cpu.idle", nil),
+	}
+
+	before := routeHits()
+	PushByRoutes(g.Routes(), items)
+
+	after := routeHits()
+	for name, expect := range map[string]int64{"debug": 1, "app": 2, "tenant-a": 1, "default": 1, "app-a": 0} {
+		if got := after[name] - before[name]; got != expect {
+			t.Errorf("expect %d hits of %s, but %d", expect, name, got)
+		}
+	}
+
+	counts := map[string]int{
+		"graph":   GraphQueues["graph-00127.0.0.1:6070"].Len(),
+		"judge":   JudgeQueues["judge-00"].Len(),
+		"judge-a": JudgeQueues["judge-a-00"].Len(),
+		"tsdb":    TsdbQueue.Len(),
+	}
+	// the tsdb backend is disabled
+	for name, expect := range map[string]int{"graph": 5, "judge": 3, "judge-a": 1, "tsdb": 0} {
+		if counts[name] != expect {
+			t.Errorf("expect %d items queued for %s, but %d", expect, name, counts[name])
+		}
+	}
+
+	if it, ok := JudgeQueues["judge-a-00"].PopBack().(*cmodel.JudgeItem); !ok || it.Metric != "cpu.idle" {
+		t.Errorf("expect cpu.idle of tenant a queued for judge:tenant-a, but %v", it)
+	}
+}
+
+func TestPushByRoutesDisabled(t *testing.T) {
+	parseRouteConfig(t, false)
+
+	PushByRoutes(g.Routes(), []*cmodel.MetaData{
+		{Endpoint: "host", Metric: "app.qps", Value: 1, Step: 60, CounterType: "GAUGE", Timestamp: 120},
+	})
+
+	if n := JudgeQueues["judge-00"].Len() + JudgeQueues["judge-a-00"].Len(); n != 0 {
+		t.Errorf("expect nothing queued for the disabled judge, but %d", n)
+	}
+	if n := GraphQueues["graph-00127.0.0.1:6070"].Len(); n != 1 {
+		t.Errorf("expect the item queued for graph, but %d", n)
+	}
+}
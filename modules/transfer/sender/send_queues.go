@@ -21,19 +21,22 @@ import (
 
 func initSendQueues() {
 	cfg := g.Config()
-	for node := range cfg.Judge.Cluster {
+	for node := range g.AllNodes(cfg.Judge.Cluster, cfg.Judge.Clusters) {
 		Q := nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
 		JudgeQueues[node] = Q
+		JudgeOverflows[node] = newOverflow("judge", node)
 	}
 
 	for node, nitem := range cfg.Graph.ClusterList {
 		for _, addr := range nitem.Addrs {
 			Q := nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
 			GraphQueues[node+addr] = Q
+			GraphOverflows[node+addr] = newOverflow("graph", node+"@"+addr)
 		}
 	}
 
 	if cfg.Tsdb.Enabled {
 		TsdbQueue = nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
+		TsdbOverflow = newOverflow("tsdb", "tsdb")
 	}
 }
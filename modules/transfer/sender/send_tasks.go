@@ -22,6 +22,7 @@ import (
 	nsema "github.com/toolkits/concurrent/semaphore"
 	"github.com/toolkits/container/list"
 	"log"
+	"sync"
 	"time"
 )
 
@@ -30,36 +31,102 @@ const (
 	DefaultSendTaskSleepInterval = time.Millisecond * 50 //默认睡眠间隔为50ms
 )
 
-// TODO 添加对发送任务的控制,比如stop等
-func startSendTasks() {
-	cfg := g.Config()
-	// init semaphore
-	judgeConcurrent := cfg.Judge.MaxConns
-	graphConcurrent := cfg.Graph.MaxConns
-	tsdbConcurrent := cfg.Tsdb.MaxConns
+// 发送任务, 节点从集群中移除或地址变更时停止
+// node -> task
+var (
+	judgeTasks = make(map[string]*sendTask)
+	graphTasks = make(map[string]*sendTask)
+)
 
-	if tsdbConcurrent < 1 {
-		tsdbConcurrent = 1
+type sendTask struct {
+	stop chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup // 正在发送的batch
+}
+
+func newSendTask() *sendTask {
+	return &sendTask{stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+func (this *sendTask) stopping() bool {
+	select {
+	case <-this.stop:
+		return true
+	default:
+		return false
 	}
+}
 
-	if judgeConcurrent < 1 {
-		judgeConcurrent = 1
+// Stop 等待正在发送的数据发送完成, 队列中剩余的数据不再发送
+func (this *sendTask) Stop() {
+	close(this.stop)
+	<-this.done
+}
+
+// forward 以有限并发按batch发送内存队列Q, Q为空时发送磁盘队列D.
+// 开启overflow时, 发送失败的batch先于之后的数据重新发送, 保证同一序列的数据按时间顺序到达;
+// 与之同时在发送中的batch可能先到达
+func forward(task *sendTask, Q *list.SafeListLimited, D *DiskQueue, batch int, concurrent int,
+	decode func([]byte) ([]interface{}, error), send func([]interface{}) error) {
+	defer close(task.done)
+	sema := nsema.NewSemaphore(concurrent)
+	failed := new(failedBatches)
+
+	for !task.stopping() {
+		if failed.size() > 0 {
+			// 在发送中的batch也可能失败, 等待其结束后按出队顺序重新发送
+			task.wg.Wait()
+			failed.resend(task, send)
+			continue
+		}
+
+		items := Q.PopBackBy(batch)
+		if len(items) == 0 {
+			if !drainOverflow(D, batch, decode, send) {
+				time.Sleep(DefaultSendTaskSleepInterval)
+			}
+			continue
+		}
+
+		//	同步Call + 有限并发 进行发送
+		seq := failed.next()
+		sema.Acquire()
+		if failed.size() > 0 {
+			// 等待发送时之前的batch失败了, 排在其后重新发送
+			sema.Release()
+			failed.add(seq, items)
+			continue
+		}
+		task.wg.Add(1)
+		go func(seq int64, items []interface{}) {
+			defer task.wg.Done()
+			defer sema.Release()
+			// 未开启overflow时丢弃发送失败的数据
+			if send(items) != nil && D != nil {
+				failed.add(seq, items)
+			}
+		}(seq, items)
 	}
+	task.wg.Wait()
+	// 停止时未发送的batch写入磁盘队列
+	failed.spill(D)
+}
 
-	if graphConcurrent < 1 {
-		graphConcurrent = 1
+func startSendTasks() {
+	cfg := g.Config()
+	tsdbConcurrent := cfg.Tsdb.MaxConns
+	if tsdbConcurrent < 1 {
+		tsdbConcurrent = 1
 	}
 
 	// init send go-routines
-	for node := range cfg.Judge.Cluster {
-		queue := JudgeQueues[node]
-		go forward2JudgeTask(queue, node, judgeConcurrent)
+	for node, addr := range g.AllNodes(cfg.Judge.Cluster, cfg.Judge.Clusters) {
+		startJudgeTask(node, addr)
 	}
 
 	for node, nitem := range cfg.Graph.ClusterList {
 		for _, addr := range nitem.Addrs {
-			queue := GraphQueues[node+addr]
-			go forward2GraphTask(queue, node, addr, graphConcurrent)
+			startGraphTask(node, addr)
 		}
 	}
 
@@ -68,137 +135,129 @@ func startSendTasks() {
 	}
 }
 
+// 发送队列和发送任务只在Start和ReloadClusters中修改, 这里读取无需加锁
+func startJudgeTask(node string, addr string) {
+	concurrent := g.Config().Judge.MaxConns
+	if concurrent < 1 {
+		concurrent = 1
+	}
+
+	task := newSendTask()
+	judgeTasks[node] = task
+	go forward2JudgeTask(task, JudgeQueues[node], JudgeOverflows[node], node, addr, concurrent)
+}
+
+func startGraphTask(node string, addr string) {
+	concurrent := g.Config().Graph.MaxConns
+	if concurrent < 1 {
+		concurrent = 1
+	}
+
+	task := newSendTask()
+	graphTasks[node+addr] = task
+	go forward2GraphTask(task, GraphQueues[node+addr], GraphOverflows[node+addr], node, addr, concurrent)
+}
+
 // Judge定时任务, 将 Judge发送缓存中的数据 通过rpc连接池 发送到Judge
-func forward2JudgeTask(Q *list.SafeListLimited, node string, concurrent int) {
+// 内存队列为空时, 再发送溢出到磁盘的数据
+func forward2JudgeTask(task *sendTask, Q *list.SafeListLimited, D *DiskQueue, node string, addr string, concurrent int) {
 	batch := g.Config().Judge.Batch // 一次发送,最多batch条数据
-	addr := g.Config().Judge.Cluster[node]
-	sema := nsema.NewSemaphore(concurrent)
+	forward(task, Q, D, batch, concurrent, decodeJudgeItems, func(items []interface{}) error {
+		return sendJudgeItems(node, addr, items)
+	})
+}
 
-	for {
-		items := Q.PopBackBy(batch)
-		count := len(items)
-		if count == 0 {
-			time.Sleep(DefaultSendTaskSleepInterval)
-			continue
-		}
+func sendJudgeItems(node string, addr string, items []interface{}) error {
+	count := len(items)
+	judgeItems := make([]*cmodel.JudgeItem, count)
+	for i := 0; i < count; i++ {
+		judgeItems[i] = items[i].(*cmodel.JudgeItem)
+	}
 
-		judgeItems := make([]*cmodel.JudgeItem, count)
-		for i := 0; i < count; i++ {
-			judgeItems[i] = items[i].(*cmodel.JudgeItem)
+	resp := &cmodel.SimpleRpcResponse{}
+	var err error
+	for i := 0; i < 3; i++ { //最多重试3次
+		err = JudgeConnPools.Call(addr, "Judge.Send", judgeItems, resp)
+		if err == nil {
+			break
 		}
+		time.Sleep(time.Millisecond * 10)
+	}
 
-		//	同步Call + 有限并发 进行发送
-		sema.Acquire()
-		go func(addr string, judgeItems []*cmodel.JudgeItem, count int) {
-			defer sema.Release()
-
-			resp := &cmodel.SimpleRpcResponse{}
-			var err error
-			sendOk := false
-			for i := 0; i < 3; i++ { //最多重试3次
-				err = JudgeConnPools.Call(addr, "Judge.Send", judgeItems, resp)
-				if err == nil {
-					sendOk = true
-					break
-				}
-				time.Sleep(time.Millisecond * 10)
-			}
-
-			// statistics
-			if !sendOk {
-				log.Printf("send judge %s:%s fail: %v", node, addr, err)
-				proc.SendToJudgeFailCnt.IncrBy(int64(count))
-			} else {
-				proc.SendToJudgeCnt.IncrBy(int64(count))
-			}
-		}(addr, judgeItems, count)
+	// statistics
+	if err != nil {
+		log.Printf("send judge %s:%s fail: %v", node, addr, err)
+		proc.SendToJudgeFailCnt.IncrBy(int64(count))
+	} else {
+		proc.SendToJudgeCnt.IncrBy(int64(count))
 	}
+	return err
 }
 
 // Graph定时任务, 将 Graph发送缓存中的数据 通过rpc连接池 发送到Graph
-func forward2GraphTask(Q *list.SafeListLimited, node string, addr string, concurrent int) {
+// 内存队列为空时, 再发送溢出到磁盘的数据
+func forward2GraphTask(task *sendTask, Q *list.SafeListLimited, D *DiskQueue, node string, addr string, concurrent int) {
 	batch := g.Config().Graph.Batch // 一次发送,最多batch条数据
-	sema := nsema.NewSemaphore(concurrent)
+	forward(task, Q, D, batch, concurrent, decodeGraphItems, func(items []interface{}) error {
+		return sendGraphItems(node, addr, items)
+	})
+}
 
-	for {
-		items := Q.PopBackBy(batch)
-		count := len(items)
-		if count == 0 {
-			time.Sleep(DefaultSendTaskSleepInterval)
-			continue
-		}
+func sendGraphItems(node string, addr string, items []interface{}) error {
+	count := len(items)
+	graphItems := make([]*cmodel.GraphItem, count)
+	for i := 0; i < count; i++ {
+		graphItems[i] = items[i].(*cmodel.GraphItem)
+	}
 
-		graphItems := make([]*cmodel.GraphItem, count)
-		for i := 0; i < count; i++ {
-			graphItems[i] = items[i].(*cmodel.GraphItem)
+	resp := &cmodel.SimpleRpcResponse{}
+	var err error
+	for i := 0; i < 3; i++ { //最多重试3次
+		err = GraphConnPools.Call(addr, "Graph.Send", graphItems, resp)
+		if err == nil {
+			break
 		}
+		time.Sleep(time.Millisecond * 10)
+	}
 
-		sema.Acquire()
-		go func(addr string, graphItems []*cmodel.GraphItem, count int) {
-			defer sema.Release()
-
-			resp := &cmodel.SimpleRpcResponse{}
-			var err error
-			sendOk := false
-			for i := 0; i < 3; i++ { //最多重试3次
-				err = GraphConnPools.Call(addr, "Graph.Send", graphItems, resp)
-				if err == nil {
-					sendOk = true
-					break
-				}
-				time.Sleep(time.Millisecond * 10)
-			}
-
-			// statistics
-			if !sendOk {
-				log.Printf("send to graph %s:%s fail: %v", node, addr, err)
-				proc.SendToGraphFailCnt.IncrBy(int64(count))
-			} else {
-				proc.SendToGraphCnt.IncrBy(int64(count))
-			}
-		}(addr, graphItems, count)
+	// statistics
+	if err != nil {
+		log.Printf("send to graph %s:%s fail: %v", node, addr, err)
+		proc.SendToGraphFailCnt.IncrBy(int64(count))
+	} else {
+		proc.SendToGraphCnt.IncrBy(int64(count))
 	}
+	return err
 }
 
 // Tsdb定时任务, 将数据通过api发送到tsdb
+// 内存队列为空时, 再发送溢出到磁盘的数据
 func forward2TsdbTask(concurrent int) {
 	batch := g.Config().Tsdb.Batch // 一次发送,最多batch条数据
-	retry := g.Config().Tsdb.MaxRetry
-	sema := nsema.NewSemaphore(concurrent)
-
-	for {
-		items := TsdbQueue.PopBackBy(batch)
-		if len(items) == 0 {
-			time.Sleep(DefaultSendTaskSleepInterval)
-			continue
-		}
-		//  同步Call + 有限并发 进行发送
-		sema.Acquire()
-		go func(itemList []interface{}) {
-			defer sema.Release()
+	forward(newSendTask(), TsdbQueue, TsdbOverflow, batch, concurrent, decodeTsdbItems, sendTsdbItems)
+}
 
-			var tsdbBuffer bytes.Buffer
-			for i := 0; i < len(itemList); i++ {
-				tsdbItem := itemList[i].(*cmodel.TsdbItem)
-				tsdbBuffer.WriteString(tsdbItem.TsdbString())
-				tsdbBuffer.WriteString("\n")
-			}
+func sendTsdbItems(itemList []interface{}) error {
+	var tsdbBuffer bytes.Buffer
+	for i := 0; i < len(itemList); i++ {
+		tsdbItem := itemList[i].(*cmodel.TsdbItem)
+		tsdbBuffer.WriteString(tsdbItem.TsdbString())
+		tsdbBuffer.WriteString("\n")
+	}
 
-			var err error
-			for i := 0; i < retry; i++ {
-				err = TsdbConnPoolHelper.Send(tsdbBuffer.Bytes())
-				if err == nil {
-					proc.SendToTsdbCnt.IncrBy(int64(len(itemList)))
-					break
-				}
-				time.Sleep(100 * time.Millisecond)
-			}
+	var err error
+	for i := 0; i < g.Config().Tsdb.MaxRetry; i++ {
+		err = TsdbConnPoolHelper.Send(tsdbBuffer.Bytes())
+		if err == nil {
+			proc.SendToTsdbCnt.IncrBy(int64(len(itemList)))
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
 
-			if err != nil {
-				proc.SendToTsdbFailCnt.IncrBy(int64(len(itemList)))
-				log.Println(err)
-				return
-			}
-		}(items)
+	if err != nil {
+		proc.SendToTsdbFailCnt.IncrBy(int64(len(itemList)))
+		log.Println(err)
 	}
+	return err
 }
@@ -0,0 +1,79 @@
+package sender
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	nlist "github.com/toolkits/container/list"
+)
+
+func TestForwardInOrderAcrossFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	D, err := NewDiskQueue(dir, 1<<20, 1<<16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Q := nlist.NewSafeListLimited(100)
+	for ts := int64(1); ts <= 6; ts++ {
+		Q.PushFront(&cmodel.GraphItem{Endpoint: "host", Metric: "m", Timestamp: ts})
+	}
+
+	var lock sync.Mutex
+	var sent []int64
+	calls := 0
+	send := func(items []interface{}) error {
+		lock.Lock()
+		defer lock.Unlock()
+		calls++
+		// the batch of 3,4 fails twice, 7,8 overflow to disk meanwhile
+		if items[0].(*cmodel.GraphItem).Timestamp == 3 && calls <= 3 {
+			if calls == 2 {
+				overflowItems(D, []interface{}{
+					&cmodel.GraphItem{Endpoint: "host", Metric: "m", Timestamp: 7},
+					&cmodel.GraphItem{Endpoint: "host", Metric: "m", Timestamp: 8},
+				})
+			}
+			return errors.New("graph down")
+		}
+		for _, it := range items {
+			sent = append(sent, it.(*cmodel.GraphItem).Timestamp)
+		}
+		return nil
+	}
+
+	task := newSendTask()
+	go forward(task, Q, D, 2, 1, decodeGraphItems, send)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		lock.Lock()
+		n := len(sent)
+		lock.Unlock()
+		if n == 8 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	task.Stop()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(sent) != 8 {
+		t.Fatalf("expect 8 points sent, but %v", sent)
+	}
+	for i, ts := range sent {
+		if ts != int64(i+1) {
+			t.Fatalf("expect the points sent in order, but %v", sent)
+		}
+	}
+}
@@ -23,6 +23,7 @@ import (
 	rings "github.com/toolkits/consistent/rings"
 	nlist "github.com/toolkits/container/list"
 	"log"
+	"sync"
 )
 
 const (
@@ -41,6 +42,26 @@ var (
 	GraphNodeRing *rings.ConsistentHashNodeRing
 )
 
+// 路由规则使用的其他集群的一致性哈希环
+// cluster -> ring
+var (
+	JudgeClusterRings map[string]*rings.ConsistentHashNodeRing
+	GraphClusterRings map[string]*rings.ConsistentHashNodeRing
+)
+
+// 生效中的集群配置, 与热加载的配置比较. 各集群的节点共用发送队列
+var (
+	judgeCluster      map[string]string // node -> addr
+	graphCluster      map[string]*g.ClusterNode
+	judgeNodeClusters map[string]string // node -> cluster
+	graphNodeClusters map[string]string
+	judgeReplicas     int
+	graphReplicas     int
+)
+
+// 集群配置热加载时, 加写锁替换哈希环、发送队列
+var clusterLock = new(sync.RWMutex)
+
 // 发送缓存队列
 // node -> queue_of_data
 var (
@@ -64,6 +85,12 @@ func Start() {
 	if MinStep < 1 {
 		MinStep = 30 //默认30s
 	}
+	cfg := g.Config()
+	judgeCluster = g.AllNodes(cfg.Judge.Cluster, cfg.Judge.Clusters)
+	graphCluster = cfg.Graph.ClusterList
+	judgeNodeClusters = g.NodeClusters(cfg.Judge.Cluster, cfg.Judge.Clusters)
+	graphNodeClusters = g.NodeClusters(cfg.Graph.Cluster, cfg.Graph.Clusters)
+	judgeReplicas, graphReplicas = cfg.Judge.Replicas, cfg.Graph.Replicas
 	//
 	initConnPools()
 	initSendQueues()
@@ -76,9 +103,29 @@ func Start() {
 
 // 将数据 打入 某个Judge的发送缓存队列, 具体是哪一个Judge 由一致性哈希 决定
 func Push2JudgeSendQueue(items []*cmodel.MetaData) {
+	Push2JudgeClusterSendQueue(g.DefaultCluster, items)
+}
+
+// 将数据 打入 judge集群cluster中某个Judge的发送缓存队列
+func Push2JudgeClusterSendQueue(cluster string, items []*cmodel.MetaData) {
+	clusterLock.RLock()
+	defer clusterLock.RUnlock()
+
+	ring := judgeRing(cluster)
+	if ring == nil {
+		log.Println("E: unknown judge cluster", cluster)
+		proc.SendToJudgeDropCnt.IncrBy(int64(len(items)))
+		return
+	}
+
+	overflow := make(overflowBatch)
+	defer func() {
+		proc.SendToJudgeDropCnt.IncrBy(int64(overflow.flush()))
+	}()
+
 	for _, item := range items {
 		pk := item.PK()
-		node, err := JudgeNodeRing.GetNode(pk)
+		node, err := ring.GetNode(pk)
 		if err != nil {
 			log.Println("E:", err)
 			continue
@@ -100,7 +147,7 @@ func Push2JudgeSendQueue(items []*cmodel.MetaData) {
 			Tags:      item.Tags,
 		}
 		Q := JudgeQueues[node]
-		isSuccess := Q.PushFront(judgeItem)
+		isSuccess := overflow.push(Q, JudgeOverflows[node], judgeItem)
 
 		// statistics
 		if !isSuccess {
@@ -111,7 +158,25 @@ func Push2JudgeSendQueue(items []*cmodel.MetaData) {
 
 // 将数据 打入 某个Graph的发送缓存队列, 具体是哪一个Graph 由一致性哈希 决定
 func Push2GraphSendQueue(items []*cmodel.MetaData) {
-	cfg := g.Config().Graph
+	Push2GraphClusterSendQueue(g.DefaultCluster, items)
+}
+
+// 将数据 打入 graph集群cluster中某个Graph的发送缓存队列
+func Push2GraphClusterSendQueue(cluster string, items []*cmodel.MetaData) {
+	clusterLock.RLock()
+	defer clusterLock.RUnlock()
+
+	ring := graphRing(cluster)
+	if ring == nil {
+		log.Println("E: unknown graph cluster", cluster)
+		proc.SendToGraphDropCnt.IncrBy(int64(len(items)))
+		return
+	}
+
+	overflow := make(overflowBatch)
+	defer func() {
+		proc.SendToGraphDropCnt.IncrBy(int64(overflow.flush()))
+	}()
 
 	for _, item := range items {
 		graphItem, err := convert2GraphItem(item)
@@ -125,17 +190,17 @@ func Push2GraphSendQueue(items []*cmodel.MetaData) {
 		proc.RecvDataTrace.Trace(pk, item)
 		proc.RecvDataFilter.Filter(pk, item.Value, item)
 
-		node, err := GraphNodeRing.GetNode(pk)
+		node, err := ring.GetNode(pk)
 		if err != nil {
 			log.Println("E:", err)
 			continue
 		}
 
-		cnode := cfg.ClusterList[node]
+		cnode := graphCluster[node]
 		errCnt := 0
 		for _, addr := range cnode.Addrs {
 			Q := GraphQueues[node+addr]
-			if !Q.PushFront(graphItem) {
+			if !overflow.push(Q, GraphOverflows[node+addr], graphItem) {
 				errCnt += 1
 			}
 		}
@@ -161,6 +226,10 @@ func convert2GraphItem(d *cmodel.MetaData) (*cmodel.GraphItem, error) {
 		item.Step = MinStep
 	}
 	item.Heartbeat = item.Step * 2
+	// a deduplicated value holds till the agent sends it again
+	if hb := int(d.Heartbeat) + item.Step; hb > item.Heartbeat {
+		item.Heartbeat = hb
+	}
 
 	if d.CounterType == g.GAUGE {
 		item.DsType = d.CounterType
@@ -185,9 +254,14 @@ func convert2GraphItem(d *cmodel.MetaData) (*cmodel.GraphItem, error) {
 
 // 将原始数据入到tsdb发送缓存队列
 func Push2TsdbSendQueue(items []*cmodel.MetaData) {
+	overflow := make(overflowBatch)
+	defer func() {
+		proc.SendToTsdbDropCnt.IncrBy(int64(overflow.flush()))
+	}()
+
 	for _, item := range items {
 		tsdbItem := convert2TsdbItem(item)
-		isSuccess := TsdbQueue.PushFront(tsdbItem)
+		isSuccess := overflow.push(TsdbQueue, TsdbOverflow, tsdbItem)
 
 		if !isSuccess {
 			proc.SendToTsdbDropCnt.Incr()
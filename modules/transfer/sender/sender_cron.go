@@ -15,8 +15,10 @@
 package sender
 
 import (
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
 	"github.com/open-falcon/falcon-plus/modules/transfer/proc"
 	"github.com/toolkits/container/list"
+	nproc "github.com/toolkits/proc"
 	"log"
 	"strings"
 	"time"
@@ -48,9 +50,32 @@ func startLogCron() {
 }
 
 func refreshSendingCacheSize() {
+	clusterLock.RLock()
+	defer clusterLock.RUnlock()
+
 	proc.JudgeQueuesCnt.SetCnt(calcSendCacheSize(JudgeQueues))
 	proc.GraphQueuesCnt.SetCnt(calcSendCacheSize(GraphQueues))
+
+	if g.Config().Overflow != nil && g.Config().Overflow.Enabled {
+		refreshOverflowCnt(proc.JudgeOverflowCnt, JudgeOverflows)
+		refreshOverflowCnt(proc.GraphOverflowCnt, GraphOverflows)
+		refreshOverflowCnt(proc.TsdbOverflowCnt, map[string]*DiskQueue{"tsdb": TsdbOverflow})
+	}
+}
+
+func refreshOverflowCnt(counter *nproc.SCounterBase, queues map[string]*DiskQueue) {
+	depth, stats := overflowStats(queues)
+	counter.SetCnt(depth)
+
+	// 节点可能已从集群中移除
+	counter.Lock()
+	counter.Other = make(map[string]interface{})
+	counter.Unlock()
+	for name, s := range stats {
+		counter.PutOther(name, s)
+	}
 }
+
 func calcSendCacheSize(mapList map[string]*list.SafeListLimited) int64 {
 	var cnt int64 = 0
 	for _, list := range mapList {
@@ -0,0 +1,48 @@
+package sender
+
+import (
+	"testing"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+)
+
+func TestConvert2GraphItem(t *testing.T) {
+	MinStep = 30
+
+	cases := []struct {
+		counterType string
+		step        int64
+		heartbeat   int64
+		dsType      string
+		expectStep  int
+		expectHb    int
+		expectTs    int64
+	}{
+		{g.GAUGE, 60, 0, g.GAUGE, 60, 120, 960},
+		// deduplicated by the agent
+		{g.GAUGE, 60, 600, g.GAUGE, 60, 660, 960},
+		// never below 2×step
+		{g.GAUGE, 60, 30, g.GAUGE, 60, 120, 960},
+		// the step is raised to MinStep first
+		{g.GAUGE, 10, 0, g.GAUGE, 30, 60, 990},
+		{g.GAUGE, 10, 600, g.GAUGE, 30, 630, 990},
+		{g.COUNTER, 60, 0, g.DERIVE, 60, 120, 960},
+	}
+
+	for i, c := range cases {
+		d := &cmodel.MetaData{Endpoint: "host", Metric: "m", Timestamp: 1000, Step: c.step, CounterType: c.counterType, Heartbeat: c.heartbeat}
+		item, err := convert2GraphItem(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.DsType != c.dsType || item.Step != c.expectStep || item.Heartbeat != c.expectHb || item.Timestamp != c.expectTs {
+			t.Errorf("case %d: expect %s/%d/%d/%d, but %s/%d/%d/%d", i, c.dsType, c.expectStep, c.expectHb, c.expectTs,
+				item.DsType, item.Step, item.Heartbeat, item.Timestamp)
+		}
+	}
+
+	if _, err := convert2GraphItem(&cmodel.MetaData{Step: 60, CounterType: "ABSOLUTE"}); err == nil {
+		t.Error("expect not_supported_counter_type")
+	}
+}
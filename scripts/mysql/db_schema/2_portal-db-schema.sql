@@ -148,6 +148,22 @@ CREATE TABLE `plugin_dir` (
   DEFAULT CHARSET =utf8
   COLLATE =utf8_unicode_ci;
 
+DROP TABLE IF EXISTS agent_version;
+CREATE TABLE `agent_version` (
+  `id`          INT(10) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `grp_id`      INT(10) UNSIGNED NOT NULL,
+  `version`     VARCHAR(64)      NOT NULL,
+  `url`         VARCHAR(255)     NOT NULL,
+  `checksum`    VARCHAR(64)      NOT NULL,
+  `create_user` VARCHAR(64)      NOT NULL DEFAULT '',
+  `create_at`   TIMESTAMP        NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_agent_version_grp_id` (`grp_id`)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8
+  COLLATE =utf8_unicode_ci;
+
 
 DROP TABLE IF EXISTS action;
 CREATE TABLE `action` (